@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"runtime"
+	"strconv"
 )
 
 // AppConfig 应用配置
@@ -19,6 +21,30 @@ type AppConfig struct {
 	DBUser     string
 	DBPassword string
 	DBName     string
+	// 异步任务配置
+	JobWorkers   int
+	JobQueueSize int
+	// 编码调度配置
+	EncodeCapacity  int
+	EncodeQueueSize int
+	// ffmpeg/ffprobe单次调用超时（秒）
+	FFmpegTimeout  int
+	FFprobeTimeout int
+	// 字幕字体文件
+	CaptionFontFile string
+	// GIF编码器: auto(有ffmpeg时使用ffmpeg) / ffmpeg / go
+	GifEncoder string
+	// 转换预设文件（JSON数组），与内置预设按名称合并
+	PresetsFile string
+	// 转换结果缓存条目数，0为不缓存
+	ConversionCacheSize int
+	// 可续传上传的最大文件大小（MB）和未完成上传的过期时间（小时）
+	ResumableUploadMaxSize int
+	ResumableUploadExpiry  int
+	// 匿名会话令牌的签名密钥，为空时启动时随机生成（重启后已签发的会话失效）
+	SessionSecret string
+	// 会话cookie的Secure属性：auto按请求是否为HTTPS（包括反向代理的X-Forwarded-Proto）设置，true/false强制开启或关闭
+	SessionCookieSecure string
 }
 
 var Config *AppConfig
@@ -63,6 +89,30 @@ func LoadConfig() *AppConfig {
 		DBUser:     getEnv("DB_USER", "root"),
 		DBPassword: getEnv("DB_PASSWORD", ""),
 		DBName:     getEnv("DB_NAME", "toGO"),
+		// 异步任务配置
+		// worker只负责等待编码资源，实际并发由编码调度器控制
+		JobWorkers:   getEnvInt("JOB_WORKERS", 32),
+		JobQueueSize: getEnvInt("JOB_QUEUE_SIZE", 32),
+		// 编码调度配置，容量按权重计算（low@240为1，ultra@3840为8）
+		EncodeCapacity:  getEnvInt("ENCODE_CAPACITY", runtime.NumCPU()),
+		EncodeQueueSize: getEnvInt("ENCODE_QUEUE_SIZE", 16),
+		// ffmpeg/ffprobe单次调用超时（秒）
+		FFmpegTimeout:  getEnvInt("FFMPEG_TIMEOUT", 600),
+		FFprobeTimeout: getEnvInt("FFPROBE_TIMEOUT", 30),
+		// 字幕字体文件，需支持中文
+		CaptionFontFile: getEnv("CAPTION_FONT_FILE", "./fonts/caption.ttf"),
+		// GIF编码器，未安装ffmpeg时自动使用纯Go编码器
+		GifEncoder: getEnv("GIF_ENCODER", "auto"),
+		// 转换预设文件，不存在时只使用内置预设
+		PresetsFile: getEnv("PRESETS_FILE", "./presets.json"),
+		// 转换结果缓存，相同视频和参数直接返回已有结果
+		ConversionCacheSize: getEnvInt("CONVERSION_CACHE_SIZE", 500),
+		// 可续传上传，断线后可从中断处继续，因此允许比普通上传更大的文件
+		ResumableUploadMaxSize: getEnvInt("RESUMABLE_UPLOAD_MAX_SIZE", 500),
+		ResumableUploadExpiry:  getEnvInt("RESUMABLE_UPLOAD_EXPIRY", 24),
+		// 会话签名密钥，多实例部署时需配置相同的值
+		SessionSecret:       getEnv("SESSION_SECRET", ""),
+		SessionCookieSecure: getEnv("SESSION_COOKIE_SECURE", "auto"),
 	}
 
 	return Config
@@ -129,3 +179,13 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt 获取整数类型的环境变量，不存在或格式错误时返回默认值
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
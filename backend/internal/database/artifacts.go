@@ -0,0 +1,47 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Artifact 文件归属记录，一个文件可以属于多个会话
+// 以会话ID为归属键，日后会话绑定邮箱时可将归属整体转移到账号下
+type Artifact struct {
+	Owner     string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"primaryKey;size:128;index"`
+	CreatedAt time.Time
+}
+
+// ArtifactStore 基于数据库的文件归属存储，服务重启后归属仍然有效
+type ArtifactStore struct{}
+
+// Claim 将文件登记到会话名下，已登记时忽略
+func (ArtifactStore) Claim(owner, name string) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&Artifact{Owner: owner, Name: name}).Error
+}
+
+// Owns 会话是否拥有该文件，查询失败时视为不拥有
+func (ArtifactStore) Owns(owner, name string) bool {
+	var count int64
+	if err := DB.Model(&Artifact{}).Where("owner = ? AND name = ?", owner, name).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Release 解除会话对文件的归属，返回仍拥有该文件的会话数
+func (ArtifactStore) Release(owner, name string) (int, error) {
+	if err := DB.Delete(&Artifact{}, "owner = ? AND name = ?", owner, name).Error; err != nil {
+		return 0, err
+	}
+	var count int64
+	err := DB.Model(&Artifact{}).Where("name = ?", name).Count(&count).Error
+	return int(count), err
+}
+
+// Forget 文件已被删除，清除其全部归属记录
+func (ArtifactStore) Forget(name string) error {
+	return DB.Delete(&Artifact{}, "name = ?", name).Error
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"time"
+)
+
+// 转换记录状态，与异步任务状态一致
+const (
+	ConversionQueued    = "queued"
+	ConversionRunning   = "running"
+	ConversionSucceeded = "succeeded"
+	ConversionFailed    = "failed"
+	ConversionCancelled = "cancelled"
+)
+
+// Conversion 转换记录，按客户端归属；输出文件被定时清理后记录仍然保留，只是不再提供下载
+type Conversion struct {
+	ID             string    `gorm:"primaryKey;size:32"` // 与输出文件的标识相同
+	Owner          string    `gorm:"index:idx_conversions_owner_created,priority:1;size:64;not null"`
+	JobID          string    `gorm:"size:32"`
+	SourceFilename string    `gorm:"size:255"`
+	InputSize      int64     `gorm:"not null;default:0"`
+	Format         string    `gorm:"size:10"`
+	Preset         string    `gorm:"size:64"`
+	Params         string    `gorm:"type:text"` // 转换参数JSON
+	OutputFile     string    `gorm:"size:64"`
+	OutputSize     int64     `gorm:"not null;default:0"`
+	ZipFile        string    `gorm:"size:64"`
+	ZipSize        int64     `gorm:"not null;default:0"`
+	StartTime      float64   `gorm:"not null;default:0"`
+	Duration       float64   `gorm:"not null;default:0"`
+	VideoDuration  float64   `gorm:"not null;default:0"`
+	Cached         bool      `gorm:"not null;default:false"` // 命中转换缓存，输出文件与其他记录共用
+	Status         string    `gorm:"index;size:16"`
+	Error          string    `gorm:"size:1000"`
+	CreatedAt      time.Time `gorm:"index:idx_conversions_owner_created,priority:2"`
+	FinishedAt     *time.Time
+	ExpiresAt      *time.Time // 输出文件的清理时间
+}
+
+// ConversionQuery 转换记录查询条件，Owner必填，其余为空时不过滤
+type ConversionQuery struct {
+	Owner    string
+	Format   string
+	Status   string
+	Since    *time.Time
+	Until    *time.Time
+	Page     int
+	PageSize int
+}
+
+// Available 数据库是否已连接并完成迁移；不可用时转换记录改用文件系统扫描，文件归属保存在内存中
+func Available() bool {
+	return DB != nil && migrated
+}
+
+// CreateConversion 创建转换记录
+func CreateConversion(conversion *Conversion) error {
+	return DB.Create(conversion).Error
+}
+
+// UpdateConversion 更新转换记录的指定字段
+func UpdateConversion(id string, updates map[string]interface{}) error {
+	return DB.Model(&Conversion{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// FailStaleConversions 将服务重启前未完成的转换记录标记为失败，返回更新的条数
+// 任务只保存在内存中，重启后这些记录不会再有结果，否则历史中会一直显示为进行中且无法删除
+func FailStaleConversions() (int64, error) {
+	result := DB.Model(&Conversion{}).
+		Where("status IN ?", []string{ConversionQueued, ConversionRunning}).
+		Updates(map[string]interface{}{
+			"status":      ConversionFailed,
+			"error":       "服务重启，转换已中断",
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ListConversions 按条件分页查询转换记录，按创建时间倒序，同时返回总数
+func ListConversions(query ConversionQuery) ([]Conversion, int64, error) {
+	db := DB.Model(&Conversion{}).Where("owner = ?", query.Owner)
+	if query.Format != "" {
+		db = db.Where("format = ?", query.Format)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.Since != nil {
+		db = db.Where("created_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where("created_at < ?", *query.Until)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var conversions []Conversion
+	err := db.Order("created_at DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&conversions).Error
+	return conversions, total, err
+}
+
+// GetConversion 获取属于owner的转换记录
+func GetConversion(owner, id string) (*Conversion, error) {
+	var conversion Conversion
+	if err := DB.Where("id = ? AND owner = ?", id, owner).First(&conversion).Error; err != nil {
+		return nil, err
+	}
+	return &conversion, nil
+}
+
+// DeleteConversion 删除转换记录
+func DeleteConversion(id string) error {
+	return DB.Delete(&Conversion{}, "id = ?", id).Error
+}
+
+// CountConversionsByOutput 会话中引用同一输出文件的记录数，同一会话重复转换命中缓存时多条记录共用输出文件
+func CountConversionsByOutput(owner, outputFile string) (int64, error) {
+	var count int64
+	err := DB.Model(&Conversion{}).Where("owner = ? AND output_file = ?", owner, outputFile).Count(&count).Error
+	return count, err
+}
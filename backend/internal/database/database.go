@@ -14,6 +14,9 @@ import (
 
 var DB *gorm.DB
 
+// migrated 数据表是否已迁移完成
+var migrated bool
+
 // VisitorRecord 访问记录数据库模型 - 记录所有访问，不去重
 type VisitorRecord struct {
 	ID        uint   `gorm:"primaryKey"`
@@ -46,6 +49,7 @@ type UniqueVisitor struct {
 // InitDatabase 初始化数据库连接
 func InitDatabase() error {
 	cfg := config.LoadConfig()
+	migrated = false
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local&timeout=10s&readTimeout=30s&writeTimeout=30s",
 		cfg.DBUser,
@@ -82,10 +86,11 @@ func InitDatabase() error {
 	}
 
 	// 自动迁移数据库表
-	err = DB.AutoMigrate(&VisitorRecord{}, &VisitorStats{}, &UniqueVisitor{})
+	err = DB.AutoMigrate(&VisitorRecord{}, &VisitorStats{}, &UniqueVisitor{}, &Conversion{}, &Artifact{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %v", err)
 	}
+	migrated = true
 
 	log.Println("Database connected and migrated successfully")
 	return nil
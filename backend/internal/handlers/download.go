@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadFile 以附件形式下载当前会话拥有的输出文件
+func DownloadFile(c *gin.Context) {
+	filename := c.Param("filename")
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "文件名不能为空",
+		})
+		return
+	}
+
+	// 只能下载当前会话拥有的文件
+	if !requireArtifact(c, filename) {
+		return
+	}
+
+	// 构建文件路径
+	filePath := filepath.Join(config.GetStaticDir(), filename)
+
+	// 检查文件是否存在
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "文件不存在",
+		})
+		return
+	}
+
+	// 设置强制下载的头部，文件名按RFC 2231编码，包含引号、分号或非ASCII字符时也能正确解析
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Header("Content-Type", "application/octet-stream")
+	c.File(filePath)
+}
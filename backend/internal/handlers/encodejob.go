@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// encodeJob 需要编码资源的异步任务
+type encodeJob struct {
+	jobType string
+	owner   string
+	label   string // 任务名称，用于响应提示，如"转换"、"导出"
+	run     utils.JobFunc
+	// inputs 任务使用的上传文件或目录，任务结束前不会被清理
+	inputs []string
+	// onAdmit 通过排队检查、提交任务前调用，可以为nil，用于写入排队中的记录
+	onAdmit func()
+	// onFinish 任务结束、排队期间被取消或未能提交时都会调用且只调用一次，可以为nil，用于清理临时文件和更新记录
+	// 未能提交时收到的快照状态为失败，Error为失败原因
+	onFinish utils.JobFinishFunc
+}
+
+// encodeReservationKey 任务context中保存编码排队预留的键
+type encodeReservationKey struct{}
+
+// submitEncodeJob 提交需要编码资源的异步任务并写入响应
+// 提交前在编码调度器中预留排队位置，已返回202的任务在worker中申请资源时不会再因队列已满而失败
+// 成功时返回202和任务信息，编码队列已满时返回503和Retry-After
+func submitEncodeJob(c *gin.Context, ej encodeJob) (*utils.Job, bool) {
+	var reservation *utils.EncodeReservation
+	releaseInputs := utils.RetainUploads(ej.inputs...)
+	onFinish := func(snapshot utils.JobSnapshot) {
+		releaseInputs()
+		// 任务未执行就结束时预留位置没有被使用，在这里归还
+		if reservation != nil {
+			reservation.Release()
+		}
+		if ej.onFinish != nil {
+			ej.onFinish(snapshot)
+		}
+	}
+	reject := func(err error) {
+		onFinish(utils.JobSnapshot{
+			Type:       ej.jobType,
+			Owner:      ej.owner,
+			Status:     utils.JobFailed,
+			Error:      err.Error(),
+			FinishedAt: time.Now(),
+		})
+	}
+
+	if jobManager == nil {
+		reject(errors.New("任务服务未初始化"))
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return nil, false
+	}
+
+	// 编码队列已满时拒绝新任务，提示客户端稍后重试
+	scheduler := utils.GetEncodeScheduler()
+	reservation, ok := scheduler.Reserve()
+	if !ok {
+		reject(utils.ErrEncodeQueueFull)
+		respondBusy(c, scheduler.RetryAfter())
+		return nil, false
+	}
+
+	if ej.onAdmit != nil {
+		ej.onAdmit()
+	}
+	run := func(ctx context.Context, job *utils.Job) (interface{}, error) {
+		return ej.run(context.WithValue(ctx, encodeReservationKey{}, reservation), job)
+	}
+	job, err := jobManager.Submit(ej.jobType, ej.owner, run, onFinish)
+	if err != nil {
+		reject(err)
+		if errors.Is(err, utils.ErrJobQueueFull) {
+			respondBusy(c, scheduler.RetryAfter())
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "提交" + ej.label + "任务失败: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Code:    202,
+		Message: ej.label + "任务已提交",
+		Data:    toJobInfo(job.Snapshot()),
+	})
+	return job, true
+}
+
+// acquireEncode 在任务worker中申请编码资源，排队期间上报队列位置，返回的release必须调用
+// 通过submitEncodeJob提交的任务使用提交时预留的排队位置
+func acquireEncode(ctx context.Context, job *utils.Job, weight int) (func(), error) {
+	onPosition := func(position int) {
+		job.SetProgress(models.ConversionProgress{
+			Phase:         "queued",
+			QueuePosition: position,
+		})
+	}
+	var release func()
+	var err error
+	if reservation, ok := ctx.Value(encodeReservationKey{}).(*utils.EncodeReservation); ok {
+		release, err = reservation.Acquire(ctx, weight, onPosition)
+	} else {
+		release, err = utils.GetEncodeScheduler().Acquire(ctx, weight, onPosition)
+	}
+	if err != nil {
+		if errors.Is(err, utils.ErrEncodeQueueFull) {
+			return nil, fmt.Errorf("服务器繁忙，请稍后再试")
+		}
+		return nil, fmt.Errorf("任务已取消")
+	}
+	return release, nil
+}
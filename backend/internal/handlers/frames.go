@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次导出的最大帧数
+const maxExportFrames = 1000
+
+// frameExport 帧导出任务参数
+type frameExport struct {
+	inputPath string
+	source    string // video / gif
+	startTime float64
+	duration  float64
+	options   utils.FrameExportOptions
+}
+
+// ExportFrames 将视频片段或GIF拆分为PNG/JPEG图片序列，连同manifest.json打包为ZIP
+// 上传video字段按视频处理，上传gif字段按GIF处理
+func ExportFrames(c *gin.Context) {
+	if !requireFFmpeg(c) {
+		return
+	}
+
+	var req models.FrameExportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	format := utils.FramePNG
+	if req.Format != "" {
+		format = strings.ToLower(req.Format)
+	}
+	if format != utils.FramePNG && format != utils.FrameJPEG {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "图片格式只能是png/jpeg",
+		})
+		return
+	}
+	if req.Width != nil && (*req.Width < 16 || *req.Width > 3840) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "宽度必须在16-3840像素之间",
+		})
+		return
+	}
+	if req.FPS != nil && (*req.FPS < 0 || *req.FPS > 60) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "帧率必须在0-60之间",
+		})
+		return
+	}
+
+	// 视频默认按10fps导出，GIF默认保留原始帧和延迟
+	source := "video"
+	fps := 10.0
+	var inputPath string
+	var ok bool
+	if _, err := c.FormFile("gif"); err == nil {
+		source = "gif"
+		fps = 0
+		inputPath, _, ok = receiveAnimationUpload(c, utils.FormatGIF)
+	} else {
+		inputPath, ok = receiveVideoUpload(c)
+	}
+	if !ok {
+		return
+	}
+	if req.FPS != nil {
+		fps = *req.FPS
+	}
+	if source == "video" && fps == 0 {
+		removeUpload(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "视频导出必须指定帧率",
+		})
+		return
+	}
+
+	mediaInfo, ok := probeUploadedVideo(c, inputPath)
+	if !ok {
+		removeUpload(inputPath)
+		return
+	}
+	if mediaInfo.VideoCodec == "" || mediaInfo.Duration <= 0 {
+		removeUpload(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "无法确定时长，文件可能已损坏",
+		})
+		return
+	}
+
+	startTime := 0.0
+	if req.StartTime != nil {
+		startTime = *req.StartTime
+	}
+	if startTime < 0 || startTime >= mediaInfo.Duration {
+		removeUpload(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: fmt.Sprintf("开始时间必须在0-%.2f秒之间", mediaInfo.Duration),
+		})
+		return
+	}
+	duration := mediaInfo.Duration - startTime
+	if req.Duration != nil && *req.Duration > 0 {
+		duration = math.Min(*req.Duration, duration)
+	}
+
+	// 固定帧率时可以提前判断帧数，保留原始帧时在导出时截断
+	if fps > 0 && int(math.Ceil(duration*fps)) > maxExportFrames {
+		removeUpload(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: fmt.Sprintf("导出帧数不能超过%d帧，请降低帧率或缩短时长", maxExportFrames),
+		})
+		return
+	}
+
+	export := frameExport{
+		inputPath: inputPath,
+		source:    source,
+		startTime: startTime,
+		duration:  duration,
+		options: utils.FrameExportOptions{
+			FPS:       fps,
+			Format:    format,
+			MaxFrames: maxExportFrames,
+		},
+	}
+	if req.Width != nil {
+		export.options.Width = *req.Width
+	}
+
+	submitEncodeJob(c, encodeJob{
+		jobType: "frames-export",
+		owner:   middleware.GetSessionID(c),
+		label:   "导出",
+		inputs:  []string{inputPath},
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			return runFrameExport(ctx, job, export)
+		},
+		onFinish: func(utils.JobSnapshot) { removeUpload(inputPath) },
+	})
+}
+
+// runFrameExport 执行帧导出，在任务worker中运行
+func runFrameExport(ctx context.Context, job *utils.Job, export frameExport) (*models.FrameExportResponse, error) {
+	release, err := acquireEncode(ctx, job, utils.EncodeWeight("", 0, 0, export.options.Width))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// 图片先写入临时目录，打包后删除
+	frameDir, err := os.MkdirTemp("uploads", "frames")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(frameDir)
+	defer utils.RetainUploads(frameDir)()
+
+	ffmpegService := utils.NewFFmpegService(utils.DefaultRunner())
+	ffmpegService.SetProgressCallback(job.SetProgress)
+	frames, err := ffmpegService.ExtractFrames(ctx, export.inputPath, frameDir, export.startTime, export.duration, export.options)
+	switch {
+	case errors.Is(err, utils.ErrFFmpegTimeout):
+		return nil, fmt.Errorf("导出超时，请缩短时长或降低帧率后重试")
+	case errors.Is(err, utils.ErrFFmpegCancelled):
+		return nil, fmt.Errorf("导出已取消")
+	case err != nil:
+		return nil, fmt.Errorf("导出失败: %v", err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("未能从文件中导出任何帧")
+	}
+
+	manifest := models.FrameManifest{
+		Source:    export.source,
+		Format:    export.options.Format,
+		FPS:       export.options.FPS,
+		StartTime: export.startTime,
+		Duration:  export.duration,
+		Frames:    make([]models.FrameManifestItem, 0, len(frames)),
+	}
+	files := make([]string, 0, len(frames)+1)
+	for i, frame := range frames {
+		manifest.Frames = append(manifest.Frames, models.FrameManifestItem{
+			Index:     i,
+			File:      filepath.Base(frame.Path),
+			Timestamp: math.Round((export.startTime+frame.Timestamp)*1000) / 1000,
+			Delay:     frame.Delay,
+		})
+		files = append(files, frame.Path)
+	}
+
+	manifestPath := filepath.Join(frameDir, "manifest.json")
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(manifestPath, manifestData, 0644); err != nil {
+		return nil, fmt.Errorf("写入manifest失败: %v", err)
+	}
+	files = append(files, manifestPath)
+
+	zipFilename := utils.NewID() + "_frames.zip"
+	zipPath := filepath.Join("output", zipFilename)
+	if err := utils.NewCompressionService().CreateZipArchive(files, zipPath); err != nil {
+		os.Remove(zipPath)
+		return nil, err
+	}
+
+	zipSize, err := utils.GetFileSize(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+	}
+
+	utils.ClaimArtifacts(job.Owner(), zipFilename)
+
+	return &models.FrameExportResponse{
+		ZipURL:     config.BuildStaticURL(zipFilename),
+		ZipSize:    zipSize,
+		Source:     export.source,
+		Format:     export.options.Format,
+		FPS:        export.options.FPS,
+		FrameCount: len(frames),
+		Truncated:  len(frames) >= maxExportFrames,
+	}, nil
+}
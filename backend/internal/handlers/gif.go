@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 动画转视频的限制
+const (
+	maxVideoRepeat   = 50
+	maxVideoDuration = 600.0 // 包含重复播放在内的最大总时长(秒)
+)
+
+// gifToVideo 动画转视频任务参数
+type gifToVideo struct {
+	inputPath    string
+	originalSize int64
+	duration     float64 // 播放一遍的时长
+	options      utils.VideoEncodeOptions
+}
+
+// GifToVideo 将GIF等动画转换为H.264 MP4或VP9 WebM，便于在不支持GIF的平台分享
+func GifToVideo(c *gin.Context) {
+	if !requireFFmpeg(c) {
+		return
+	}
+
+	var req models.GifToVideoRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	opts := utils.VideoEncodeOptions{Format: utils.VideoMP4}
+	if req.Format != "" {
+		opts.Format = strings.ToLower(req.Format)
+	}
+	if opts.Format != utils.VideoMP4 && opts.Format != utils.VideoWebM {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "视频格式只能是mp4/webm",
+		})
+		return
+	}
+	opts.CRF = utils.DefaultCRF(opts.Format)
+	if req.CRF != nil {
+		opts.CRF = *req.CRF
+	}
+	if req.Repeat != nil {
+		opts.Repeat = *req.Repeat
+	}
+	if req.Width != nil {
+		opts.Width = *req.Width
+	}
+
+	// 参数验证
+	var message string
+	switch {
+	case opts.CRF < 0 || opts.CRF > utils.MaxCRF(opts.Format):
+		message = fmt.Sprintf("%s的CRF必须在0-%d之间", opts.Format, utils.MaxCRF(opts.Format))
+	case opts.Repeat < 0 || opts.Repeat > maxVideoRepeat:
+		message = fmt.Sprintf("重复次数必须在0-%d之间", maxVideoRepeat)
+	case req.Width != nil && (opts.Width < 16 || opts.Width > 3840):
+		message = "宽度必须在16-3840像素之间"
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: message,
+		})
+		return
+	}
+
+	// 多数FFmpeg版本的WebP解码器不支持动画，不接受WebP输入；APNG/AVIF在启动时检查本机FFmpeg的解码器
+	inputPath, format, ok := receiveAnimationUpload(c, utils.FormatGIF, utils.FormatAPNG, utils.FormatAVIF)
+	if !ok {
+		return
+	}
+	if !utils.FFmpegDecodes(format) {
+		os.Remove(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "服务器的FFmpeg不支持解码" + strings.ToUpper(format) + "，请上传GIF动画",
+		})
+		return
+	}
+
+	mediaInfo, ok := probeUploadedVideo(c, inputPath)
+	if !ok {
+		os.Remove(inputPath)
+		return
+	}
+	if mediaInfo.VideoCodec == "" || mediaInfo.Duration <= 0 {
+		os.Remove(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "无法确定动画时长，文件可能已损坏或不是动画",
+		})
+		return
+	}
+	if mediaInfo.Duration*float64(opts.Repeat+1) > maxVideoDuration {
+		os.Remove(inputPath)
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: fmt.Sprintf("视频总时长不能超过%.0f秒，请减少重复次数", maxVideoDuration),
+		})
+		return
+	}
+
+	originalSize, err := utils.GetFileSize(inputPath)
+	if err != nil {
+		os.Remove(inputPath)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "获取文件信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	conv := gifToVideo{
+		inputPath:    inputPath,
+		originalSize: originalSize,
+		duration:     mediaInfo.Duration,
+		options:      opts,
+	}
+	submitEncodeJob(c, encodeJob{
+		jobType: "gif-to-video",
+		owner:   middleware.GetSessionID(c),
+		label:   "转换",
+		inputs:  []string{inputPath},
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			return runGifToVideo(ctx, job, conv)
+		},
+		// 排队期间被取消的任务不会执行，上传文件在结束回调中删除
+		onFinish: func(utils.JobSnapshot) { os.Remove(inputPath) },
+	})
+}
+
+// runGifToVideo 执行动画转视频，在任务worker中运行
+func runGifToVideo(ctx context.Context, job *utils.Job, conv gifToVideo) (*models.GifToVideoResponse, error) {
+	release, err := acquireEncode(ctx, job, utils.EncodeWeight("", 0, 0, conv.options.Width))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	outputFilename := utils.GenerateUniqueFilename(conv.options.Format)
+	outputPath := filepath.Join("output", outputFilename)
+
+	ffmpegService := utils.NewFFmpegService(utils.DefaultRunner())
+	ffmpegService.SetProgressCallback(job.SetProgress)
+	err = ffmpegService.ConvertAnimationToVideo(ctx, conv.inputPath, outputPath, conv.duration, conv.options)
+	switch {
+	case errors.Is(err, utils.ErrFFmpegTimeout):
+		return nil, fmt.Errorf("转换超时，请减少重复次数或降低分辨率后重试")
+	case errors.Is(err, utils.ErrFFmpegCancelled):
+		return nil, fmt.Errorf("转换已取消")
+	case err != nil:
+		return nil, fmt.Errorf("视频转换失败: %v", err)
+	}
+
+	// 读取实际输出的尺寸和时长
+	info, err := ffmpegService.ProbeMedia(ctx, outputPath)
+	if err != nil || info.VideoCodec == "" {
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("生成的视频文件无效")
+	}
+
+	fileSize, err := utils.GetFileSize(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+	}
+
+	var sizeRatio float64
+	if conv.originalSize > 0 {
+		sizeRatio = math.Round(float64(fileSize)*10000/float64(conv.originalSize)) / 100
+	}
+
+	utils.ClaimArtifacts(job.Owner(), outputFilename)
+
+	return &models.GifToVideoResponse{
+		VideoURL:     config.BuildStaticURL(outputFilename),
+		Format:       conv.options.Format,
+		FileSize:     fileSize,
+		OriginalSize: conv.originalSize,
+		SizeRatio:    sizeRatio,
+		Width:        info.Width,
+		Height:       info.Height,
+		Duration:     math.Round(info.Duration*1000) / 1000,
+		Repeat:       conv.options.Repeat,
+	}, nil
+}
+
+// gifEdit GIF编辑任务参数
+type gifEdit struct {
+	inputPath    string
+	temporary    bool // 上传的文件在任务结束后删除，历史记录中的源文件保留
+	originalSize int64
+	options      utils.GifEditOptions
+}
+
+// EditGif 对上传的GIF或历史记录中的GIF进行缩放、裁剪、删除帧、调整速度、循环次数和倒放
+// 使用标准库编解码，不依赖ffmpeg
+func EditGif(c *gin.Context) {
+	var req models.GifEditRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	opts := utils.GifEditOptions{Reverse: req.Reverse, Loop: req.Loop}
+	if req.Width != nil {
+		opts.Width = *req.Width
+	}
+	if req.Height != nil {
+		opts.Height = *req.Height
+	}
+	if req.Speed != nil {
+		opts.Speed = *req.Speed
+	}
+
+	// 参数验证
+	var message string
+	switch {
+	case req.Width != nil && (opts.Width < 16 || opts.Width > 3840):
+		message = "宽度必须在16-3840像素之间"
+	case req.Height != nil && (opts.Height < 16 || opts.Height > 3840):
+		message = "高度必须在16-3840像素之间"
+	case req.Speed != nil && (opts.Speed < 0.25 || opts.Speed > 4):
+		message = "播放速度必须在0.25-4之间"
+	case req.Loop != nil && (*req.Loop < -1 || *req.Loop > 65535):
+		message = "循环次数必须在-1到65535之间"
+	}
+	if message == "" && req.Crop != "" {
+		opts.Crop = &models.CropRect{}
+		if err := json.Unmarshal([]byte(req.Crop), opts.Crop); err != nil {
+			message = "裁剪参数格式错误: " + err.Error()
+		} else if opts.Crop.X < 0 || opts.Crop.Y < 0 || opts.Crop.Width < 16 || opts.Crop.Height < 16 {
+			message = "裁剪起点不能为负数，宽高不能小于16像素"
+		}
+	}
+	if message == "" && req.Drop != "" {
+		var err error
+		if opts.Drop, err = utils.ParseFrameRanges(req.Drop); err != nil {
+			message = err.Error()
+		}
+	}
+	if message == "" && req.Delays != "" {
+		if err := json.Unmarshal([]byte(req.Delays), &opts.Delays); err != nil {
+			message = "帧延迟参数格式错误: " + err.Error()
+		}
+		for i, delay := range opts.Delays {
+			if delay < 20 || delay > 60000 {
+				message = fmt.Sprintf("第%d帧延迟必须在20-60000毫秒之间", i+1)
+				break
+			}
+		}
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: message,
+		})
+		return
+	}
+
+	inputPath, temporary, ok := receiveGifInput(c, req.Source)
+	if !ok {
+		return
+	}
+	edit := gifEdit{inputPath: inputPath, temporary: temporary, options: opts}
+
+	originalSize, err := utils.GetFileSize(edit.inputPath)
+	if err != nil {
+		edit.cleanup()
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "获取文件信息失败: " + err.Error(),
+		})
+		return
+	}
+	edit.originalSize = originalSize
+
+	submitEncodeJob(c, encodeJob{
+		jobType: "gif-edit",
+		owner:   middleware.GetSessionID(c),
+		label:   "编辑",
+		inputs:  []string{edit.inputPath},
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			return runGifEdit(ctx, job, edit)
+		},
+		onFinish: func(utils.JobSnapshot) { edit.cleanup() },
+	})
+}
+
+// receiveGifInput 获取待处理的GIF：source非空时使用历史记录中的文件，否则读取上传的gif字段
+// temporary表示文件为本次上传，处理完成后需要删除；失败时已写入错误响应，返回false
+func receiveGifInput(c *gin.Context, source string) (string, bool, bool) {
+	if source == "" {
+		inputPath, _, ok := receiveAnimationUpload(c, utils.FormatGIF)
+		return inputPath, true, ok
+	}
+
+	// 只能处理当前会话拥有的文件
+	name := filepath.Base(source)
+	inputPath := filepath.Join("output", name)
+	if _, err := os.Stat(inputPath); err != nil || !ownsArtifact(c, name) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "文件不存在",
+		})
+		return "", false, false
+	}
+	if !utils.IsGIFFile(inputPath) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "只能处理GIF格式的文件",
+		})
+		return "", false, false
+	}
+	return inputPath, false, true
+}
+
+// cleanup 删除上传的临时文件
+func (e gifEdit) cleanup() {
+	if e.temporary {
+		os.Remove(e.inputPath)
+	}
+}
+
+// runGifEdit 执行GIF编辑，在任务worker中运行
+func runGifEdit(ctx context.Context, job *utils.Job, edit gifEdit) (*models.GifEditResponse, error) {
+	release, err := acquireEncode(ctx, job, utils.EncodeWeight(utils.FormatGIF, 0, 0, edit.options.Width))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	outputFilename := utils.GenerateUniqueFilename("gif")
+	outputPath := filepath.Join("output", outputFilename)
+
+	result, err := utils.EditGif(ctx, edit.inputPath, outputPath, edit.options, job.SetProgress)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil, fmt.Errorf("编辑已取消")
+	case err != nil:
+		return nil, fmt.Errorf("GIF编辑失败: %v", err)
+	}
+
+	fileSize, err := utils.GetFileSize(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+	}
+
+	utils.ClaimArtifacts(job.Owner(), outputFilename)
+
+	return &models.GifEditResponse{
+		GifURL:       config.BuildStaticURL(outputFilename),
+		FileSize:     fileSize,
+		OriginalSize: edit.originalSize,
+		FrameCount:   result.FrameCount,
+		Width:        result.Width,
+		Height:       result.Height,
+		Duration:     math.Round(result.Duration*1000) / 1000,
+		Loop:         result.Loop,
+	}, nil
+}
+
+// gifOptimize GIF优化任务参数
+type gifOptimize struct {
+	inputPath string
+	temporary bool
+	lossy     int
+}
+
+// OptimizeGif 对上传的GIF或历史记录中的GIF做帧差分优化，结果另存为新文件
+func OptimizeGif(c *gin.Context) {
+	var req models.GifOptimizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	var lossy int
+	if req.Lossy != nil {
+		lossy = *req.Lossy
+	}
+	if lossy < 0 || lossy > utils.MaxGifLossy {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: fmt.Sprintf("有损优化强度必须在0-%d之间", utils.MaxGifLossy),
+		})
+		return
+	}
+
+	inputPath, temporary, ok := receiveGifInput(c, req.Source)
+	if !ok {
+		return
+	}
+	opt := gifOptimize{inputPath: inputPath, temporary: temporary, lossy: lossy}
+
+	submitEncodeJob(c, encodeJob{
+		jobType: "gif-optimize",
+		owner:   middleware.GetSessionID(c),
+		label:   "优化",
+		inputs:  []string{opt.inputPath},
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			return runGifOptimize(ctx, job, opt)
+		},
+		onFinish: func(utils.JobSnapshot) { opt.cleanup() },
+	})
+}
+
+// cleanup 删除上传的临时文件
+func (o gifOptimize) cleanup() {
+	if o.temporary {
+		os.Remove(o.inputPath)
+	}
+}
+
+// runGifOptimize 执行GIF优化，在任务worker中运行
+func runGifOptimize(ctx context.Context, job *utils.Job, opt gifOptimize) (*models.GifOptimizeResponse, error) {
+	release, err := acquireEncode(ctx, job, utils.EncodeWeight(utils.FormatGIF, 0, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	outputFilename := utils.GenerateUniqueFilename("gif")
+	outputPath := filepath.Join("output", outputFilename)
+
+	result, err := utils.OptimizeGif(ctx, opt.inputPath, outputPath, utils.GifOptimizeOptions{Lossy: opt.lossy}, job.SetProgress)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil, fmt.Errorf("优化已取消")
+	case err != nil:
+		return nil, fmt.Errorf("GIF优化失败: %v", err)
+	}
+
+	utils.ClaimArtifacts(job.Owner(), outputFilename)
+
+	return &models.GifOptimizeResponse{
+		GifURL:          config.BuildStaticURL(outputFilename),
+		GifOptimizeInfo: *gifOptimizeInfo(result, opt.lossy),
+	}, nil
+}
+
+// gifOptimizeInfo 生成优化前后对比信息
+func gifOptimizeInfo(result *utils.GifOptimizeResult, lossy int) *models.GifOptimizeInfo {
+	info := &models.GifOptimizeInfo{
+		OriginalSize:   result.OriginalSize,
+		OptimizedSize:  result.OptimizedSize,
+		OriginalFrames: result.OriginalFrames,
+		Frames:         result.Frames,
+		Lossy:          lossy,
+	}
+	if result.OriginalSize > 0 {
+		info.SavedPercent = math.Round(float64(result.OriginalSize-result.OptimizedSize)*10000/float64(result.OriginalSize)) / 100
+	}
+	return info
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"toGif-backend/internal/utils/utilstest"
+)
+
+// TestGifToVideoRejectsUndecodableInput 不接受WebP，本机FFmpeg缺少解码器的格式在探测前拒绝
+func TestGifToVideoRejectsUndecodableInput(t *testing.T) {
+	r := setupVideoTest(t, &utilstest.FakeRunner{Decoders: []string{"gif", "apng", "h264"}}, 4)
+	r.POST("/gif/to-video", GifToVideo)
+
+	padding := strings.Repeat("\x00", 200)
+	tests := map[string]string{
+		"clip.webp": "RIFF\x00\x00\x00\x00WEBPVP8X" + padding,
+		"clip.avif": "\x00\x00\x00\x1cftypavis" + padding,
+	}
+	for filename, content := range tests {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("gif", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/gif/to-video", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", filename, w.Code, w.Body.String())
+		}
+	}
+
+	entries, err := os.ReadDir("uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("rejected uploads left behind: %v", entries)
+	}
+}
@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/database"
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 历史记录分页大小
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+// conversionStatuses 转换记录的所有状态
+var conversionStatuses = []string{
+	database.ConversionQueued,
+	database.ConversionRunning,
+	database.ConversionSucceeded,
+	database.ConversionFailed,
+	database.ConversionCancelled,
+}
+
+// GetConversionHistory 获取当前会话的转换历史，支持分页和按格式、状态、时间过滤
+// 未连接数据库时退回扫描输出目录，只列出当前会话拥有的文件
+func GetConversionHistory(c *gin.Context) {
+	var req models.ConversionHistoryQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	query, err := parseHistoryQuery(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	query.Owner = middleware.GetSessionID(c)
+
+	var response *models.ConversionHistoryResponse
+	if database.Available() {
+		response, err = databaseConversionHistory(query)
+	} else {
+		response, err = fileConversionHistory(query)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "读取历史记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data:    response,
+	})
+}
+
+// parseHistoryQuery 校验历史查询参数并填充分页默认值
+func parseHistoryQuery(req models.ConversionHistoryQuery) (database.ConversionQuery, error) {
+	query := database.ConversionQuery{
+		Format:   strings.ToLower(req.Format),
+		Status:   strings.ToLower(req.Status),
+		Page:     max(req.Page, 1),
+		PageSize: req.PageSize,
+	}
+	if query.PageSize <= 0 {
+		query.PageSize = defaultHistoryPageSize
+	}
+	if query.PageSize > maxHistoryPageSize {
+		return query, errors.New("每页条数不能超过100")
+	}
+	if query.Format != "" && !utils.IsSupportedOutputFormat(query.Format) {
+		return query, errors.New("格式只能是gif/webp/apng/avif")
+	}
+	if query.Status != "" && !slices.Contains(conversionStatuses, query.Status) {
+		return query, errors.New("状态只能是" + strings.Join(conversionStatuses, "/"))
+	}
+
+	var err error
+	if query.Since, err = parseHistoryTime(req.Since); err != nil {
+		return query, errors.New("since时间格式错误")
+	}
+	if query.Until, err = parseHistoryTime(req.Until); err != nil {
+		return query, errors.New("until时间格式错误")
+	}
+	return query, nil
+}
+
+// parseHistoryTime 解析RFC3339或YYYY-MM-DD格式的时间，日期按服务器本地时区解析
+func parseHistoryTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// databaseConversionHistory 从数据库查询当前会话的转换记录
+func databaseConversionHistory(query database.ConversionQuery) (*models.ConversionHistoryResponse, error) {
+	conversions, total, err := database.ListConversions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.ConversionHistoryItem, 0, len(conversions))
+	for _, conversion := range conversions {
+		items = append(items, conversionHistoryItem(conversion))
+	}
+	return &models.ConversionHistoryResponse{
+		Items:    items,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
+
+// conversionHistoryItem 将转换记录转换为历史记录项，输出文件已被清理时不返回下载地址
+func conversionHistoryItem(conversion database.Conversion) models.ConversionHistoryItem {
+	item := models.ConversionHistoryItem{
+		ID:             conversion.ID,
+		Filename:       conversion.OutputFile,
+		Format:         conversion.Format,
+		FileSize:       conversion.OutputSize,
+		CreatedAt:      conversion.CreatedAt,
+		JobID:          conversion.JobID,
+		SourceFilename: conversion.SourceFilename,
+		InputSize:      conversion.InputSize,
+		Preset:         conversion.Preset,
+		StartTime:      conversion.StartTime,
+		Duration:       conversion.Duration,
+		VideoDuration:  conversion.VideoDuration,
+		Cached:         conversion.Cached,
+		Status:         conversion.Status,
+		Error:          conversion.Error,
+		FinishedAt:     conversion.FinishedAt,
+		ExpiresAt:      conversion.ExpiresAt,
+	}
+	if conversion.Params != "" {
+		var params models.ConversionParams
+		if json.Unmarshal([]byte(conversion.Params), &params) == nil {
+			item.Params = &params
+		}
+	}
+
+	if conversion.Status == database.ConversionSucceeded {
+		if _, err := os.Stat(filepath.Join("output", conversion.OutputFile)); err == nil {
+			item.GifURL = config.BuildStaticURL(conversion.OutputFile)
+			if conversion.ZipFile != "" {
+				if _, err := os.Stat(filepath.Join("output", conversion.ZipFile)); err == nil {
+					item.ZipURL = config.BuildStaticURL(conversion.ZipFile)
+					item.ZipSize = conversion.ZipSize
+				}
+			}
+		} else {
+			item.Expired = true
+		}
+	}
+	return item
+}
+
+// fileConversionHistory 扫描输出目录生成历史记录，只包含当前会话拥有的、仍存在的成功转换
+// 与数据库一致，只列出写入过转换记录的输出文件，GIF编辑、优化等其他任务的输出不算转换历史
+func fileConversionHistory(query database.ConversionQuery) (*models.ConversionHistoryResponse, error) {
+	outputDir := "output"
+
+	// 读取output目录中的所有动画文件
+	files, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	historyItems := []models.ConversionHistoryItem{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		// 只处理以标识命名的动画输出文件，跳过调色板、压缩包等派生文件
+		id := utils.FileID(file.Name())
+		format := utils.FormatFromExtension(file.Name())
+		if id == "" || format == "" || !utils.IsConversionOutput(file.Name()) || !utils.Artifacts().Owns(query.Owner, file.Name()) {
+			continue
+		}
+		if query.Format != "" && format != query.Format {
+			continue
+		}
+		if query.Status != "" && query.Status != database.ConversionSucceeded {
+			continue
+		}
+
+		// 获取文件信息
+		fileInfo, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if query.Since != nil && fileInfo.ModTime().Before(*query.Since) {
+			continue
+		}
+		if query.Until != nil && !fileInfo.ModTime().Before(*query.Until) {
+			continue
+		}
+
+		historyItems = append(historyItems, models.ConversionHistoryItem{
+			ID:        id,
+			Filename:  file.Name(),
+			GifURL:    config.BuildStaticURL(file.Name()),
+			Format:    format,
+			FileSize:  fileInfo.Size(),
+			CreatedAt: fileInfo.ModTime(),
+			Status:    database.ConversionSucceeded,
+		})
+	}
+
+	// 按创建时间倒序排列（最新的在前面）
+	sort.Slice(historyItems, func(i, j int) bool {
+		return historyItems[i].CreatedAt.After(historyItems[j].CreatedAt)
+	})
+
+	total := len(historyItems)
+	start := min((query.Page-1)*query.PageSize, total)
+	end := min(start+query.PageSize, total)
+	return &models.ConversionHistoryResponse{
+		Items:    historyItems[start:end],
+		Total:    int64(total),
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}, nil
+}
+
+// DeleteConversionHistory 删除当前会话的转换历史记录及其输出文件
+// 其他会话仍拥有的输出文件（命中缓存）只解除当前会话的归属，不删除
+func DeleteConversionHistory(c *gin.Context) {
+	// 获取要删除的记录ID
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "缺少文件ID参数",
+		})
+		return
+	}
+	if !utils.IsID(fileID) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "文件ID格式错误",
+		})
+		return
+	}
+
+	if !database.Available() {
+		deleteOutputFiles(c, middleware.GetSessionID(c), fileID)
+		return
+	}
+
+	conversion, err := database.GetConversion(middleware.GetSessionID(c), fileID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Code:    404,
+				Message: "记录不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "读取历史记录失败: " + err.Error(),
+		})
+		return
+	}
+	if conversion.Status == database.ConversionQueued || conversion.Status == database.ConversionRunning {
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Code:    409,
+			Message: "转换尚未结束，请先取消任务",
+		})
+		return
+	}
+
+	if conversion.OutputFile != "" {
+		if shared, err := database.CountConversionsByOutput(conversion.Owner, conversion.OutputFile); err == nil && shared <= 1 {
+			releaseArtifacts(conversion.Owner, conversion.OutputFile, conversion.OutputFile+".gz", conversion.ZipFile)
+		}
+	}
+	if err := database.DeleteConversion(conversion.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "删除记录失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "删除成功",
+	})
+}
+
+// deleteOutputFiles 按标识删除当前会话的输出文件，未连接数据库时使用
+func deleteOutputFiles(c *gin.Context, owner, fileID string) {
+	// 按支持的动画格式查找对应文件
+	var filename string
+	for _, ext := range utils.AnimationExtensions() {
+		if _, err := os.Stat(filepath.Join("output", fileID+ext)); err == nil {
+			filename = fileID + ext
+			break
+		}
+	}
+
+	// 检查文件是否存在、为转换输出且属于当前会话
+	if filename == "" || !utils.IsConversionOutput(filename) || !utils.Artifacts().Owns(owner, filename) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "文件不存在",
+		})
+		return
+	}
+
+	// 删除文件，连同同一ID的ZIP和gzip压缩文件
+	releaseArtifacts(owner, filename, filename+".gz", fileID+".zip")
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "删除成功",
+	})
+}
+
+// recordConversion 写入转换记录，写入失败只记录日志，不影响转换
+// 数据库不可用时只登记成功转换的输出文件，供扫描输出目录生成历史记录
+func recordConversion(conversion *database.Conversion) {
+	if !database.Available() {
+		if conversion.Status == database.ConversionSucceeded {
+			utils.MarkConversionOutput(conversion.OutputFile)
+		}
+		return
+	}
+	if err := database.CreateConversion(conversion); err != nil {
+		log.Printf("写入转换记录失败: %v", err)
+	}
+}
+
+// updateConversionRecord 更新转换记录，数据库不可用时只登记转换结果中的输出文件
+func updateConversionRecord(id string, updates map[string]interface{}) {
+	if !database.Available() {
+		if name, ok := updates["output_file"].(string); ok {
+			utils.MarkConversionOutput(name)
+		}
+		return
+	}
+	if err := database.UpdateConversion(id, updates); err != nil {
+		log.Printf("更新转换记录失败: %v", err)
+	}
+}
+
+// newConversionRecord 根据转换参数创建转换记录
+func newConversionRecord(conv gifConversion, status string) *database.Conversion {
+	params := models.ConversionParams{
+		Width:           conv.width,
+		TargetSizeBytes: conv.targetSize,
+		Optimize:        conv.optimize,
+		Lossy:           conv.lossy,
+		Transform:       conv.filters.Transform,
+		Captions:        len(conv.filters.Captions),
+		Subtitles:       conv.filters.Subtitles != "",
+		Watermark:       conv.filters.Watermark != nil,
+	}
+	if conv.format == utils.FormatGIF && conv.targetSize == 0 {
+		params.Preset = &conv.preset
+	}
+	paramsJSON, _ := json.Marshal(params)
+
+	return &database.Conversion{
+		ID:             conv.id,
+		Owner:          conv.owner,
+		SourceFilename: conv.sourceFilename,
+		InputSize:      conv.inputSize,
+		Format:         conv.format,
+		Preset:         conv.preset.Name,
+		Params:         string(paramsJSON),
+		StartTime:      conv.startTime,
+		Duration:       conv.duration,
+		VideoDuration:  conv.videoDuration,
+		Status:         status,
+	}
+}
+
+// conversionResultUpdates 转换任务结束时需要更新的字段
+func conversionResultUpdates(snapshot utils.JobSnapshot) map[string]interface{} {
+	switch snapshot.Status {
+	case utils.JobCancelled:
+		return map[string]interface{}{
+			"status":      database.ConversionCancelled,
+			"finished_at": snapshot.FinishedAt,
+		}
+	case utils.JobFailed:
+		return conversionFailedUpdates(snapshot.Error)
+	}
+
+	updates := map[string]interface{}{
+		"status":      database.ConversionSucceeded,
+		"finished_at": snapshot.FinishedAt,
+		"expires_at":  snapshot.FinishedAt.Add(utils.OutputRetention),
+	}
+	if response, ok := snapshot.Result.(*models.VideoToGifResponse); ok {
+		for key, value := range conversionOutputFields(response) {
+			updates[key] = value
+		}
+	}
+	return updates
+}
+
+// conversionFailedUpdates 转换失败时需要更新的字段
+func conversionFailedUpdates(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"status":      database.ConversionFailed,
+		"error":       truncateRunes(message, 1000),
+		"finished_at": time.Now(),
+	}
+}
+
+// conversionOutputFields 转换结果中的输出文件字段
+func conversionOutputFields(response *models.VideoToGifResponse) map[string]interface{} {
+	fields := map[string]interface{}{
+		"output_file": filepath.Base(response.GifURL),
+		"output_size": response.FileSize,
+	}
+	if response.ZipURL != nil && response.ZipSize != nil {
+		fields["zip_file"] = filepath.Base(*response.ZipURL)
+		fields["zip_size"] = *response.ZipSize
+	}
+	return fields
+}
+
+// uploadSourceFilename 输入视频的原始文件名，引用已上传视频时可能为空
+func uploadSourceFilename(c *gin.Context) string {
+	var filename string
+	if file, err := c.FormFile("video"); err == nil {
+		filename = strings.TrimSuffix(strings.TrimSuffix(file.Filename, ".gz"), ".GZ")
+	} else if id := c.PostForm("uploadId"); id != "" {
+		if upload, err := utils.GetTusStore().Get(id); err == nil {
+			filename = upload.Metadata["filename"]
+		}
+	}
+	if filename == "" {
+		return ""
+	}
+	return truncateRunes(filepath.Base(filename), 255)
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+	"toGif-backend/internal/utils/utilstest"
+)
+
+// TestFileHistoryListsOnlyConversions 未连接数据库时历史记录与数据库一致，只列出视频转换的输出，不包含GIF编辑等其他任务的输出
+func TestFileHistoryListsOnlyConversions(t *testing.T) {
+	var gifData bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 32, 32), palette.Plan9)
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(i * 7)
+	}
+	if err := gif.Encode(&gifData, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := setupVideoTest(t, &utilstest.FakeRunner{Outputs: map[string][]byte{"gif": gifData.Bytes()}}, 4)
+	r.GET("/video/history", GetConversionHistory)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("quality", "low")
+	part, err := writer.CreateFormFile("video", "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("fake video content"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/video/to-gif", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+
+	var response models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data, _ := json.Marshal(response.Data)
+	var info models.JobInfo
+	json.Unmarshal(data, &info)
+	job, ok := jobManager.Get(info.ID)
+	if !ok {
+		t.Fatalf("job %s not found", info.ID)
+	}
+	snapshot := waitForJob(t, job)
+	if snapshot.Status != utils.JobSucceeded {
+		t.Fatalf("job status = %s (%s), want succeeded", snapshot.Status, snapshot.Error)
+	}
+	converted := filepath.Base(snapshot.Result.(*models.VideoToGifResponse).GifURL)
+
+	// 同一会话的GIF编辑输出
+	edited := utils.GenerateUniqueFilename("gif")
+	if err := os.WriteFile(filepath.Join("output", edited), gifData.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	utils.ClaimArtifacts(snapshot.Owner, edited)
+
+	// 结束回调在任务状态更新之后执行，等待转换输出出现在历史记录中
+	var history models.ConversionHistoryResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest(http.MethodGet, "/video/history", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("history status = %d: %s", w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		data, _ := json.Marshal(response.Data)
+		history = models.ConversionHistoryResponse{}
+		json.Unmarshal(data, &history)
+		if len(history.Items) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(history.Items) != 1 || history.Items[0].Filename != converted {
+		t.Fatalf("history items = %+v, want only %s (gif edit output %s must not be listed)", history.Items, converted, edited)
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 图片序列限制
+const (
+	maxSequenceImages = 200
+	maxImageSize      = 10 * 1024 * 1024 // 10MB
+)
+
+var backgroundColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// imageSequence 图片序列转GIF任务参数
+type imageSequence struct {
+	dir     string // 上传图片所在的临时目录，任务结束后删除
+	images  []string
+	options utils.ImageSequenceOptions
+}
+
+// ImagesToGif 将多张图片合成为GIF
+func ImagesToGif(c *gin.Context) {
+	var req models.ImagesToGifRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["images"]) == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "请上传图片文件",
+		})
+		return
+	}
+	files := form.File["images"]
+
+	opts := utils.ImageSequenceOptions{
+		Fit:        utils.FitPad,
+		Background: "#FFFFFF",
+	}
+	if req.Fit != "" {
+		opts.Fit = req.Fit
+	}
+	if req.Background != "" {
+		opts.Background = req.Background
+	}
+	quality := utils.DefaultPreset
+	if req.Quality != "" {
+		quality = req.Quality
+	}
+	preset, presetFound := utils.LookupPreset(quality)
+	opts.Preset = preset
+	if req.Loop != nil {
+		opts.Loop = *req.Loop
+	}
+
+	// 参数验证
+	var message string
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+		if file.Size > maxImageSize {
+			message = fmt.Sprintf("图片%s不能超过10MB", file.Filename)
+		}
+	}
+	switch {
+	case message != "":
+	case len(files) < 2 || len(files) > maxSequenceImages:
+		message = fmt.Sprintf("图片数量必须在2-%d张之间", maxSequenceImages)
+	case totalSize > maxVideoUploadSize:
+		message = "图片总大小不能超过50MB"
+	case opts.Fit != utils.FitContain && opts.Fit != utils.FitCover && opts.Fit != utils.FitPad:
+		message = "缩放方式只能是fit/fill/pad"
+	case !presetFound:
+		message = "质量预设不存在: " + quality
+	case !backgroundColorPattern.MatchString(opts.Background):
+		message = "背景色格式应为#RRGGBB"
+	case opts.Loop < -1 || opts.Loop > 65535:
+		message = "循环次数必须在-1到65535之间"
+	case req.Width != nil && (*req.Width < 16 || *req.Width > 3840):
+		message = "宽度必须在16-3840像素之间"
+	case req.Height != nil && (*req.Height < 16 || *req.Height > 3840):
+		message = "高度必须在16-3840像素之间"
+	}
+	if message == "" {
+		opts.Delays, message = parseFrameDelays(req, len(files))
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: message,
+		})
+		return
+	}
+
+	// 保存到独立的临时目录，文件按上传顺序编号
+	dir, err := os.MkdirTemp("uploads", "images")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "创建临时目录失败: " + err.Error(),
+		})
+		return
+	}
+
+	images := make([]string, 0, len(files))
+	for i, file := range files {
+		imagePath := filepath.Join(dir, fmt.Sprintf("image_%03d", i+1))
+		if err := c.SaveUploadedFile(file, imagePath); err != nil {
+			os.RemoveAll(dir)
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Code:    500,
+				Message: "文件保存失败: " + err.Error(),
+			})
+			return
+		}
+		format := utils.ImageFormat(imagePath)
+		if format == "" {
+			os.RemoveAll(dir)
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: fmt.Sprintf("第%d张图片格式不支持，仅支持PNG/JPEG/WebP", i+1),
+			})
+			return
+		}
+		// 纯Go编码器无法解码WebP
+		if format == "webp" && utils.EncoderName() == utils.EncoderGo {
+			os.RemoveAll(dir)
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: fmt.Sprintf("第%d张图片为WebP格式，服务器未启用FFmpeg，仅支持PNG/JPEG", i+1),
+			})
+			return
+		}
+		images = append(images, imagePath)
+	}
+
+	// 画布默认使用第一张图片的比例，宽度不超过1080
+	if req.Width == nil || req.Height == nil {
+		imageWidth, imageHeight, err := utils.ImageSize(c.Request.Context(), images[0])
+		if err != nil || imageWidth <= 0 || imageHeight <= 0 {
+			os.RemoveAll(dir)
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "无法读取第1张图片的尺寸",
+			})
+			return
+		}
+		aspect := float64(imageHeight) / float64(imageWidth)
+		switch {
+		case req.Width != nil:
+			opts.Width = *req.Width
+			opts.Height = int(math.Round(float64(opts.Width) * aspect))
+		case req.Height != nil:
+			opts.Height = *req.Height
+			opts.Width = int(math.Round(float64(opts.Height) / aspect))
+		default:
+			opts.Width = min(imageWidth, 1080)
+			opts.Height = int(math.Round(float64(opts.Width) * aspect))
+		}
+		opts.Width = min(max(opts.Width, 16), 3840)
+		opts.Height = min(max(opts.Height, 16), 3840)
+	} else {
+		opts.Width, opts.Height = *req.Width, *req.Height
+	}
+
+	seq := imageSequence{dir: dir, images: images, options: opts}
+	submitEncodeJob(c, encodeJob{
+		jobType: "images-to-gif",
+		owner:   middleware.GetSessionID(c),
+		label:   "转换",
+		inputs:  []string{dir},
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			return runImagesToGif(ctx, job, seq)
+		},
+		// 排队期间被取消的任务不会执行，临时目录在结束回调中删除
+		onFinish: func(utils.JobSnapshot) { os.RemoveAll(dir) },
+	})
+}
+
+// parseFrameDelays 解析每帧时长，优先使用delays，否则按fps均分，返回秒数和错误提示
+func parseFrameDelays(req models.ImagesToGifRequest, count int) ([]float64, string) {
+	delays := make([]float64, count)
+
+	if req.Delays != "" {
+		var delayMs []float64
+		if err := json.Unmarshal([]byte(req.Delays), &delayMs); err != nil {
+			return nil, "帧时长参数格式错误: " + err.Error()
+		}
+		if len(delayMs) != count {
+			return nil, fmt.Sprintf("帧时长数量(%d)与图片数量(%d)不一致", len(delayMs), count)
+		}
+		for i, ms := range delayMs {
+			// GIF以1/100秒为单位记录延迟，浏览器会把小于20毫秒的延迟当作100毫秒
+			if ms < 20 || ms > 60000 {
+				return nil, fmt.Sprintf("第%d帧时长必须在20-60000毫秒之间", i+1)
+			}
+			delays[i] = ms / 1000
+		}
+		return delays, ""
+	}
+
+	fps := 10.0
+	if req.FPS != nil {
+		fps = *req.FPS
+	}
+	if fps < 0.1 || fps > 50 {
+		return nil, "帧率必须在0.1-50之间"
+	}
+	for i := range delays {
+		delays[i] = 1 / fps
+	}
+	return delays, ""
+}
+
+// runImagesToGif 执行图片序列转GIF，在任务worker中运行
+func runImagesToGif(ctx context.Context, job *utils.Job, seq imageSequence) (*models.ImagesToGifResponse, error) {
+	weight := utils.EncodeWeight(utils.FormatGIF, seq.options.Preset.FPS, seq.options.Preset.MaxColors, seq.options.Width)
+	release, err := acquireEncode(ctx, job, weight)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	outputFilename := utils.GenerateUniqueFilename("gif")
+	outputPath := filepath.Join("output", outputFilename)
+
+	encoder := utils.NewEncoder()
+	encoder.SetProgressCallback(job.SetProgress)
+	err = encoder.ConvertImagesToGif(ctx, seq.images, outputPath, seq.options)
+	switch {
+	case errors.Is(err, utils.ErrFFmpegTimeout):
+		return nil, fmt.Errorf("转换超时，请减少图片数量或降低分辨率后重试")
+	case errors.Is(err, utils.ErrFFmpegCancelled), errors.Is(err, context.Canceled):
+		return nil, fmt.Errorf("转换已取消")
+	case err != nil:
+		return nil, fmt.Errorf("图片合成失败: %v", err)
+	}
+
+	if !utils.IsValidAnimationFile(outputPath, utils.FormatGIF) {
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("生成的GIF文件格式错误")
+	}
+
+	fileSize, err := utils.GetFileSize(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
+	}
+
+	var duration float64
+	for _, delay := range seq.options.Delays {
+		duration += delay
+	}
+
+	utils.ClaimArtifacts(job.Owner(), outputFilename)
+
+	return &models.ImagesToGifResponse{
+		GifURL:     config.BuildStaticURL(outputFilename),
+		FileSize:   fileSize,
+		FrameCount: len(seq.images),
+		Width:      seq.options.Width,
+		Height:     seq.options.Height,
+		Duration:   math.Round(duration*1000) / 1000,
+		Loop:       seq.options.Loop,
+	}, nil
+}
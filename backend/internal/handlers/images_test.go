@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+	"toGif-backend/internal/utils/utilstest"
+)
+
+// TestImagesToGifQueuedCancelRemovesTempDir 排队期间被取消的任务不会执行，上传的临时目录仍需删除
+func TestImagesToGifQueuedCancelRemovesTempDir(t *testing.T) {
+	r := setupVideoTest(t, &utilstest.FakeRunner{}, 4)
+	r.POST("/images/to-gif", ImagesToGif)
+
+	// 占住唯一的worker，使后续任务停留在排队状态
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	if _, err := jobManager.Submit("test", "", func(ctx context.Context, job *utils.Job) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	var pngData bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.Black)
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("width", "32")
+	writer.WriteField("height", "32")
+	for _, name := range []string{"a.png", "b.png"} {
+		part, err := writer.CreateFormFile("images", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(pngData.Bytes())
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/images/to-gif", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data models.JobInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir("uploads")
+	if len(entries) == 0 {
+		t.Fatal("expected uploaded images in a temp dir while the job is queued")
+	}
+
+	if err := jobManager.Cancel(response.Data.ID); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = os.ReadDir("uploads")
+	if len(entries) != 0 {
+		t.Errorf("uploads not cleaned after cancel: %d entries left", len(entries))
+	}
+}
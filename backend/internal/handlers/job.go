@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var jobManager *utils.JobManager
+
+// InitJobManager 初始化异步任务管理器
+func InitJobManager(workers, queueSize int) {
+	// 已结束的任务保留12小时，与输出文件的清理周期一致
+	jobManager = utils.NewJobManager(workers, queueSize, utils.OutputRetention)
+	jobManager.Start()
+}
+
+// ListJobs 获取当前会话提交的任务列表
+func ListJobs(c *gin.Context) {
+	if jobManager == nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return
+	}
+
+	owner := middleware.GetSessionID(c)
+	snapshots := jobManager.List()
+	jobs := make([]models.JobInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.Owner == owner {
+			jobs = append(jobs, toJobInfo(snapshot))
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data:    jobs,
+	})
+}
+
+// GetJob 查询任务状态
+func GetJob(c *gin.Context) {
+	if jobManager == nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return
+	}
+
+	job, ok := getOwnJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data:    toJobInfo(job.Snapshot()),
+	})
+}
+
+// StreamJobEvents 通过Server-Sent Events推送任务进度
+// 事件类型: progress(进度更新) / done(任务结束，数据为完整任务信息)
+func StreamJobEvents(c *gin.Context) {
+	if jobManager == nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return
+	}
+
+	job, ok := getOwnJob(c)
+	if !ok {
+		return
+	}
+
+	updates, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	// 禁止nginx缓冲，保证事件及时送达
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 每15秒发送一次心跳，防止代理断开空闲连接
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	// 推送当前状态，任务结束后关闭连接
+	sendState := func() bool {
+		snapshot := job.Snapshot()
+		if snapshot.Finished() {
+			c.SSEvent("done", toJobInfo(snapshot))
+			return false
+		}
+		c.SSEvent("progress", toJobInfo(snapshot))
+		return true
+	}
+
+	// 连接建立后先推送一次当前状态
+	first := true
+	c.Stream(func(w io.Writer) bool {
+		if first {
+			first = false
+			return sendState()
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-updates:
+			return sendState()
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
+}
+
+// CancelJob 取消任务
+func CancelJob(c *gin.Context) {
+	if jobManager == nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return
+	}
+
+	job, ok := getOwnJob(c)
+	if !ok {
+		return
+	}
+
+	err := jobManager.Cancel(job.ID())
+	switch {
+	case errors.Is(err, utils.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return
+	case errors.Is(err, utils.ErrJobFinished):
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Code:    409,
+			Message: "任务已结束，无法取消",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "取消任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "任务已取消",
+	})
+}
+
+// getOwnJob 获取当前会话提交的任务，其他会话的任务按不存在处理；失败时已写入错误响应，返回false
+func getOwnJob(c *gin.Context) (*utils.Job, bool) {
+	job, ok := jobManager.Get(c.Param("id"))
+	if !ok || job.Owner() != middleware.GetSessionID(c) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "任务不存在",
+		})
+		return nil, false
+	}
+	return job, true
+}
+
+// toJobInfo 将任务快照转换为API响应结构
+func toJobInfo(snapshot utils.JobSnapshot) models.JobInfo {
+	info := models.JobInfo{
+		ID:        snapshot.ID,
+		Type:      snapshot.Type,
+		Status:    string(snapshot.Status),
+		Result:    snapshot.Result,
+		Error:     snapshot.Error,
+		Progress:  snapshot.Progress,
+		CreatedAt: snapshot.CreatedAt,
+	}
+	if !snapshot.StartedAt.IsZero() {
+		startedAt := snapshot.StartedAt
+		info.StartedAt = &startedAt
+	}
+	if !snapshot.FinishedAt.IsZero() {
+		finishedAt := snapshot.FinishedAt
+		info.FinishedAt = &finishedAt
+	}
+	return info
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamJobEventsIncludesProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	InitJobManager(1, 1)
+	t.Cleanup(jobManager.Stop)
+
+	progressSet := make(chan struct{})
+	release := make(chan struct{})
+	job, err := jobManager.Submit("test", "", func(ctx context.Context, job *utils.Job) (interface{}, error) {
+		job.SetProgress(models.ConversionProgress{Phase: "encode", Percent: 42, FPS: 30, ETA: 5})
+		close(progressSet)
+		<-release
+		return "ok", nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-progressSet
+
+	r := gin.New()
+	r.GET("/jobs/:id", GetJob)
+	r.GET("/jobs/:id/events", StreamJobEvents)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// 查询接口同样返回进度
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+job.ID(), nil))
+	var response struct {
+		Data models.JobInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Data.Progress == nil || response.Data.Progress.Phase != "encode" {
+		t.Fatalf("GET /jobs/:id progress = %+v, want phase encode", response.Data.Progress)
+	}
+
+	resp, err := http.Get(server.URL + "/jobs/" + job.ID() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := readSSEEvents(t, resp, 1)
+	if events[0].name != "progress" {
+		t.Fatalf("first event = %q, want progress", events[0].name)
+	}
+	var info models.JobInfo
+	if err := json.Unmarshal([]byte(events[0].data), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Progress == nil {
+		t.Fatal("progress event has no progress")
+	}
+	if info.Progress.Phase != "encode" || info.Progress.Percent != 42 || info.Progress.FPS != 30 || info.Progress.ETA != 5 {
+		t.Errorf("progress = %+v", *info.Progress)
+	}
+
+	close(release)
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readSSEEvents 读取n个事件，跳过心跳
+func readSSEEvents(t *testing.T, resp *http.Response, n int) []sseEvent {
+	t.Helper()
+	done := make(chan []sseEvent, 1)
+	go func() {
+		var events []sseEvent
+		var current sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				current.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				current.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			case line == "" && current.name != "":
+				if current.name != "ping" {
+					events = append(events, current)
+				}
+				current = sseEvent{}
+				if len(events) == n {
+					done <- events
+					return
+				}
+			}
+		}
+		done <- events
+	}()
+
+	select {
+	case events := <-done:
+		if len(events) < n {
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+		return nil
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPresets 获取可用的转换预设
+func ListPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data: models.PresetsResponse{
+			Presets: utils.Presets(),
+			Default: utils.DefaultPreset,
+		},
+	})
+}
@@ -4,7 +4,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
+
+	"toGif-backend/internal/config"
 
 	"github.com/gin-gonic/gin"
 	"github.com/skip2/go-qrcode"
@@ -27,6 +32,7 @@ type QRCodeResponse struct {
 }
 
 // GenerateQRCode 生成二维码
+// 文本是指向本服务输出文件的链接时，只能为当前会话拥有的文件生成二维码
 func GenerateQRCode(c *gin.Context) {
 	var req QRCodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -62,6 +68,14 @@ func GenerateQRCode(c *gin.Context) {
 		return
 	}
 
+	if !ownsQRCodeArtifact(c, req.Text) {
+		c.JSON(http.StatusNotFound, QRCodeResponse{
+			Success: false,
+			Message: "文件不存在",
+		})
+		return
+	}
+
 	// 转换容错级别
 	var recoveryLevel qrcode.RecoveryLevel
 	switch req.Level {
@@ -110,7 +124,7 @@ func GenerateQRCode(c *gin.Context) {
 	})
 }
 
-// GetQRCodeImage 直接返回二维码图片（GET请求方式）
+// GetQRCodeImage 直接返回二维码图片（GET请求方式），与GenerateQRCode一样检查输出文件链接的归属
 func GetQRCodeImage(c *gin.Context) {
 	text := c.Query("text")
 	if text == "" {
@@ -119,6 +133,12 @@ func GetQRCodeImage(c *gin.Context) {
 		})
 		return
 	}
+	if !ownsQRCodeArtifact(c, text) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "文件不存在",
+		})
+		return
+	}
 
 	// 获取可选参数
 	sizeStr := c.DefaultQuery("size", "256")
@@ -168,3 +188,54 @@ func GetQRCodeImage(c *gin.Context) {
 	// 返回图片数据
 	c.Data(http.StatusOK, "image/png", pngData)
 }
+
+// qrCodeArtifactPrefixes 输出文件链接的路径前缀：静态文件和附件下载
+var qrCodeArtifactPrefixes = []string{"/static/", "/api/download/"}
+
+// ownsQRCodeArtifact 文本不是指向本服务输出文件的链接，或当前会话拥有该文件时返回true
+func ownsQRCodeArtifact(c *gin.Context, text string) bool {
+	name, ok := qrCodeArtifactName(c, text)
+	return !ok || ownsArtifact(c, name)
+}
+
+// qrCodeArtifactName 解析指向本服务输出文件的链接，返回相对输出目录的文件名
+// 只识别相对链接以及主机与本服务一致的绝对链接，其他文本按普通内容处理
+func qrCodeArtifactName(c *gin.Context, text string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(text))
+	if err != nil || u.Opaque != "" {
+		return "", false
+	}
+	if u.Host == "" && u.Scheme != "" {
+		return "", false
+	}
+	if u.Host != "" && !isServiceHost(c, u.Host) {
+		return "", false
+	}
+
+	prefixes := qrCodeArtifactPrefixes
+	if static, err := url.Parse(config.GetStaticURL()); err == nil && static.Path != "" {
+		prefixes = append([]string{strings.TrimSuffix(static.Path, "/") + "/"}, prefixes...)
+	}
+	for _, prefix := range prefixes {
+		if rest, ok := strings.CutPrefix(path.Clean("/"+u.Path), prefix); ok && rest != "" {
+			return rest, true
+		}
+	}
+	return "", false
+}
+
+// isServiceHost 判断主机是否为本服务：请求的Host、反向代理转发的Host或配置的BASE_URL/STATIC_URL
+func isServiceHost(c *gin.Context, host string) bool {
+	hosts := []string{c.Request.Host, c.GetHeader("X-Forwarded-Host")}
+	for _, configured := range []string{config.GetBaseURL(), config.GetStaticURL()} {
+		if u, err := url.Parse(configured); err == nil {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	for _, h := range hosts {
+		if h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSessionRouter 创建带会话中间件的路由，返回路由和一个已签发会话的cookie及其会话ID
+func newSessionRouter(t *testing.T) (*gin.Engine, *http.Cookie, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Session("test", "auto"))
+	var owner string
+	r.GET("/session", func(c *gin.Context) { owner = middleware.GetSessionID(c) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/session", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one session cookie, got %v", cookies)
+	}
+	return r, cookies[0], owner
+}
+
+// TestQRCodeScopedToSessionArtifacts 输出文件链接只能由拥有该文件的会话生成二维码，普通文本不受限制
+func TestQRCodeScopedToSessionArtifacts(t *testing.T) {
+	r, cookie, owner := newSessionRouter(t)
+	r.POST("/qrcode/generate", GenerateQRCode)
+	r.GET("/qrcode/image", GetQRCodeImage)
+	utils.ClaimArtifacts(owner, "owned.gif")
+	utils.ClaimArtifacts("other-session", "other.gif")
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello world", http.StatusOK},
+		{"https://example.com/static/other.gif", http.StatusOK},
+		{"/static/owned.gif", http.StatusOK},
+		{"http://example.test/static/owned.gif", http.StatusOK},
+		{"/static/other.gif", http.StatusNotFound},
+		{"http://example.test/api/download/other.gif", http.StatusNotFound},
+		{"http://EXAMPLE.test/static/../static/other.gif", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(QRCodeRequest{Text: tt.text})
+		req := httptest.NewRequest(http.MethodPost, "http://example.test/qrcode/generate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("POST %q: status = %d, want %d", tt.text, w.Code, tt.want)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "http://example.test/qrcode/image?text="+url.QueryEscape(tt.text), nil)
+		req.AddCookie(cookie)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET %q: status = %d, want %d", tt.text, w.Code, tt.want)
+		}
+	}
+}
+
+// TestDownloadFileQuotesFilename 附件文件名按RFC 2231编码
+func TestDownloadFileQuotesFilename(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := config.GetStaticDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	r, cookie, owner := newSessionRouter(t)
+	r.GET("/download/:filename", DownloadFile)
+
+	tests := map[string]string{
+		"a b;c.gif": `attachment; filename="a b;c.gif"`,
+		"动图.gif":    `attachment; filename*=utf-8''%E5%8A%A8%E5%9B%BE.gif`,
+	}
+	for name, want := range tests {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("gif"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		utils.ClaimArtifacts(owner, name)
+
+		req := httptest.NewRequest(http.MethodGet, "/download/"+url.PathEscape(name), nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200: %s", name, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Disposition"); got != want {
+			t.Errorf("%s: Content-Disposition = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSession 返回当前匿名会话，不使用cookie的客户端保存令牌后通过Authorization: Bearer携带
+func GetSession(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data: models.SessionInfo{
+			ID:    middleware.GetSessionID(c),
+			Token: middleware.GetSessionToken(c),
+		},
+	})
+}
+
+// ownsArtifact 当前会话是否拥有该文件
+func ownsArtifact(c *gin.Context, name string) bool {
+	return utils.Artifacts().Owns(middleware.GetSessionID(c), name)
+}
+
+// requireArtifact 检查当前会话是否拥有输出目录中的文件，不拥有时按文件不存在返回404，不暴露其他会话的文件
+func requireArtifact(c *gin.Context, name string) bool {
+	if ownsArtifact(c, name) {
+		return true
+	}
+	c.JSON(http.StatusNotFound, models.APIResponse{
+		Code:    404,
+		Message: "文件不存在",
+	})
+	return false
+}
+
+// claimArtifacts 将生成的文件登记到当前会话名下
+func claimArtifacts(c *gin.Context, names ...string) {
+	utils.ClaimArtifacts(middleware.GetSessionID(c), names...)
+}
+
+// releaseArtifacts 解除当前会话对文件的归属，没有其他会话拥有的文件从输出目录删除
+func releaseArtifacts(owner string, names ...string) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		remaining, err := utils.Artifacts().Release(owner, name)
+		if err != nil || remaining > 0 {
+			continue
+		}
+		os.Remove(filepath.Join("output", name))
+		utils.ForgetConversionOutput(name)
+	}
+}
@@ -19,7 +19,15 @@ type SystemInfo struct {
 	UploadsSize int64   `json:"uploadsSize"`
 	OutputSize  int64   `json:"outputSize"`
 	Goroutines  int     `json:"goroutines"`
-	Timestamp   string  `json:"timestamp"`
+	// 编码调度状态（按权重单位计算）
+	EncodeCapacity int `json:"encodeCapacity"`
+	EncodeUsed     int `json:"encodeUsed"`
+	EncodeQueued   int `json:"encodeQueued"`
+	// 编码能力：当前GIF编码器(ffmpeg/go)、是否安装了ffmpeg以及文字字幕字体是否可用
+	Encoder     string `json:"encoder"`
+	FFmpeg      bool   `json:"ffmpeg"`
+	CaptionFont bool   `json:"captionFont"`
+	Timestamp   string `json:"timestamp"`
 }
 
 var cleanupService *utils.CleanupService
@@ -40,14 +48,22 @@ func HealthCheck(c *gin.Context) {
 		uploadsSize, outputSize, _ = cleanupService.GetDiskUsage()
 	}
 
+	schedulerStats := utils.GetEncodeScheduler().Stats()
+
 	systemInfo := SystemInfo{
-		CPUUsage:    float64(runtime.NumGoroutine()), // 简化的CPU使用率
-		MemoryUsage: int64(m.Alloc),
-		MemoryTotal: int64(m.Sys),
-		UploadsSize: uploadsSize,
-		OutputSize:  outputSize,
-		Goroutines:  runtime.NumGoroutine(),
-		Timestamp:   time.Now().Format(time.RFC3339),
+		CPUUsage:       float64(runtime.NumGoroutine()), // 简化的CPU使用率
+		MemoryUsage:    int64(m.Alloc),
+		MemoryTotal:    int64(m.Sys),
+		UploadsSize:    uploadsSize,
+		OutputSize:     outputSize,
+		Goroutines:     runtime.NumGoroutine(),
+		EncodeCapacity: schedulerStats.Capacity,
+		EncodeUsed:     schedulerStats.Used,
+		EncodeQueued:   schedulerStats.Queued + schedulerStats.Reserved,
+		Encoder:        utils.EncoderName(),
+		FFmpeg:         utils.FFmpegAvailable(),
+		CaptionFont:    utils.CheckCaptionFont() == nil,
+		Timestamp:      time.Now().Format(time.RFC3339),
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
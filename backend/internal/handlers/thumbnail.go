@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 缩略图输出目录，位于output下以便通过静态文件服务访问，历史记录只读取output顶层不会包含缩略图
+const thumbnailsDir = "thumbnails"
+
+// VideoThumbnails 提取视频缩略图和雪碧图，供前端渲染可拖动的时间轴
+func VideoThumbnails(c *gin.Context) {
+	var req models.ThumbnailsRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "参数解析失败: " + err.Error(),
+		})
+		return
+	}
+
+	opts := utils.ThumbnailOptions{
+		Count:          10,
+		Width:          160,
+		Format:         utils.ThumbnailJPEG,
+		Scene:          req.Mode == "scene",
+		SceneThreshold: 0.3,
+		Columns:        10,
+	}
+	if req.Count != nil {
+		opts.Count = *req.Count
+	}
+	if req.Width != nil {
+		opts.Width = *req.Width
+	}
+	if req.Format != "" {
+		opts.Format = strings.ToLower(req.Format)
+	}
+	if req.SceneThreshold != nil {
+		opts.SceneThreshold = *req.SceneThreshold
+	}
+	if req.Columns != nil {
+		opts.Columns = *req.Columns
+	}
+
+	// 参数验证
+	var message string
+	switch {
+	case req.Mode != "" && req.Mode != "interval" && req.Mode != "scene":
+		message = "提取模式只能是interval/scene"
+	case opts.Count < 1 || opts.Count > 100:
+		message = "缩略图数量必须在1-100之间"
+	case opts.Width < 32 || opts.Width > 640:
+		message = "缩略图宽度必须在32-640像素之间"
+	case opts.Format != utils.ThumbnailJPEG && opts.Format != utils.ThumbnailWebP:
+		message = "缩略图格式只能是jpeg/webp"
+	case opts.SceneThreshold <= 0 || opts.SceneThreshold >= 1:
+		message = "场景切换阈值必须在0-1之间"
+	case opts.Columns < 1 || opts.Columns > 100:
+		message = "雪碧图列数必须在1-100之间"
+	}
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: message,
+		})
+		return
+	}
+
+	inputPath, ok := receiveVideoUpload(c)
+	if !ok {
+		return
+	}
+
+	mediaInfo, ok := probeUploadedVideo(c, inputPath)
+	if !ok {
+		return
+	}
+	if mediaInfo.VideoCodec == "" || mediaInfo.Duration <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "无法确定视频时长，文件可能已损坏",
+		})
+		return
+	}
+
+	// 与转换任务共用编码资源
+	scheduler := utils.GetEncodeScheduler()
+	release, err := scheduler.Acquire(c.Request.Context(), 1, nil)
+	if errors.Is(err, utils.ErrEncodeQueueFull) {
+		respondBusy(c, scheduler.RetryAfter())
+		return
+	}
+	if err != nil {
+		// 客户端已断开
+		return
+	}
+	defer release()
+
+	// 目录名使用随机标识，与其他输出文件一样无法被猜测
+	outputDir := filepath.Join("output", thumbnailsDir, utils.NewID())
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "创建缩略图目录失败: " + err.Error(),
+		})
+		return
+	}
+
+	set, err := utils.NewFFmpegService(utils.DefaultRunner()).ExtractThumbnails(c.Request.Context(), inputPath, outputDir, mediaInfo.Duration, opts)
+	if err != nil {
+		os.RemoveAll(outputDir)
+		switch {
+		case errors.Is(err, utils.ErrFFmpegCancelled):
+			return
+		case errors.Is(err, utils.ErrFFmpegTimeout):
+			c.JSON(http.StatusGatewayTimeout, models.APIResponse{
+				Code:    504,
+				Message: "提取缩略图超时",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Code:    500,
+				Message: "提取缩略图失败: " + err.Error(),
+			})
+		}
+		return
+	}
+
+	// 静态文件URL使用相对output目录的路径，文件按同样的路径登记到当前会话名下
+	urlPrefix := path.Join(thumbnailsDir, filepath.Base(outputDir))
+	names := make([]string, 0, len(set.Thumbnails)+1)
+	for _, file := range set.Files() {
+		names = append(names, path.Join(urlPrefix, filepath.Base(file)))
+	}
+	claimArtifacts(c, names...)
+	response := models.ThumbnailsResponse{
+		Mode:          "interval",
+		Format:        opts.Format,
+		VideoDuration: mediaInfo.Duration,
+		Width:         set.Width,
+		Height:        set.Height,
+		Columns:       set.Columns,
+		Rows:          set.Rows,
+		SpriteURL:     config.BuildStaticURL(path.Join(urlPrefix, filepath.Base(set.SpritePath))),
+		Thumbnails:    make([]models.ThumbnailItem, 0, len(set.Thumbnails)),
+		VideoHash:     utils.UploadHash(inputPath),
+	}
+	if opts.Scene {
+		response.Mode = "scene"
+	}
+	for i, thumb := range set.Thumbnails {
+		response.Thumbnails = append(response.Thumbnails, models.ThumbnailItem{
+			Index:     i,
+			Timestamp: thumb.Timestamp,
+			URL:       config.BuildStaticURL(path.Join(urlPrefix, filepath.Base(thumb.Path))),
+			X:         i % set.Columns * set.Width,
+			Y:         i / set.Columns * set.Height,
+		})
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data:    response,
+	})
+}
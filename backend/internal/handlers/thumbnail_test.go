@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/utils"
+	"toGif-backend/internal/utils/utilstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestVideoThumbnailsClaimedBySession 缩略图写入随机标识的目录，所有文件登记到请求会话名下
+func TestVideoThumbnailsClaimedBySession(t *testing.T) {
+	r := setupVideoTest(t, &utilstest.FakeRunner{}, 4)
+	var owner string
+	r.POST("/video/thumbnails", func(c *gin.Context) {
+		owner = middleware.GetSessionID(c)
+	}, VideoThumbnails)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("count", "3")
+	part, err := writer.CreateFormFile("video", "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("fake video content"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/video/thumbnails", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	dirs, err := os.ReadDir(filepath.Join("output", thumbnailsDir))
+	if err != nil || len(dirs) != 1 {
+		t.Fatalf("expected one thumbnail directory, got %v (%v)", dirs, err)
+	}
+	id := dirs[0].Name()
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(id) {
+		t.Errorf("thumbnail directory %q is not a generated ID", id)
+	}
+
+	files, err := os.ReadDir(filepath.Join("output", thumbnailsDir, id))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no thumbnail files written: %v", err)
+	}
+	for _, file := range files {
+		name := path.Join(thumbnailsDir, id, file.Name())
+		if !utils.Artifacts().Owns(owner, name) {
+			t.Errorf("%s not claimed by session", name)
+		}
+		if utils.Artifacts().Owns("other-session", name) {
+			t.Errorf("%s claimed by another session", name)
+		}
+	}
+}
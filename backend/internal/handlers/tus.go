@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"toGif-backend/internal/config"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TusOptions 返回服务端支持的tus协议版本、扩展和最大上传大小
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", utils.TusVersion)
+	c.Header("Tus-Version", utils.TusVersion)
+	c.Header("Tus-Extension", utils.TusExtensions)
+	if maxSize := utils.GetTusStore().MaxSize(); maxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload 创建可续传上传，Upload-Length为文件总大小，Upload-Metadata中需包含filename
+func CreateTusUpload(c *gin.Context) {
+	if !requireTusResumable(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "Upload-Length无效",
+		})
+		return
+	}
+
+	metadata, err := utils.ParseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !isVideoFile(metadata["filename"]) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "不支持的文件格式，请上传视频文件",
+		})
+		return
+	}
+
+	upload, err := utils.GetTusStore().Create(length, metadata)
+	if err != nil {
+		if errors.Is(err, utils.ErrTusTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, models.APIResponse{
+				Code:    413,
+				Message: "文件大小不能超过" + strconv.FormatInt(utils.GetTusStore().MaxSize()/1024/1024, 10) + "MB",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "创建上传失败: " + err.Error(),
+		})
+		return
+	}
+
+	claimArtifacts(c, upload.ID)
+	c.Header("Location", config.GetBaseURL()+"/api/uploads/tus/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// GetTusUploadOffset 查询已上传的字节数，客户端断线后据此续传
+func GetTusUploadOffset(c *gin.Context) {
+	if !requireTusResumable(c) {
+		return
+	}
+
+	upload, err := utils.GetTusStore().Get(c.Param("id"))
+	if err != nil || !ownsArtifact(c, upload.ID) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	setTusUploadHeaders(c, upload)
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload 从Upload-Offset处追加数据，请求体类型必须为application/offset+octet-stream
+func PatchTusUpload(c *gin.Context) {
+	if !requireTusResumable(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, models.APIResponse{
+			Code:    415,
+			Message: "Content-Type必须为application/offset+octet-stream",
+		})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "Upload-Offset无效",
+		})
+		return
+	}
+
+	id := c.Param("id")
+	if !ownsArtifact(c, id) {
+		respondTusNotFound(c)
+		return
+	}
+
+	upload, err := utils.GetTusStore().Append(id, offset, c.Request.Body)
+	switch {
+	case errors.Is(err, utils.ErrTusNotFound):
+		respondTusNotFound(c)
+	case errors.Is(err, utils.ErrTusOffset), errors.Is(err, utils.ErrTusLocked), errors.Is(err, utils.ErrTusFinished):
+		c.JSON(http.StatusConflict, models.APIResponse{
+			Code:    409,
+			Message: err.Error(),
+		})
+	case upload == nil:
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "保存上传数据失败: " + err.Error(),
+		})
+	default:
+		// 写满后按内容保存的文件同样归当前会话所有，之后可通过videoHash引用
+		if upload.Finished() {
+			if inputPath, ok := utils.FindUpload(upload.Hash); ok {
+				claimArtifacts(c, filepath.Base(inputPath))
+			}
+		}
+		// 请求体读取中断时已收到的数据仍然有效，客户端通过HEAD获取偏移量后续传
+		setTusUploadHeaders(c, upload)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// DeleteTusUpload 终止上传并删除已写入的数据
+func DeleteTusUpload(c *gin.Context) {
+	if !requireTusResumable(c) {
+		return
+	}
+
+	id := c.Param("id")
+	if !ownsArtifact(c, id) {
+		respondTusNotFound(c)
+		return
+	}
+
+	if err := utils.GetTusStore().Terminate(id); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, utils.ErrTusLocked) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.APIResponse{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondTusNotFound 上传不存在或不属于当前会话时返回404
+func respondTusNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, models.APIResponse{
+		Code:    404,
+		Message: utils.ErrTusNotFound.Error(),
+	})
+}
+
+// requireTusResumable 检查客户端使用的协议版本，不支持时返回412
+func requireTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", utils.TusVersion)
+	if c.GetHeader("Tus-Resumable") != utils.TusVersion {
+		c.Header("Tus-Version", utils.TusVersion)
+		c.JSON(http.StatusPreconditionFailed, models.APIResponse{
+			Code:    412,
+			Message: "不支持的tus协议版本",
+		})
+		return false
+	}
+	return true
+}
+
+// setTusUploadHeaders 写入上传偏移量和过期时间，上传完成后附带内容摘要，可作为videoHash使用
+func setTusUploadHeaders(c *gin.Context, upload *utils.TusUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Finished() {
+		c.Header("Upload-Hash", upload.Hash)
+	}
+}
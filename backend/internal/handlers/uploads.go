@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadVideo 上传视频，按内容的SHA-256保存，返回的摘要可在转换、探测、缩略图和帧导出接口中通过videoHash引用
+func UploadVideo(c *gin.Context) {
+	inputPath, hash, existed, ok := saveVideoUpload(c)
+	if !ok {
+		return
+	}
+
+	size, err := utils.GetFileSize(inputPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "获取文件信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	message := "上传成功"
+	if existed {
+		message = "文件已存在"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: message,
+		Data: models.UploadResponse{
+			Hash:    hash,
+			Size:    size,
+			Existed: existed,
+		},
+	})
+}
+
+// GetUpload 按SHA-256查询视频是否已上传，客户端可先在本地计算摘要，已存在时跳过上传
+// 只能查询当前会话上传过的视频，其他会话上传的相同视频需要重新上传一次以证明持有该文件
+func GetUpload(c *gin.Context) {
+	inputPath, ok := utils.FindUpload(c.Param("hash"))
+	if !ok || !ownsArtifact(c, filepath.Base(inputPath)) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Code:    404,
+			Message: "文件不存在或已过期",
+		})
+		return
+	}
+
+	size, err := utils.GetFileSize(inputPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "获取文件信息失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data: models.UploadResponse{
+			Hash:    utils.UploadHash(inputPath),
+			Size:    size,
+			Existed: true,
+		},
+	})
+}
@@ -1,19 +1,49 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"toGif-backend/internal/config"
+	"toGif-backend/internal/database"
+	"toGif-backend/internal/middleware"
 	"toGif-backend/internal/models"
 	"toGif-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// ProbeVideo 读取上传视频的媒体信息，供前端展示并预填宽度和时间范围
+func ProbeVideo(c *gin.Context) {
+	inputPath, ok := receiveVideoUpload(c)
+	if !ok {
+		return
+	}
+	info, ok := probeUploadedVideo(c, inputPath)
+	if !ok {
+		return
+	}
+	// 上传的视频保留到定时清理，后续转换可通过videoHash引用，无需重复上传
+	info.VideoHash = utils.UploadHash(inputPath)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Code:    200,
+		Message: "获取成功",
+		Data:    info,
+	})
+}
+
 // VideoToGif 视频转GIF处理器
 func VideoToGif(c *gin.Context) {
 	// 解析请求参数
@@ -26,6 +56,438 @@ func VideoToGif(c *gin.Context) {
 		return
 	}
 
+	// 保存上传的视频
+	inputPath, ok := receiveVideoUpload(c)
+	if !ok {
+		return
+	}
+
+	// 获取视频信息，无法确定时长的文件无法计算转换区间
+	mediaInfo, ok := probeUploadedVideo(c, inputPath)
+	if !ok {
+		return
+	}
+	if mediaInfo.VideoCodec == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "文件中没有视频流",
+		})
+		return
+	}
+	if mediaInfo.Duration <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "无法确定视频时长，文件可能已损坏",
+		})
+		return
+	}
+	videoDuration := mediaInfo.Duration
+
+	// 设置默认参数
+	startTime := float64(0)
+	if req.StartTime != nil {
+		startTime = *req.StartTime
+	}
+
+	// 默认转换整个视频时长
+	duration := videoDuration
+	if req.Duration != nil && *req.Duration > 0 {
+		duration = *req.Duration
+	}
+
+	// 质量预设：优先使用请求中内联的自定义预设，否则按名称查找
+	var preset models.Preset
+	if req.Preset != "" {
+		if err := json.Unmarshal([]byte(req.Preset), &preset); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "自定义预设格式错误: " + err.Error(),
+			})
+			return
+		}
+		if err := utils.ValidatePreset(&preset); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "自定义预设无效: " + err.Error(),
+			})
+			return
+		}
+	} else {
+		quality := utils.DefaultPreset
+		if req.Quality != "" {
+			quality = req.Quality
+		}
+		var found bool
+		preset, found = utils.LookupPreset(quality)
+		if !found {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "质量预设不存在: " + quality,
+			})
+			return
+		}
+	}
+
+	// 未指定宽度时使用预设的默认宽度
+	width := preset.Width
+	if req.Width != nil {
+		width = *req.Width
+	}
+
+	outputFormat := utils.FormatGIF
+	if req.OutputFormat != "" {
+		outputFormat = strings.ToLower(req.OutputFormat)
+	}
+
+	// 参数验证
+	if startTime < 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "开始时间不能小于0",
+		})
+		return
+	}
+
+	// 检查开始时间不能超过视频总时长
+	if startTime >= videoDuration {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: fmt.Sprintf("开始时间不能超过视频总时长(%.2f秒)", videoDuration),
+		})
+		return
+	}
+
+	// 调整持续时间，确保不超过视频剩余时长
+	remainingDuration := videoDuration - startTime
+	if duration > remainingDuration {
+		duration = remainingDuration
+	}
+
+	// 最终验证duration是否有效
+	if duration <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "计算后的持续时间无效",
+		})
+		return
+	}
+
+	if width < 100 || width > 3840 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "宽度必须在100-3840像素之间",
+		})
+		return
+	}
+
+	if !utils.IsSupportedOutputFormat(outputFormat) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "不支持的输出格式，可选值: gif/webp/apng/avif",
+		})
+		return
+	}
+
+	// 解析画面变换参数
+	var transform *models.VideoTransform
+	if req.Transform != "" {
+		transform = &models.VideoTransform{}
+		if err := json.Unmarshal([]byte(req.Transform), transform); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "画面变换参数格式错误: " + err.Error(),
+			})
+			return
+		}
+		if err := utils.ValidateTransform(transform, duration, mediaInfo.Width, mediaInfo.Height); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	// 目标大小模式通过调整调色板参数实现，仅支持GIF
+	var targetSize int64
+	if req.TargetSizeBytes != nil {
+		targetSize = *req.TargetSizeBytes
+		if outputFormat != utils.FormatGIF {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "目标大小模式仅支持GIF格式",
+			})
+			return
+		}
+		if targetSize < 10*1024 || targetSize > maxVideoUploadSize {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "目标大小必须在10KB-50MB之间",
+			})
+			return
+		}
+	}
+
+	// 帧差分优化仅适用于GIF，默认开启
+	optimize := outputFormat == utils.FormatGIF
+	if req.Optimize != nil {
+		optimize = optimize && *req.Optimize
+	}
+	var lossy int
+	if req.Lossy != nil {
+		lossy = *req.Lossy
+		if lossy < 0 || lossy > utils.MaxGifLossy {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: fmt.Sprintf("有损优化强度必须在0-%d之间", utils.MaxGifLossy),
+			})
+			return
+		}
+	}
+
+	// 解析文字字幕
+	var captions []models.Caption
+	if req.Captions != "" {
+		if err := json.Unmarshal([]byte(req.Captions), &captions); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "字幕参数格式错误: " + err.Error(),
+			})
+			return
+		}
+		if err := utils.ValidateCaptions(captions); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+		if len(captions) > 0 {
+			if err := utils.CheckCaptionFont(); err != nil {
+				c.JSON(http.StatusInternalServerError, models.APIResponse{
+					Code:    500,
+					Message: "服务器配置错误，" + err.Error(),
+				})
+				return
+			}
+		}
+	}
+
+	// 水印、字幕等临时文件的路径前缀
+	workBase := uploadWorkBase(inputPath)
+
+	// 可选的PNG图片水印
+	var watermark *utils.WatermarkFilter
+	if watermarkFile, err := c.FormFile("watermark"); err == nil {
+		watermark = &utils.WatermarkFilter{
+			Position: req.WatermarkPosition,
+			Opacity:  0.8,
+		}
+		if req.WatermarkOpacity != nil {
+			watermark.Opacity = *req.WatermarkOpacity
+		}
+		if err := utils.ValidateWatermark(watermark); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		const maxWatermarkSize = 5 * 1024 * 1024 // 5MB
+		if watermarkFile.Size > maxWatermarkSize {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "水印图片不能超过5MB",
+			})
+			return
+		}
+
+		watermark.Path = workBase + "_watermark.png"
+		if err := c.SaveUploadedFile(watermarkFile, watermark.Path); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Code:    500,
+				Message: "水印图片保存失败: " + err.Error(),
+			})
+			return
+		}
+		if !utils.IsPNGFile(watermark.Path) {
+			os.Remove(watermark.Path)
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: "水印图片必须是PNG格式",
+			})
+			return
+		}
+	}
+
+	// 可选的字幕文件，按开始时间平移后烧录
+	var subtitlesPath string
+	if subtitlesFile, err := c.FormFile("subtitles"); err == nil {
+		subtitlesPath, err = saveSubtitles(c, subtitlesFile, workBase, startTime, duration)
+		if err != nil {
+			removeWatermark(watermark)
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	// 字幕文本写入临时文件，转换结束后清理
+	captionFilters, err := utils.WriteCaptionFiles(captions, workBase)
+	if err != nil {
+		removeWatermark(watermark)
+		removeSubtitles(subtitlesPath)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	filters := utils.VideoFilters{
+		Transform: transform,
+		Subtitles: subtitlesPath,
+		Captions:  captionFilters,
+		Watermark: watermark,
+	}
+
+	if jobManager == nil {
+		cleanupFilters(filters)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "任务服务未初始化",
+		})
+		return
+	}
+
+	conv := gifConversion{
+		inputPath:     inputPath,
+		startTime:     startTime,
+		duration:      duration,
+		width:         width,
+		preset:        preset,
+		format:        outputFormat,
+		targetSize:    targetSize,
+		optimize:      optimize,
+		lossy:         lossy,
+		filters:       filters,
+		videoDuration: videoDuration,
+
+		id:             utils.NewID(),
+		owner:          middleware.GetSessionID(c),
+		sourceFilename: uploadSourceFilename(c),
+	}
+	conv.inputSize, _ = utils.GetFileSize(inputPath)
+
+	// 相同视频和参数已转换过时直接返回已有结果
+	conv.cacheKey = conversionCacheKey(inputPath, conv)
+	if cached, ok := utils.GetConversionCache().Get(conv.cacheKey); ok {
+		cleanupFilters(filters)
+		response := *cached.(*models.VideoToGifResponse)
+		response.Cached = true
+		job, err := jobManager.Complete("video-to-gif", conv.owner, &response)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{
+				Code:    500,
+				Message: "提交转换任务失败: " + err.Error(),
+			})
+			return
+		}
+
+		// 命中缓存的记录与原记录共用输出文件，当前会话同样拥有这些文件
+		record := newConversionRecord(conv, database.ConversionSucceeded)
+		record.JobID = job.ID()
+		record.Cached = true
+		record.OutputFile = filepath.Base(response.GifURL)
+		record.OutputSize = response.FileSize
+		if response.ZipURL != nil && response.ZipSize != nil {
+			record.ZipFile = filepath.Base(*response.ZipURL)
+			record.ZipSize = *response.ZipSize
+		}
+		now := time.Now()
+		expiresAt := now.Add(utils.OutputRetention)
+		record.FinishedAt = &now
+		record.ExpiresAt = &expiresAt
+		recordConversion(record)
+		claimArtifacts(c, record.OutputFile, record.ZipFile)
+
+		c.JSON(http.StatusOK, models.APIResponse{
+			Code:    200,
+			Message: "命中转换缓存",
+			Data:    toJobInfo(job.Snapshot()),
+		})
+		return
+	}
+
+	// 提交异步转换任务，客户端通过 /api/jobs/:id 查询结果或 /api/jobs/:id/events 订阅进度
+	// 临时文件和转换记录在结束回调中处理，排队期间被取消或未能提交的任务同样会清理并更新记录
+	job, ok := submitEncodeJob(c, encodeJob{
+		jobType: "video-to-gif",
+		owner:   conv.owner,
+		label:   "转换",
+		inputs:  append([]string{inputPath}, filters.Files()...),
+		run: func(ctx context.Context, job *utils.Job) (interface{}, error) {
+			updateConversionRecord(conv.id, map[string]interface{}{"status": database.ConversionRunning})
+			return runVideoToGif(ctx, job, conv)
+		},
+		// 先写入排队中的转换记录，任务可能在返回前就开始执行
+		onAdmit: func() { recordConversion(newConversionRecord(conv, database.ConversionQueued)) },
+		onFinish: func(snapshot utils.JobSnapshot) {
+			cleanupFilters(filters)
+			updateConversionRecord(conv.id, conversionResultUpdates(snapshot))
+		},
+	})
+	if ok {
+		updateConversionRecord(conv.id, map[string]interface{}{"job_id": job.ID()})
+	}
+}
+
+// 上传视频的最大大小
+const maxVideoUploadSize = 50 * 1024 * 1024 // 50MB
+
+// receiveVideoUpload 获取请求的输入视频：videoHash引用已上传的视频，uploadId引用已完成的可续传上传，否则保存表单中的video文件
+// 只能引用当前会话上传过的视频；失败时已写入错误响应，返回false
+func receiveVideoUpload(c *gin.Context) (string, bool) {
+	if hash := c.PostForm("videoHash"); hash != "" {
+		if !requireFFmpeg(c) {
+			return "", false
+		}
+		inputPath, ok := utils.FindUpload(hash)
+		if !ok || !ownsArtifact(c, filepath.Base(inputPath)) {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Code:    404,
+				Message: "视频不存在或已过期，请重新上传",
+			})
+			return "", false
+		}
+		return inputPath, true
+	}
+
+	if id := c.PostForm("uploadId"); id != "" {
+		if !requireFFmpeg(c) {
+			return "", false
+		}
+		inputPath, ok := utils.GetTusStore().Resolve(id)
+		if !ok || !ownsArtifact(c, id) {
+			c.JSON(http.StatusNotFound, models.APIResponse{
+				Code:    404,
+				Message: "上传不存在、未完成或已过期",
+			})
+			return "", false
+		}
+		return inputPath, true
+	}
+
+	inputPath, _, _, ok := saveVideoUpload(c)
+	return inputPath, ok
+}
+
+// saveVideoUpload 校验并保存表单中的video文件，客户端压缩过的文件会自动解压
+// 文件按内容的SHA-256保存，相同内容只保留一份；返回保存路径、摘要和是否已存在，失败时已写入错误响应
+func saveVideoUpload(c *gin.Context) (string, string, bool, bool) {
 	// 获取上传的文件
 	file, err := c.FormFile("video")
 	if err != nil {
@@ -33,7 +495,7 @@ func VideoToGif(c *gin.Context) {
 			Code:    400,
 			Message: "请上传视频文件",
 		})
-		return
+		return "", "", false, false
 	}
 
 	// 验证文件类型
@@ -44,31 +506,24 @@ func VideoToGif(c *gin.Context) {
 			Code:    400,
 			Message: "不支持的文件格式，请上传视频文件",
 		})
-		return
+		return "", "", false, false
 	}
 	fmt.Printf("文件类型验证通过: %s\n", file.Filename)
 
 	// 检查文件大小 (50MB限制，适配4Mbps带宽)
-	maxFileSize := int64(50 * 1024 * 1024) // 50MB
-	if file.Size > maxFileSize {
+	if file.Size > maxVideoUploadSize {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Code:    400,
 			Message: "文件大小不能超过50MB，请压缩后上传",
 		})
-		return
+		return "", "", false, false
 	}
 
-	// 创建FFmpeg服务实例
-	ffmpegService := utils.NewFFmpegService()
 	compressionService := utils.NewCompressionService()
 
-	// 检查FFmpeg是否安装
-	if err := ffmpegService.CheckFFmpegInstallation(); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "服务器配置错误，FFmpeg未安装",
-		})
-		return
+	// 视频处理依赖FFmpeg
+	if !requireFFmpeg(c) {
+		return "", "", false, false
 	}
 
 	// 保存上传的文件
@@ -89,7 +544,7 @@ func VideoToGif(c *gin.Context) {
 			Code:    500,
 			Message: "文件保存失败: " + err.Error(),
 		})
-		return
+		return "", "", false, false
 	}
 
 	// 检查是否需要解压缩上传的文件（通过文件内容检测）
@@ -104,7 +559,7 @@ func VideoToGif(c *gin.Context) {
 				Code:    500,
 				Message: "文件解压失败: " + err.Error(),
 			})
-			return
+			return "", "", false, false
 		}
 
 		// 删除临时压缩文件
@@ -119,153 +574,329 @@ func VideoToGif(c *gin.Context) {
 				Code:    500,
 				Message: "文件移动失败: " + err.Error(),
 			})
-			return
+			return "", "", false, false
 		}
 		fmt.Printf("文件直接保存: %s\n", inputPath)
 	}
 
-	// 确保在函数结束时清理临时文件
-	defer func() {
-		// 这里可以选择是否删除原始上传文件
-		// os.Remove(inputPath)
-	}()
-
-	// 获取视频信息
-	videoDuration, err := ffmpegService.GetVideoDuration(inputPath)
+	// 按内容摘要保存，重复上传的相同视频复用已有文件
+	storedPath, hash, existed, err := utils.StoreUpload(inputPath, getFileExtension(originalFilename))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Code:    500,
-			Message: "获取视频信息失败: " + err.Error(),
+			Message: "文件保存失败: " + err.Error(),
 		})
-		return
-	}
-
-	// 设置默认参数
-	startTime := float64(0)
-	if req.StartTime != nil {
-		startTime = *req.StartTime
+		return "", "", false, false
 	}
+	claimArtifacts(c, filepath.Base(storedPath))
+	return storedPath, hash, existed, true
+}
 
-	// 默认转换整个视频时长
-	duration := videoDuration
-	if req.Duration != nil && *req.Duration > 0 {
-		duration = *req.Duration
+// requireFFmpeg 检查服务器是否安装了FFmpeg，未安装时返回503
+func requireFFmpeg(c *gin.Context) bool {
+	if utils.FFmpegAvailable() {
+		return true
 	}
+	c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+		Code:    503,
+		Message: "服务器未安装FFmpeg，该功能暂不可用",
+	})
+	return false
+}
 
-	// 默认宽度设置为1080
-	width := 1080
-	if req.Width != nil {
-		width = *req.Width
+// removeUpload 删除请求的输入文件，按内容寻址保存的视频可能被其他请求复用，留给定时清理
+func removeUpload(path string) {
+	if utils.UploadHash(path) == "" {
+		os.Remove(path)
 	}
+}
 
-	quality := "medium"
-	if req.Quality != "" {
-		quality = req.Quality
-	}
+// uploadWorkBase 请求临时文件（水印、字幕等）的路径前缀，同一视频可能同时被多个请求使用，需要区分
+func uploadWorkBase(inputPath string) string {
+	return filepath.Join(filepath.Dir(inputPath), utils.NewID())
+}
 
-	// 参数验证
-	if startTime < 0 {
+// receiveAnimationUpload 校验并保存表单中的gif文件，按文件内容识别格式，只接受formats中列出的格式
+// 失败时已写入错误响应，返回false
+func receiveAnimationUpload(c *gin.Context, formats ...string) (string, string, bool) {
+	file, err := c.FormFile("gif")
+	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Code:    400,
-			Message: "开始时间不能小于0",
+			Message: "请上传GIF文件",
 		})
-		return
+		return "", "", false
 	}
 
-	// 检查开始时间不能超过视频总时长
-	if startTime >= videoDuration {
+	if file.Size > maxVideoUploadSize {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Code:    400,
-			Message: fmt.Sprintf("开始时间不能超过视频总时长(%.2f秒)", videoDuration),
+			Message: "文件大小不能超过50MB",
 		})
-		return
+		return "", "", false
 	}
 
-	// 调整持续时间，确保不超过视频剩余时长
-	remainingDuration := videoDuration - startTime
-	if duration > remainingDuration {
-		duration = remainingDuration
+	tempPath := filepath.Join("uploads", utils.GenerateUniqueFilename("upload"))
+	if err := c.SaveUploadedFile(file, tempPath); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "文件保存失败: " + err.Error(),
+		})
+		return "", "", false
 	}
 
-	// 最终验证duration是否有效
-	if duration <= 0 {
+	// 以文件内容为准，不信任扩展名
+	format := utils.DetectAnimationFormat(tempPath)
+	if format == "" || !slices.Contains(formats, format) {
+		os.Remove(tempPath)
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Code:    400,
-			Message: "计算后的持续时间无效",
+			Message: "不支持的文件格式，请上传" + strings.ToUpper(strings.Join(formats, "/")) + "动画",
 		})
-		return
+		return "", "", false
 	}
 
-	if width < 100 || width > 3840 {
+	inputPath := strings.TrimSuffix(tempPath, ".upload") + "." + utils.OutputExtension(format)
+	if err := os.Rename(tempPath, inputPath); err != nil {
+		os.Remove(tempPath)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Code:    500,
+			Message: "文件移动失败: " + err.Error(),
+		})
+		return "", "", false
+	}
+	return inputPath, format, true
+}
+
+// probeUploadedVideo 读取上传视频的媒体信息，失败时已写入错误响应，返回false
+func probeUploadedVideo(c *gin.Context, inputPath string) (*models.MediaInfo, bool) {
+	info, err := utils.NewFFmpegService(utils.DefaultRunner()).ProbeMedia(c.Request.Context(), inputPath)
+	if errors.Is(err, utils.ErrFFmpegCancelled) {
+		// 客户端已断开，无需响应
+		return nil, false
+	}
+	if errors.Is(err, utils.ErrFFmpegTimeout) {
+		c.JSON(http.StatusGatewayTimeout, models.APIResponse{
+			Code:    504,
+			Message: "获取视频信息超时",
+		})
+		return nil, false
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Code:    400,
-			Message: "宽度必须在100-3840像素之间",
+			Message: "获取视频信息失败: " + err.Error(),
 		})
-		return
+		return nil, false
+	}
+	return info, true
+}
+
+// gifConversion 视频转GIF任务参数
+type gifConversion struct {
+	inputPath     string
+	startTime     float64
+	duration      float64
+	width         int
+	preset        models.Preset
+	format        string
+	targetSize    int64              // 目标文件大小，0表示不限制
+	optimize      bool               // 转换后对GIF做帧差分优化
+	lossy         int                // 有损优化强度
+	filters       utils.VideoFilters // 画面变换、字幕和水印
+	videoDuration float64
+	cacheKey      string // 转换缓存键，为空时不缓存
+
+	// 转换记录信息，id同时作为输出文件的标识
+	id             string
+	owner          string
+	sourceFilename string
+	inputSize      int64
+}
+
+// conversionCacheParams 参与转换缓存键计算的规范化参数，附加文件以内容摘要表示
+type conversionCacheParams struct {
+	StartTime         float64                `json:"startTime"`
+	Duration          float64                `json:"duration"`
+	Width             int                    `json:"width"`
+	Preset            models.Preset          `json:"preset"`
+	Format            string                 `json:"format"`
+	TargetSize        int64                  `json:"targetSize"`
+	Optimize          bool                   `json:"optimize"`
+	Lossy             int                    `json:"lossy"`
+	Transform         *models.VideoTransform `json:"transform"`
+	Captions          []models.Caption       `json:"captions"`
+	Subtitles         string                 `json:"subtitles"`
+	Watermark         string                 `json:"watermark"`
+	WatermarkPosition string                 `json:"watermarkPosition"`
+	WatermarkOpacity  float64                `json:"watermarkOpacity"`
+}
+
+// conversionCacheKey 计算转换缓存键，输入不是按内容寻址保存的视频或附加文件读取失败时返回空字符串
+func conversionCacheKey(inputPath string, conv gifConversion) string {
+	inputHash := utils.UploadHash(inputPath)
+	if inputHash == "" {
+		return ""
+	}
+
+	params := conversionCacheParams{
+		StartTime:  conv.startTime,
+		Duration:   conv.duration,
+		Width:      conv.width,
+		Preset:     conv.preset,
+		Format:     conv.format,
+		TargetSize: conv.targetSize,
+		Optimize:   conv.optimize,
+		Lossy:      conv.lossy,
+		Transform:  conv.filters.Transform,
+	}
+	params.Preset.Label = ""
+
+	var err error
+	if conv.filters.Subtitles != "" {
+		if params.Subtitles, err = utils.FileSHA256(conv.filters.Subtitles); err != nil {
+			return ""
+		}
+	}
+	if watermark := conv.filters.Watermark; watermark != nil {
+		if params.Watermark, err = utils.FileSHA256(watermark.Path); err != nil {
+			return ""
+		}
+		params.WatermarkPosition = watermark.Position
+		params.WatermarkOpacity = watermark.Opacity
+	}
+	for _, caption := range conv.filters.Captions {
+		params.Captions = append(params.Captions, caption.Caption)
+	}
+
+	key, err := utils.ConversionCacheKey(inputHash, params)
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// 目标大小模式最多编码次数
+const maxTargetSizeAttempts = 6
+
+// runVideoToGif 执行视频转GIF，在任务worker中运行
+func runVideoToGif(ctx context.Context, job *utils.Job, conv gifConversion) (*models.VideoToGifResponse, error) {
+	ffmpegService := utils.NewFFmpegService(utils.DefaultRunner())
+	ffmpegService.SetProgressCallback(job.SetProgress)
+	ffmpegService.SetVideoFilters(conv.filters)
+	compressionService := utils.NewCompressionService()
+
+	// 申请编码资源，排队期间上报队列位置
+	weight := utils.EncodeWeight(conv.format, conv.preset.FPS, conv.preset.MaxColors, conv.width)
+	if conv.targetSize > 0 || conv.preset.SceneThreshold > 0 {
+		// 目标大小模式和场景自适应调色板需要多次处理
+		weight *= 2
+	}
+	release, err := acquireEncode(ctx, job, weight)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	// 生成输出文件路径
-	outputFilename := utils.GenerateUniqueFilename("gif")
+	// 生成输出文件路径，文件标识与转换记录ID相同
+	outputFilename := conv.id + "." + utils.OutputExtension(conv.format)
 	outputPath := filepath.Join("output", outputFilename)
 
-	// 根据质量选择不同的转换方法 - 添加超高质量支持
+	// 根据输出格式和预设选择转换方法
 	var convertErr error
-	switch quality {
-	case "ultra":
-		// 超高质量使用调色板优化的高质量转换
-		convertErr = ffmpegService.ConvertVideoToGifWithPalette(inputPath, outputPath, startTime, duration, width, quality)
-	case "high":
-		// 高质量也使用调色板优化转换，以提升效果
-		convertErr = ffmpegService.ConvertVideoToGifWithPalette(inputPath, outputPath, startTime, duration, width, quality)
-	case "medium", "low":
-		// 中质量和低质量使用标准转换方法
-		convertErr = ffmpegService.ConvertVideoToGif(inputPath, outputPath, startTime, duration, width, quality)
+	var targetResult *utils.TargetSizeResult
+	var segments []models.PaletteSegment
+	switch {
+	case conv.targetSize > 0:
+		// 目标大小模式：多次编码搜索不超过目标大小的最佳参数
+		attempt := 0
+		ffmpegService.SetProgressCallback(func(p models.ConversionProgress) {
+			p.Attempt = attempt
+			job.SetProgress(p)
+		})
+		targetResult, convertErr = ffmpegService.ConvertVideoToGifTargetSize(ctx, conv.inputPath, outputPath, conv.startTime, conv.duration,
+			conv.width, conv.targetSize, maxTargetSizeAttempts, func(n int) { attempt = n })
+	case conv.format != utils.FormatGIF:
+		// WebP/APNG/AVIF使用各自编码器单遍转换，编码质量按预设名称选择
+		convertErr = ffmpegService.ConvertVideoToAnimation(ctx, conv.inputPath, outputPath, conv.startTime, conv.duration, conv.width, conv.preset, conv.format)
+	case conv.preset.SceneThreshold > 0:
+		// 场景自适应：按场景切换分段，每段单独生成调色板
+		segments, convertErr = ffmpegService.ConvertVideoToGifAdaptive(ctx, conv.inputPath, outputPath, conv.startTime, conv.duration,
+			utils.PresetPaletteParams(conv.preset, conv.width), conv.preset.SceneThreshold)
 	default:
-		// 默认使用标准转换方法
-		convertErr = ffmpegService.ConvertVideoToGif(inputPath, outputPath, startTime, duration, width, quality)
+		// GIF按预设参数两遍调色板转换
+		convertErr = ffmpegService.ConvertVideoToGifWithParams(ctx, conv.inputPath, outputPath, conv.startTime, conv.duration,
+			utils.PresetPaletteParams(conv.preset, conv.width))
 	}
 
-	if convertErr != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "视频转换失败: " + convertErr.Error(),
-		})
-		return
+	switch {
+	case errors.Is(convertErr, utils.ErrFFmpegTimeout):
+		return nil, fmt.Errorf("视频转换超时，请缩短时长或降低分辨率后重试")
+	case errors.Is(convertErr, utils.ErrFFmpegCancelled):
+		return nil, fmt.Errorf("视频转换已取消")
+	case convertErr != nil:
+		return nil, fmt.Errorf("视频转换失败: %v", convertErr)
 	}
 
-	// 验证生成的GIF文件
-	if !isValidGifFile(outputPath) {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "生成的GIF文件格式错误",
-		})
-		return
+	// 按输出格式验证生成的文件
+	if !utils.IsValidAnimationFile(outputPath, conv.format) {
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("生成的%s文件格式错误", strings.ToUpper(conv.format))
+	}
+
+	// GIF帧差分优化，优化失败不影响主流程
+	var optimization *models.GifOptimizeInfo
+	if conv.optimize {
+		result, err := utils.OptimizeGif(ctx, outputPath, outputPath, utils.GifOptimizeOptions{Lossy: conv.lossy}, job.SetProgress)
+		switch {
+		case ctx.Err() != nil:
+			os.Remove(outputPath)
+			return nil, fmt.Errorf("视频转换已取消")
+		case err != nil:
+			fmt.Printf("GIF优化失败: %v\n", err)
+		default:
+			optimization = gifOptimizeInfo(result, conv.lossy)
+		}
 	}
 
 	// 获取生成的GIF文件信息
 	fileSize, err := utils.GetFileSize(outputPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "获取文件信息失败: " + err.Error(),
-		})
-		return
+		return nil, fmt.Errorf("获取文件信息失败: %v", err)
 	}
 
 	// 构建基础响应
-	response := models.VideoToGifResponse{
+	response := &models.VideoToGifResponse{
 		GifURL:        config.BuildStaticURL(outputFilename),
+		Format:        conv.format,
 		FileSize:      fileSize,
-		Duration:      duration,
-		VideoDuration: videoDuration,
+		Duration:      conv.duration,
+		VideoDuration: conv.videoDuration,
+		Transform:     conv.filters.Transform,
+		Optimization:  optimization,
+	}
+	if conv.format == utils.FormatGIF && conv.targetSize == 0 {
+		response.Preset = &conv.preset
+		response.Segments = segments
+	}
+
+	if targetResult != nil {
+		response.TargetSize = &models.TargetSizeInfo{
+			TargetSizeBytes: conv.targetSize,
+			Attempts:        targetResult.Attempts,
+			Width:           targetResult.Params.Width,
+			FPS:             targetResult.Params.FPS,
+			MaxColors:       targetResult.Params.MaxColors,
+			Dither:          targetResult.Params.Dither,
+		}
 	}
 
-	// 只有当GIF文件>=8MB时才创建ZIP压缩包
+	// 只有当输出文件>=8MB时才创建ZIP压缩包
 	const compressionThreshold = 8 * 1024 * 1024 // 8MB
-	if fileSize >= compressionThreshold {
+	if fileSize >= compressionThreshold && ctx.Err() == nil {
 		fmt.Printf("GIF文件大小: %d bytes, 达到压缩阈值(%d bytes)，创建ZIP压缩包\n", fileSize, compressionThreshold)
 
-		zipFilename := strings.Replace(outputFilename, ".gif", ".zip", 1)
+		zipFilename := strings.TrimSuffix(outputFilename, filepath.Ext(outputFilename)) + ".zip"
 		zipPath := filepath.Join("output", zipFilename)
 
 		// 创建ZIP压缩包
@@ -291,11 +922,14 @@ func VideoToGif(c *gin.Context) {
 		fmt.Printf("GIF文件大小: %d bytes, 未达到压缩阈值(%d bytes)，跳过ZIP创建\n", fileSize, compressionThreshold)
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Code:    200,
-		Message: "转换成功",
-		Data:    response,
-	})
+	files := []string{outputFilename}
+	if response.ZipURL != nil {
+		files = append(files, strings.TrimSuffix(outputFilename, filepath.Ext(outputFilename))+".zip")
+	}
+	utils.ClaimArtifacts(conv.owner, files...)
+	utils.GetConversionCache().Put(conv.cacheKey, response, files...)
+
+	return response, nil
 }
 
 // CompressFile 压缩文件接口
@@ -309,6 +943,20 @@ func CompressFile(c *gin.Context) {
 		return
 	}
 
+	// 只允许访问以标识命名的输出文件
+	if filepath.Base(filename) != filename || utils.FileID(filename) == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "文件名格式错误",
+		})
+		return
+	}
+
+	// 只能操作当前会话拥有的文件
+	if !requireArtifact(c, filename) {
+		return
+	}
+
 	// 构建文件路径
 	filePath := filepath.Join("output", filename)
 
@@ -366,6 +1014,7 @@ func CompressFile(c *gin.Context) {
 
 	// 计算压缩率
 	compressionRatio := compressionService.GetCompressionRatio(originalSize, compressedSize)
+	claimArtifacts(c, compressedFilename)
 
 	response := map[string]interface{}{
 		"compressedUrl":    config.BuildStaticURL(compressedFilename),
@@ -393,6 +1042,20 @@ func DecompressFile(c *gin.Context) {
 		return
 	}
 
+	// 只允许访问以标识命名的输出文件
+	if filepath.Base(filename) != filename || utils.FileID(filename) == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Code:    400,
+			Message: "文件名格式错误",
+		})
+		return
+	}
+
+	// 只能操作当前会话拥有的文件
+	if !requireArtifact(c, filename) {
+		return
+	}
+
 	// 构建文件路径
 	filePath := filepath.Join("output", filename)
 
@@ -428,6 +1091,7 @@ func DecompressFile(c *gin.Context) {
 		})
 		return
 	}
+	claimArtifacts(c, decompressedFilename)
 
 	response := map[string]interface{}{
 		"decompressedUrl": config.BuildStaticURL(decompressedFilename),
@@ -441,108 +1105,63 @@ func DecompressFile(c *gin.Context) {
 	})
 }
 
-// GetConversionHistory 获取转换历史记录
-func GetConversionHistory(c *gin.Context) {
-	outputDir := "output"
+// cleanupFilters 清理字幕和水印的临时文件
+func cleanupFilters(filters utils.VideoFilters) {
+	utils.RemoveCaptionFiles(filters.Captions)
+	removeWatermark(filters.Watermark)
+	removeSubtitles(filters.Subtitles)
+}
 
-	// 读取output目录中的所有GIF文件
-	files, err := os.ReadDir(outputDir)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "读取历史记录失败: " + err.Error(),
-		})
-		return
+// removeWatermark 删除上传的水印图片
+func removeWatermark(watermark *utils.WatermarkFilter) {
+	if watermark != nil {
+		os.Remove(watermark.Path)
 	}
+}
 
-	var historyItems []models.ConversionHistoryItem
-
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-
-		// 只处理GIF文件
-		if !strings.HasSuffix(strings.ToLower(file.Name()), ".gif") {
-			continue
-		}
-
-		filePath := filepath.Join(outputDir, file.Name())
-
-		// 获取文件信息
-		fileInfo, err := file.Info()
-		if err != nil {
-			continue
-		}
-
-		// 获取文件大小
-		fileSize, err := utils.GetFileSize(filePath)
-		if err != nil {
-			continue
-		}
-
-		historyItem := models.ConversionHistoryItem{
-			ID:        file.Name()[:len(file.Name())-4], // 去掉.gif后缀作为ID
-			Filename:  file.Name(),
-			GifURL:    config.BuildStaticURL(file.Name()),
-			FileSize:  fileSize,
-			CreatedAt: fileInfo.ModTime(),
-		}
-
-		historyItems = append(historyItems, historyItem)
+// saveSubtitles 保存上传的字幕文件并平移到片段时间轴，返回处理后的字幕路径
+// 片段内没有任何字幕时返回空路径，不添加字幕滤镜
+func saveSubtitles(c *gin.Context, file *multipart.FileHeader, base string, startTime, duration float64) (string, error) {
+	const maxSubtitlesSize = 2 * 1024 * 1024 // 2MB
+	if file.Size > maxSubtitlesSize {
+		return "", fmt.Errorf("字幕文件不能超过2MB")
 	}
 
-	// 按创建时间倒序排列（最新的在前面）
-	for i, j := 0, len(historyItems)-1; i < j; i, j = i+1, j-1 {
-		if historyItems[i].CreatedAt.Before(historyItems[j].CreatedAt) {
-			historyItems[i], historyItems[j] = historyItems[j], historyItems[i]
-		}
+	format := utils.SubtitleFormat(file.Filename)
+	if format == "" {
+		return "", fmt.Errorf("不支持的字幕格式，请上传SRT/ASS/VTT文件")
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Code:    200,
-		Message: "获取成功",
-		Data:    historyItems,
-	})
-}
-
-// DeleteConversionHistory 删除转换历史记录
-func DeleteConversionHistory(c *gin.Context) {
-	// 获取要删除的文件ID（不含.gif后缀）
-	fileID := c.Param("id")
-	if fileID == "" {
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Code:    400,
-			Message: "缺少文件ID参数",
-		})
-		return
+	uploadPath := base + "_subtitles_upload" + filepath.Ext(file.Filename)
+	if err := c.SaveUploadedFile(file, uploadPath); err != nil {
+		return "", fmt.Errorf("字幕文件保存失败: %v", err)
 	}
+	defer os.Remove(uploadPath)
 
-	// 构建文件路径
-	filename := fileID + ".gif"
-	filePath := filepath.Join("output", filename)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, models.APIResponse{
-			Code:    404,
-			Message: "文件不存在",
-		})
-		return
+	path, count, err := utils.PrepareSubtitles(uploadPath, format, startTime, duration, base)
+	if err != nil {
+		return "", fmt.Errorf("字幕文件解析失败: %v", err)
+	}
+	if count == 0 {
+		os.Remove(path)
+		return "", nil
 	}
+	return path, nil
+}
 
-	// 删除文件
-	if err := os.Remove(filePath); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Code:    500,
-			Message: "删除文件失败: " + err.Error(),
-		})
-		return
+// removeSubtitles 删除处理后的字幕文件
+func removeSubtitles(path string) {
+	if path != "" {
+		os.Remove(path)
 	}
+}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Code:    200,
-		Message: "删除成功",
+// respondBusy 返回503并通过Retry-After提示客户端重试时间
+func respondBusy(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+		Code:    503,
+		Message: "服务器繁忙，请稍后再试",
 	})
 }
 
@@ -574,39 +1193,3 @@ func getFileExtension(filename string) string {
 	}
 	return ""
 }
-
-// isValidGifFile 验证GIF文件是否有效
-func isValidGifFile(filePath string) bool {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return false
-	}
-	defer file.Close()
-
-	// 读取文件头
-	header := make([]byte, 6)
-	n, err := file.Read(header)
-	if err != nil || n != 6 {
-		return false
-	}
-
-	// 检查GIF文件签名
-	gif87a := []byte{'G', 'I', 'F', '8', '7', 'a'}
-	gif89a := []byte{'G', 'I', 'F', '8', '9', 'a'}
-
-	// 比较文件头
-	for i := 0; i < 6; i++ {
-		if header[i] != gif87a[i] && header[i] != gif89a[i] {
-			return false
-		}
-	}
-
-	// 检查文件大小
-	stat, err := file.Stat()
-	if err != nil {
-		return false
-	}
-
-	// GIF文件至少应该有几百字节
-	return stat.Size() > 100
-}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"toGif-backend/internal/middleware"
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+	"toGif-backend/internal/utils/utilstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ffmpegFailingRunner ffprobe正常返回，ffmpeg调用失败
+type ffmpegFailingRunner struct {
+	*utilstest.FakeRunner
+}
+
+func (r ffmpegFailingRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	if name == "ffmpeg" {
+		io.WriteString(stderr, "Conversion failed!")
+		return errors.New("exit status 1")
+	}
+	return r.FakeRunner.Run(ctx, name, args, stdout, stderr)
+}
+
+// setupVideoTest 在临时目录中准备上传和输出目录，使用runner代替ffmpeg
+func setupVideoTest(t *testing.T, runner utils.CommandRunner, queueSize int) *gin.Engine {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{"uploads", "output"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := utils.DefaultRunner()
+	t.Cleanup(func() {
+		utils.SetDefaultRunner(previous)
+		utils.InitEncoder("auto")
+	})
+	utils.SetDefaultRunner(runner)
+	utils.InitEncoder("auto")
+	utils.InitConversionCache(0, "output")
+	utils.InitEncodeScheduler(1, queueSize)
+	InitJobManager(1, 1)
+	t.Cleanup(jobManager.Stop)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Session("test", "auto"))
+	r.POST("/video/to-gif", VideoToGif)
+	return r
+}
+
+// postVideo 以multipart表单提交视频，filename为空时不附带文件
+func postVideo(t *testing.T, r *gin.Engine, filename string, fields map[string]string) (*httptest.ResponseRecorder, models.APIResponse) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	if filename != "" {
+		part, err := writer.CreateFormFile("video", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("fake video content"))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/video/to-gif", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response models.APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w, response
+}
+
+func TestVideoToGifBadUpload(t *testing.T) {
+	r := setupVideoTest(t, &utilstest.FakeRunner{}, 4)
+
+	tests := []struct {
+		name     string
+		filename string
+		message  string
+	}{
+		{"missing file", "", "请上传视频文件"},
+		{"not a video", "notes.txt", "不支持的文件格式"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, response := postVideo(t, r, tt.filename, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			if !strings.Contains(response.Message, tt.message) {
+				t.Errorf("message = %q, want %q", response.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestVideoToGifProbeFailure(t *testing.T) {
+	runner := &utilstest.FakeRunner{Err: errors.New("exit status 1"), Stderr: "moov atom not found"}
+	r := setupVideoTest(t, runner, 4)
+
+	w, response := postVideo(t, r, "clip.mp4", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if !strings.HasPrefix(response.Message, "获取视频信息失败") {
+		t.Errorf("message = %q", response.Message)
+	}
+	for _, call := range runner.Calls() {
+		// 启动时查询解码器列表的调用不算转换
+		if call.Name == "ffmpeg" && !slices.Contains(call.Args, "-decoders") {
+			t.Errorf("ffmpeg should not run after probe failure: %v", call.Args)
+		}
+	}
+}
+
+func TestVideoToGifQueueFull(t *testing.T) {
+	// 等待队列长度为0，有空闲容量时仍接受任务
+	r := setupVideoTest(t, &utilstest.FakeRunner{}, 0)
+
+	// 占满编码容量后，新任务无处排队
+	release, err := utils.GetEncodeScheduler().Acquire(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	w, _ := postVideo(t, r, "clip.mp4", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+// TestVideoToGifAcceptedWithFreeCapacity 等待队列长度为0但编码容量空闲时接受任务，且已接受的任务不会因排队已满而失败
+func TestVideoToGifAcceptedWithFreeCapacity(t *testing.T) {
+	// 输出有效性检查要求文件超过100字节，FakeRunner默认的1x1 GIF太小
+	var gifData bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 32, 32), palette.Plan9)
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(i * 7)
+	}
+	if err := gif.Encode(&gifData, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := setupVideoTest(t, &utilstest.FakeRunner{Outputs: map[string][]byte{"gif": gifData.Bytes()}}, 0)
+
+	w, response := postVideo(t, r, "clip.mp4", map[string]string{"quality": "low"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	data, _ := json.Marshal(response.Data)
+	var info models.JobInfo
+	json.Unmarshal(data, &info)
+	job, ok := jobManager.Get(info.ID)
+	if !ok {
+		t.Fatalf("job %s not found", info.ID)
+	}
+	if snapshot := waitForJob(t, job); snapshot.Status != utils.JobSucceeded {
+		t.Fatalf("job status = %s (%s), want succeeded", snapshot.Status, snapshot.Error)
+	}
+}
+
+func TestVideoToGifFFmpegFailure(t *testing.T) {
+	r := setupVideoTest(t, ffmpegFailingRunner{&utilstest.FakeRunner{}}, 4)
+
+	w, response := postVideo(t, r, "clip.mp4", map[string]string{"quality": "low"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	data, _ := json.Marshal(response.Data)
+	var info models.JobInfo
+	json.Unmarshal(data, &info)
+
+	job, ok := jobManager.Get(info.ID)
+	if !ok {
+		t.Fatalf("job %s not found", info.ID)
+	}
+	snapshot := waitForJob(t, job)
+	if snapshot.Status != utils.JobFailed {
+		t.Fatalf("job status = %s, want failed", snapshot.Status)
+	}
+	if !strings.Contains(snapshot.Error, "Conversion failed!") {
+		t.Errorf("job error = %q, want ffmpeg output", snapshot.Error)
+	}
+
+	entries, _ := os.ReadDir("output")
+	if len(entries) != 0 {
+		t.Errorf("output dir not empty after failure: %v", entries)
+	}
+}
+
+// waitForJob 等待任务结束
+func waitForJob(t *testing.T, job *utils.Job) utils.JobSnapshot {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if snapshot := job.Snapshot(); snapshot.Finished() {
+			return snapshot
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for job")
+	return utils.JobSnapshot{}
+}
+
+func TestVideoToGifCropBounds(t *testing.T) {
+	// 旋转90度的640x360视频，显示尺寸为360x640
+	rotatedProbe := []byte(`{
+  "streams": [{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 640, "height": 360,
+    "avg_frame_rate": "25/1", "duration": "5.0", "side_data_list": [{"rotation": -90}]}],
+  "format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "5.0", "size": "102400"}
+}`)
+
+	tests := []struct {
+		name   string
+		probe  []byte
+		crop   string
+		status int
+	}{
+		{"inside frame", nil, `{"x":320,"y":180,"width":320,"height":180}`, http.StatusAccepted},
+		{"beyond right edge", nil, `{"x":400,"y":0,"width":320,"height":180}`, http.StatusBadRequest},
+		{"beyond bottom edge", nil, `{"x":0,"y":200,"width":320,"height":180}`, http.StatusBadRequest},
+		{"rotated inside frame", rotatedProbe, `{"x":0,"y":0,"width":360,"height":640}`, http.StatusAccepted},
+		{"rotated uses display size", rotatedProbe, `{"x":0,"y":0,"width":640,"height":360}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupVideoTest(t, &utilstest.FakeRunner{Probe: tt.probe}, 4)
+			w, response := postVideo(t, r, "clip.mp4", map[string]string{
+				"width":     "320",
+				"transform": `{"crop":` + tt.crop + `}`,
+			})
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusBadRequest {
+				if !strings.Contains(response.Message, "裁剪区域超出视频画面") {
+					t.Errorf("message = %q", response.Message)
+				}
+				return
+			}
+			// 等待任务结束，避免在临时目录被清理后继续写入
+			data, _ := json.Marshal(response.Data)
+			var info models.JobInfo
+			json.Unmarshal(data, &info)
+			if job, ok := jobManager.Get(info.ID); ok {
+				waitForJob(t, job)
+			}
+		})
+	}
+}
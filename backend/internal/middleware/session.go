@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 匿名会话的cookie名和上下文键
+const (
+	sessionCookieName = "togif_session"
+	sessionContextKey = "sessionID"
+	sessionTokenKey   = "sessionToken"
+)
+
+// sessionCookieMaxAge 会话cookie的有效期（秒）
+const sessionCookieMaxAge = 365 * 24 * 60 * 60
+
+// Session 为每个客户端签发匿名会话，上传、转换结果和压缩文件按会话归属
+// 令牌格式为"<会话ID>.<签名>"，优先读取Authorization: Bearer请求头，其次读取cookie；
+// 都没有时签发新会话并写入cookie。Bearer令牌签名无效时返回401，cookie无效时重新签发
+// secureCookie为true/false时强制设置cookie的Secure属性，其他值按请求是否为HTTPS设置
+func Session(secret, secureCookie string) gin.HandlerFunc {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		log.Println("Warning: SESSION_SECRET is not set, using a random key (sessions will not survive a restart)")
+	}
+
+	return func(c *gin.Context) {
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			id, ok := verifySessionToken(key, token)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, models.APIResponse{
+					Code:    401,
+					Message: "会话令牌无效",
+				})
+				return
+			}
+			c.Set(sessionContextKey, id)
+			c.Set(sessionTokenKey, token)
+			c.Next()
+			return
+		}
+
+		token, err := c.Cookie(sessionCookieName)
+		id, ok := verifySessionToken(key, token)
+		if err != nil || !ok {
+			id = utils.NewID()
+			token = signSessionToken(key, id)
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(sessionCookieName, token, sessionCookieMaxAge, "/", "", cookieSecure(c, secureCookie), true)
+		}
+		c.Set(sessionContextKey, id)
+		c.Set(sessionTokenKey, token)
+		c.Next()
+	}
+}
+
+// cookieSecure 判断会话cookie是否设置Secure属性
+// 未强制指定时，直接的TLS连接或反向代理转发的HTTPS请求（X-Forwarded-Proto: https）都视为HTTPS
+func cookieSecure(c *gin.Context, mode string) bool {
+	switch strings.ToLower(mode) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if c.Request.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// GetSessionID 获取当前请求的会话ID
+func GetSessionID(c *gin.Context) string {
+	return c.GetString(sessionContextKey)
+}
+
+// GetSessionToken 获取当前请求的会话令牌，不使用cookie的客户端可通过Bearer请求头携带
+func GetSessionToken(c *gin.Context) string {
+	return c.GetString(sessionTokenKey)
+}
+
+// signSessionToken 用HMAC-SHA256对会话ID签名
+func signSessionToken(key []byte, id string) string {
+	return id + "." + sessionSignature(key, id)
+}
+
+// verifySessionToken 校验令牌签名，返回其中的会话ID
+func verifySessionToken(key []byte, token string) (string, bool) {
+	id, signature, found := strings.Cut(token, ".")
+	if !found || !utils.IsID(id) {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(sessionSignature(key, id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// sessionSignature 计算会话ID的签名
+func sessionSignature(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
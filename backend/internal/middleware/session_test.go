@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSessionCookieSecure 会话cookie的Secure属性按配置或请求协议设置
+func TestSessionCookieSecure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		mode   string
+		tls    bool
+		header string
+		want   bool
+	}{
+		{"plain http", "auto", false, "", false},
+		{"direct tls", "auto", true, "", true},
+		{"forwarded https", "auto", false, "https", true},
+		{"forwarded chain", "auto", false, "HTTPS, http", true},
+		{"forwarded http", "auto", false, "http", false},
+		{"forced on", "true", false, "", true},
+		{"forced off", "false", true, "https", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Session("test", tt.mode))
+			r.GET("/", func(c *gin.Context) {})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("expected one session cookie, got %v", cookies)
+			}
+			if cookies[0].Secure != tt.want {
+				t.Errorf("Secure = %v, want %v", cookies[0].Secure, tt.want)
+			}
+		})
+	}
+}
@@ -14,27 +14,341 @@ type VideoToGifRequest struct {
 	StartTime *float64 `form:"startTime"`
 	Duration  *float64 `form:"duration"`
 	Width     *int     `form:"width"`
-	Quality   string   `form:"quality"`
+	Quality   string   `form:"quality"` // 预设名称，默认medium
+	// 自定义预设，JSON格式的Preset，设置后忽略quality
+	Preset string `form:"preset"`
+	// 输出格式: gif(默认) / webp / apng / avif
+	OutputFormat string `form:"outputFormat"`
+	// 目标文件大小(字节)，设置后自动搜索不超过该大小的最佳参数，width作为最大宽度
+	TargetSizeBytes *int64 `form:"targetSizeBytes"`
+	// 画面变换，JSON格式的VideoTransform
+	Transform string `form:"transform"`
+	// 文字字幕，JSON格式的Caption数组
+	Captions string `form:"captions"`
+	// 图片水印（通过watermark文件字段上传PNG）的位置和不透明度
+	WatermarkPosition string   `form:"watermarkPosition"`
+	WatermarkOpacity  *float64 `form:"watermarkOpacity"`
+	// 转换后对GIF做帧差分优化，默认开启
+	Optimize *bool `form:"optimize"`
+	// 有损优化强度 0-200，默认0（无损）
+	Lossy *int `form:"lossy"`
+}
+
+// Caption 文字字幕
+type Caption struct {
+	Text         string   `json:"text"`
+	Position     string   `json:"position"`            // top/center/bottom，默认bottom
+	FontSize     int      `json:"fontSize"`            // 字号，默认24
+	Color        string   `json:"color"`               // 文字颜色#RRGGBB，默认白色
+	OutlineColor string   `json:"outlineColor"`        // 描边颜色#RRGGBB，默认黑色
+	OutlineWidth *int     `json:"outlineWidth"`        // 描边宽度0-10，默认2
+	StartTime    *float64 `json:"startTime,omitempty"` // 显示开始时间（输出画面时间轴）
+	EndTime      *float64 `json:"endTime,omitempty"`   // 显示结束时间，不设置则显示到结尾
+}
+
+// VideoTransform 画面变换参数，按 裁剪 -> 旋转 -> 翻转 -> 变速 -> 倒放/往返 的顺序应用
+type VideoTransform struct {
+	Crop      *CropRect `json:"crop,omitempty"`      // 裁剪区域（原始视频坐标）
+	Rotate    int       `json:"rotate,omitempty"`    // 顺时针旋转角度: 0/90/180/270
+	FlipH     bool      `json:"flipH,omitempty"`     // 水平翻转
+	FlipV     bool      `json:"flipV,omitempty"`     // 垂直翻转
+	Speed     float64   `json:"speed,omitempty"`     // 播放速度 0.25-4，0表示不变速
+	Reverse   bool      `json:"reverse,omitempty"`   // 倒放
+	Boomerang bool      `json:"boomerang,omitempty"` // 正放后接倒放
+}
+
+// CropRect 裁剪区域
+type CropRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Preset GIF转换预设
+type Preset struct {
+	Name               string  `json:"name"`
+	Label              string  `json:"label,omitempty"`              // 展示名称
+	FPS                int     `json:"fps"`                          // 帧率 1-50
+	Scaler             string  `json:"scaler"`                       // 缩放算法: lanczos/bicubic/bilinear/neighbor等
+	MaxColors          int     `json:"maxColors"`                    // 调色板颜色数 2-256
+	StatsMode          string  `json:"statsMode,omitempty"`          // palettegen统计模式: full/diff/single(每帧单独调色板)
+	Dither             string  `json:"dither"`                       // paletteuse抖动方式
+	ReserveTransparent bool    `json:"reserveTransparent,omitempty"` // 调色板中保留透明色
+	Width              int     `json:"width"`                        // 未指定宽度时的默认宽度
+	SceneThreshold     float64 `json:"sceneThreshold,omitempty"`     // 大于0时按场景切换分段，每段单独生成调色板
+}
+
+// PaletteSegment 使用独立调色板的片段，时间基于输出画面时间轴（秒）
+type PaletteSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// PresetsResponse 预设列表
+type PresetsResponse struct {
+	Presets []Preset `json:"presets"`
+	Default string   `json:"default"`
 }
 
 // VideoToGifResponse 视频转GIF响应
 type VideoToGifResponse struct {
-	GifURL           string   `json:"gifUrl"`
-	FileSize         int64    `json:"fileSize"`
-	Duration         float64  `json:"duration"`
-	VideoDuration    float64  `json:"videoDuration"`
-	ZipURL           *string  `json:"zipUrl,omitempty"`           // ZIP压缩包下载链接（仅大文件）
-	ZipSize          *int64   `json:"zipSize,omitempty"`          // ZIP文件大小（仅大文件）
-	CompressionRatio *float64 `json:"compressionRatio,omitempty"` // 压缩率（仅大文件）
+	GifURL           string           `json:"gifUrl"` // 输出文件URL，非GIF格式同样使用该字段
+	Format           string           `json:"format"` // 输出格式: gif/webp/apng/avif
+	FileSize         int64            `json:"fileSize"`
+	Duration         float64          `json:"duration"`
+	VideoDuration    float64          `json:"videoDuration"`
+	ZipURL           *string          `json:"zipUrl,omitempty"`           // ZIP压缩包下载链接（仅大文件）
+	ZipSize          *int64           `json:"zipSize,omitempty"`          // ZIP文件大小（仅大文件）
+	CompressionRatio *float64         `json:"compressionRatio,omitempty"` // 压缩率（仅大文件）
+	TargetSize       *TargetSizeInfo  `json:"targetSize,omitempty"`       // 目标大小模式的搜索结果
+	Transform        *VideoTransform  `json:"transform,omitempty"`        // 实际应用的画面变换
+	Optimization     *GifOptimizeInfo `json:"optimization,omitempty"`     // GIF优化结果
+	Preset           *Preset          `json:"preset,omitempty"`           // GIF使用的预设
+	Segments         []PaletteSegment `json:"segments,omitempty"`         // 场景自适应调色板的分段
+	Cached           bool             `json:"cached,omitempty"`           // 命中转换缓存，直接返回已有结果
+}
+
+// SessionInfo 匿名会话信息
+type SessionInfo struct {
+	ID    string `json:"id"`
+	Token string `json:"token"` // 签名令牌，可通过Authorization: Bearer携带
+}
+
+// UploadResponse 视频上传结果
+type UploadResponse struct {
+	Hash    string `json:"hash"` // 文件内容的SHA-256，转换等接口通过videoHash参数引用
+	Size    int64  `json:"size"`
+	Existed bool   `json:"existed"` // 相同内容的文件已存在，未重复保存
+}
+
+// GifOptimizeInfo GIF优化前后对比
+type GifOptimizeInfo struct {
+	OriginalSize   int64   `json:"originalSize"`
+	OptimizedSize  int64   `json:"optimizedSize"`
+	SavedPercent   float64 `json:"savedPercent"` // 减小的百分比
+	OriginalFrames int     `json:"originalFrames"`
+	Frames         int     `json:"frames"` // 合并重复帧后的帧数
+	Lossy          int     `json:"lossy"`
+}
+
+// TargetSizeInfo 目标大小模式最终采用的参数
+type TargetSizeInfo struct {
+	TargetSizeBytes int64  `json:"targetSizeBytes"`
+	Attempts        int    `json:"attempts"` // 编码尝试次数
+	Width           int    `json:"width"`
+	FPS             int    `json:"fps"`
+	MaxColors       int    `json:"maxColors"`
+	Dither          string `json:"dither"`
+}
+
+// JobInfo 异步任务信息
+type JobInfo struct {
+	ID         string              `json:"id"`
+	Type       string              `json:"type"`
+	Status     string              `json:"status"` // queued/running/succeeded/failed/cancelled
+	Result     interface{}         `json:"result,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	Progress   *ConversionProgress `json:"progress,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	StartedAt  *time.Time          `json:"startedAt,omitempty"`
+	FinishedAt *time.Time          `json:"finishedAt,omitempty"`
+}
+
+// ConversionProgress 转换进度
+type ConversionProgress struct {
+	Phase   string  `json:"phase"`   // queued: 排队等待, prepare: 素材预处理, palette: 调色板生成, encode: GIF编码, optimize: GIF优化
+	Step    int     `json:"step"`    // 当前阶段序号，从1开始
+	Steps   int     `json:"steps"`   // 总阶段数
+	Percent float64 `json:"percent"` // 当前阶段完成百分比
+	FPS     float64 `json:"fps"`     // 当前处理速度(帧/秒)
+	ETA     float64 `json:"eta"`     // 当前阶段预计剩余秒数
+	// 排队等待编码资源时的位置，从1开始
+	QueuePosition int `json:"queuePosition,omitempty"`
+	// 目标大小模式下的第几次编码尝试
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// MediaInfo 媒体文件信息，由ffprobe JSON输出解析
+type MediaInfo struct {
+	Container  string        `json:"container"`  // 容器格式，如 mov,mp4,m4a,3gp,3g2,mj2
+	Duration   float64       `json:"duration"`   // 时长(秒)，无法确定时为0
+	Size       int64         `json:"size"`       // 文件大小(字节)
+	BitRate    int64         `json:"bitRate"`    // 总码率(bit/s)
+	VideoCodec string        `json:"videoCodec"` // 主视频流编码
+	Width      int           `json:"width"`      // 按旋转信息校正后的显示宽度
+	Height     int           `json:"height"`     // 按旋转信息校正后的显示高度
+	Rotation   int           `json:"rotation"`   // 旋转角度(0/90/180/270)
+	FrameRate  float64       `json:"frameRate"`  // 主视频流平均帧率
+	HasAudio   bool          `json:"hasAudio"`
+	Streams    []MediaStream `json:"streams"`
+	VideoHash  string        `json:"videoHash,omitempty"` // 上传视频的SHA-256，后续请求可用videoHash引用
+}
+
+// MediaStream 媒体流信息
+type MediaStream struct {
+	Index      int     `json:"index"`
+	Type       string  `json:"type"` // video/audio/subtitle/data
+	Codec      string  `json:"codec"`
+	Duration   float64 `json:"duration,omitempty"`
+	BitRate    int64   `json:"bitRate,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FrameRate  float64 `json:"frameRate,omitempty"`
+	PixFmt     string  `json:"pixFmt,omitempty"`
+	SampleRate int     `json:"sampleRate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+}
+
+// ThumbnailsRequest 视频缩略图请求参数
+type ThumbnailsRequest struct {
+	Count          *int     `form:"count"`          // 缩略图数量，默认10
+	Mode           string   `form:"mode"`           // interval(默认，均匀间隔) / scene(场景切换)
+	SceneThreshold *float64 `form:"sceneThreshold"` // 场景切换阈值，默认0.3
+	Width          *int     `form:"width"`          // 缩略图宽度，默认160
+	Format         string   `form:"format"`         // jpeg(默认) / webp
+	Columns        *int     `form:"columns"`        // 雪碧图列数，默认10
+}
+
+// ThumbnailsResponse 视频缩略图响应
+type ThumbnailsResponse struct {
+	Mode          string          `json:"mode"`
+	Format        string          `json:"format"`
+	VideoDuration float64         `json:"videoDuration"`
+	Width         int             `json:"width"`  // 单张缩略图宽度
+	Height        int             `json:"height"` // 单张缩略图高度
+	Columns       int             `json:"columns"`
+	Rows          int             `json:"rows"`
+	SpriteURL     string          `json:"spriteUrl"`
+	Thumbnails    []ThumbnailItem `json:"thumbnails"`
+	VideoHash     string          `json:"videoHash,omitempty"` // 上传视频的SHA-256
+}
+
+// ThumbnailItem 单张缩略图及其在雪碧图中的位置
+type ThumbnailItem struct {
+	Index     int     `json:"index"`
+	Timestamp float64 `json:"timestamp"` // 在原视频中的时间(秒)
+	URL       string  `json:"url"`
+	X         int     `json:"x"` // 在雪碧图中的左上角坐标
+	Y         int     `json:"y"`
+}
+
+// ImagesToGifRequest 图片序列转GIF请求参数，图片通过images字段上传多个文件
+type ImagesToGifRequest struct {
+	Delays     string   `form:"delays"`     // 每帧显示时长(毫秒)，JSON数组，与图片一一对应
+	FPS        *float64 `form:"fps"`        // 未指定delays时使用的统一帧率，默认10
+	Width      *int     `form:"width"`      // 画布宽度，默认按第一张图片计算
+	Height     *int     `form:"height"`     // 画布高度，默认按第一张图片计算
+	Fit        string   `form:"fit"`        // fit(透明留白) / fill(铺满裁剪) / pad(背景色留白，默认)
+	Background string   `form:"background"` // pad模式背景色 #RRGGBB，默认#FFFFFF
+	Loop       *int     `form:"loop"`       // 0无限循环(默认)，-1不循环，N额外重复N次
+	Quality    string   `form:"quality"`    // 预设名称，默认medium
+}
+
+// ImagesToGifResponse 图片序列转GIF结果
+type ImagesToGifResponse struct {
+	GifURL     string  `json:"gifUrl"`
+	FileSize   int64   `json:"fileSize"`
+	FrameCount int     `json:"frameCount"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Duration   float64 `json:"duration"` // 播放一遍的时长(秒)
+	Loop       int     `json:"loop"`
+}
+
+// FrameExportRequest 帧导出请求参数
+type FrameExportRequest struct {
+	StartTime *float64 `form:"startTime"`
+	Duration  *float64 `form:"duration"`
+	FPS       *float64 `form:"fps"`    // 导出帧率，视频默认10，GIF默认保留原始帧
+	Width     *int     `form:"width"`  // 输出宽度，默认保持原始尺寸
+	Format    string   `form:"format"` // png(默认) / jpeg
 }
 
-// ConversionHistoryItem 转换历史记录项
+// FrameExportResponse 帧导出结果
+type FrameExportResponse struct {
+	ZipURL     string  `json:"zipUrl"`
+	ZipSize    int64   `json:"zipSize"`
+	Source     string  `json:"source"` // video / gif
+	Format     string  `json:"format"`
+	FPS        float64 `json:"fps"` // 0表示保留原始帧
+	FrameCount int     `json:"frameCount"`
+	Truncated  bool    `json:"truncated"` // 是否因超过帧数上限被截断
+}
+
+// FrameManifest ZIP中manifest.json的内容
+type FrameManifest struct {
+	Source    string              `json:"source"`
+	Format    string              `json:"format"`
+	FPS       float64             `json:"fps"`
+	StartTime float64             `json:"startTime"`
+	Duration  float64             `json:"duration"`
+	Frames    []FrameManifestItem `json:"frames"`
+}
+
+// FrameManifestItem 单帧信息
+type FrameManifestItem struct {
+	Index     int     `json:"index"`
+	File      string  `json:"file"`
+	Timestamp float64 `json:"timestamp"` // 在源文件中的时间(秒)
+	Delay     float64 `json:"delay"`     // 显示时长(秒)
+}
+
+// ConversionHistoryItem 转换历史记录项，输出文件已被清理时gifUrl为空、expired为true
 type ConversionHistoryItem struct {
-	ID        string    `json:"id"`
-	Filename  string    `json:"filename"`
-	GifURL    string    `json:"gifUrl"`
-	FileSize  int64     `json:"fileSize"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID             string            `json:"id"`
+	Filename       string            `json:"filename"`
+	GifURL         string            `json:"gifUrl"`
+	Format         string            `json:"format"`
+	FileSize       int64             `json:"fileSize"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	JobID          string            `json:"jobId,omitempty"`
+	SourceFilename string            `json:"sourceFilename,omitempty"`
+	InputSize      int64             `json:"inputSize,omitempty"`
+	Preset         string            `json:"preset,omitempty"`
+	Params         *ConversionParams `json:"params,omitempty"`
+	ZipURL         string            `json:"zipUrl,omitempty"`
+	ZipSize        int64             `json:"zipSize,omitempty"`
+	StartTime      float64           `json:"startTime"`
+	Duration       float64           `json:"duration"`
+	VideoDuration  float64           `json:"videoDuration,omitempty"`
+	Cached         bool              `json:"cached,omitempty"`
+	Status         string            `json:"status"`
+	Error          string            `json:"error,omitempty"`
+	FinishedAt     *time.Time        `json:"finishedAt,omitempty"`
+	ExpiresAt      *time.Time        `json:"expiresAt,omitempty"`
+	Expired        bool              `json:"expired"`
+}
+
+// ConversionParams 转换记录中保存的转换参数
+type ConversionParams struct {
+	Width           int             `json:"width"`
+	Preset          *Preset         `json:"preset,omitempty"`
+	TargetSizeBytes int64           `json:"targetSizeBytes,omitempty"`
+	Optimize        bool            `json:"optimize"`
+	Lossy           int             `json:"lossy,omitempty"`
+	Transform       *VideoTransform `json:"transform,omitempty"`
+	Captions        int             `json:"captions,omitempty"` // 文字字幕条数
+	Subtitles       bool            `json:"subtitles,omitempty"`
+	Watermark       bool            `json:"watermark,omitempty"`
+}
+
+// ConversionHistoryQuery 转换历史查询参数
+type ConversionHistoryQuery struct {
+	Page     int    `form:"page"`     // 页码，从1开始
+	PageSize int    `form:"pageSize"` // 每页条数，默认20，最多100
+	Format   string `form:"format"`   // gif/webp/apng/avif
+	Status   string `form:"status"`   // queued/running/succeeded/failed/cancelled
+	Since    string `form:"since"`    // 起始时间，RFC3339或YYYY-MM-DD
+	Until    string `form:"until"`    // 截止时间（不含），RFC3339或YYYY-MM-DD
+}
+
+// ConversionHistoryResponse 分页的转换历史
+type ConversionHistoryResponse struct {
+	Items    []ConversionHistoryItem `json:"items"`
+	Total    int64                   `json:"total"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
 }
 
 // VisitorStats 访问统计
@@ -49,3 +363,61 @@ type VisitorRecord struct {
 	UserAgent string    `json:"userAgent"`
 	Timestamp time.Time `json:"timestamp"`
 }
+
+// GifToVideoRequest 动画转视频请求参数，动画通过gif字段上传
+type GifToVideoRequest struct {
+	Format string `form:"format"` // mp4(H.264，默认) / webm(VP9)
+	CRF    *int   `form:"crf"`    // 恒定质量参数，mp4为0-51(默认23)，webm为0-63(默认32)
+	Repeat *int   `form:"repeat"` // 额外重复播放的次数，默认0
+	Width  *int   `form:"width"`  // 输出宽度，默认保持原始尺寸
+}
+
+// GifToVideoResponse 动画转视频结果
+type GifToVideoResponse struct {
+	VideoURL     string  `json:"videoUrl"`
+	Format       string  `json:"format"`
+	FileSize     int64   `json:"fileSize"`
+	OriginalSize int64   `json:"originalSize"`
+	SizeRatio    float64 `json:"sizeRatio"` // 视频大小占原文件大小的百分比
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	Duration     float64 `json:"duration"` // 视频总时长(秒)，包含重复播放
+	Repeat       int     `json:"repeat"`
+}
+
+// GifEditRequest GIF编辑请求参数，通过gif字段上传文件，或用source指定历史记录中的GIF
+type GifEditRequest struct {
+	Source  string   `form:"source"`  // 历史记录中的文件名
+	Crop    string   `form:"crop"`    // 裁剪区域，JSON格式的CropRect（原始画布坐标）
+	Width   *int     `form:"width"`   // 输出宽度，只指定宽高之一时按比例计算
+	Height  *int     `form:"height"`  // 输出高度
+	Drop    string   `form:"drop"`    // 删除的帧区间，如"0-4,10"，帧序号从0开始
+	Delays  string   `form:"delays"`  // 每帧延迟(毫秒)，JSON数组，与删除帧、倒放后的输出帧一一对应
+	Speed   *float64 `form:"speed"`   // 播放速度 0.25-4
+	Loop    *int     `form:"loop"`    // 0无限循环，-1不循环，N额外重复N次，默认保持原设置
+	Reverse bool     `form:"reverse"` // 倒放
+}
+
+// GifEditResponse GIF编辑结果
+type GifEditResponse struct {
+	GifURL       string  `json:"gifUrl"`
+	FileSize     int64   `json:"fileSize"`
+	OriginalSize int64   `json:"originalSize"`
+	FrameCount   int     `json:"frameCount"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	Duration     float64 `json:"duration"` // 播放一遍的时长(秒)
+	Loop         int     `json:"loop"`
+}
+
+// GifOptimizeRequest GIF优化请求参数，通过gif字段上传文件，或用source指定历史记录中的GIF
+type GifOptimizeRequest struct {
+	Source string `form:"source"` // 历史记录中的文件名
+	Lossy  *int   `form:"lossy"`  // 有损优化强度 0-200，默认0（无损）
+}
+
+// GifOptimizeResponse GIF优化结果
+type GifOptimizeResponse struct {
+	GifURL string `json:"gifUrl"`
+	GifOptimizeInfo
+}
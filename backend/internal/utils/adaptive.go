@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// 场景分段限制，过多或过短的分段会增加局部调色板体积且没有明显画质收益
+const (
+	maxPaletteSegments = 8
+	minSegmentDuration = 1.0
+)
+
+// sceneScorePattern metadata=print输出的场景切换帧时间和得分，两项分两行输出
+var sceneScorePattern = regexp.MustCompile(`\bpts_time:\s*([0-9.]+)[^\n]*\n[^\n]*lavfi\.scene_score=([0-9.]+)`)
+
+// sceneCut 检测到的场景切换点
+type sceneCut struct {
+	time  float64
+	score float64
+}
+
+// ConvertVideoToGifAdaptive 检测场景切换后分段，每段单独生成调色板再拼接编码为GIF，返回各段的起止时间
+// 画面在不同场景间差异较大时，单一全局调色板会出现明显色带，分段调色板可以避免；没有场景切换时与普通调色板模式相同
+func (f *FFmpegService) ConvertVideoToGifAdaptive(ctx context.Context, inputPath, outputPath string, startTime, duration float64, params PaletteParams, threshold float64) ([]models.PaletteSegment, error) {
+	const steps = 3
+	input := inputArgs(inputPath, startTime, duration)
+	chain := f.videoFilterChain(scaleFpsFilter(params))
+	total := f.outputDuration(duration)
+
+	cuts, err := f.detectScenes(ctx, input, chain, threshold, total)
+	if err != nil {
+		return nil, err
+	}
+	segments := sceneSegments(cuts, total)
+
+	if len(segments) == 1 {
+		err := f.encodeWithPalette(ctx, outputPath, params, paletteEncode{
+			input:    input,
+			chain:    chain,
+			duration: total,
+			step:     2,
+			steps:    steps,
+		})
+		return segments, err
+	}
+
+	// 第二步：一次解码生成每段的调色板
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	palettes := make([]string, len(segments))
+	for i := range segments {
+		palettes[i] = fmt.Sprintf("%s_palette%d.png", base, i)
+		defer os.Remove(palettes[i])
+	}
+
+	var graph strings.Builder
+	graph.WriteString("[0:v]" + chain + splitFilter("s", len(segments)))
+	for i, segment := range segments {
+		fmt.Fprintf(&graph, ";[s%d]%s,%s[p%d]", i, trimFilter(segment, i == len(segments)-1), palettegenFilter(params), i)
+	}
+	paletteArgs := append([]string{}, input...)
+	paletteArgs = append(paletteArgs, "-y", "-filter_complex", graph.String())
+	for i, palette := range palettes {
+		paletteArgs = append(paletteArgs, "-map", fmt.Sprintf("[p%d]", i), palette)
+	}
+
+	if output, err := f.runFFmpeg(ctx, paletteArgs, "palette", 2, steps, total); err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("palette generation error: %v, output: %s", err, string(output))
+	}
+
+	// 第三步：每段使用各自的调色板编码后拼接，调色板不同的帧写入局部调色板
+	graph.Reset()
+	graph.WriteString("[0:v]" + chain + splitFilter("v", len(segments)))
+	for i, segment := range segments {
+		fmt.Fprintf(&graph, ";[v%d]%s,setpts=PTS-STARTPTS[t%d];[t%d][%d:v]%s[g%d]",
+			i, trimFilter(segment, i == len(segments)-1), i, i, i+1, paletteuseFilter(params), i)
+	}
+	graph.WriteString(";")
+	for i := range segments {
+		fmt.Fprintf(&graph, "[g%d]", i)
+	}
+	fmt.Fprintf(&graph, "concat=n=%d:v=1:a=0[out]", len(segments))
+
+	gifArgs := append([]string{}, input...)
+	for _, palette := range palettes {
+		gifArgs = append(gifArgs, "-i", palette)
+	}
+	gifArgs = append(gifArgs, "-y", "-filter_complex", graph.String(), "-map", "[out]", "-loop", "0", outputPath)
+
+	if output, err := f.runFFmpeg(ctx, gifArgs, "encode", 3, steps, total); err != nil {
+		os.Remove(outputPath) // 清理写了一半的输出文件
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("gif generation error: %v, output: %s", err, string(output))
+	}
+	return segments, nil
+}
+
+// detectScenes 在缩放和画面处理后的画面上检测场景切换，时间基于输出时间轴
+func (f *FFmpegService) detectScenes(ctx context.Context, input []string, chain string, threshold, duration float64) ([]sceneCut, error) {
+	args := append([]string{}, input...)
+	args = append(args,
+		"-vf", fmt.Sprintf("%s,select='gt(scene,%.3f)',metadata=print:key=lavfi.scene_score", chain, threshold),
+		"-an", "-f", "null", "-",
+	)
+
+	output, err := f.runFFmpeg(ctx, args, "prepare", 1, 3, duration)
+	if err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("场景检测失败: %v, output: %s", err, string(output))
+	}
+
+	var cuts []sceneCut
+	for _, m := range sceneScorePattern.FindAllSubmatch(output, -1) {
+		t, _ := strconv.ParseFloat(string(m[1]), 64)
+		score, _ := strconv.ParseFloat(string(m[2]), 64)
+		cuts = append(cuts, sceneCut{time: t, score: score})
+	}
+	return cuts, nil
+}
+
+// sceneSegments 按场景切换点分段，优先保留得分高的切换点，每段不短于minSegmentDuration，最多maxPaletteSegments段
+func sceneSegments(cuts []sceneCut, duration float64) []models.PaletteSegment {
+	sort.SliceStable(cuts, func(i, j int) bool { return cuts[i].score > cuts[j].score })
+
+	var selected []float64
+	for _, cut := range cuts {
+		if len(selected) >= maxPaletteSegments-1 {
+			break
+		}
+		if cut.time < minSegmentDuration || cut.time > duration-minSegmentDuration {
+			continue
+		}
+		tooClose := false
+		for _, t := range selected {
+			if math.Abs(t-cut.time) < minSegmentDuration {
+				tooClose = true
+				break
+			}
+		}
+		if !tooClose {
+			selected = append(selected, cut.time)
+		}
+	}
+	sort.Float64s(selected)
+
+	segments := make([]models.PaletteSegment, 0, len(selected)+1)
+	start := 0.0
+	for _, t := range append(selected, duration) {
+		segments = append(segments, models.PaletteSegment{
+			Start: math.Round(start*1000) / 1000,
+			End:   math.Round(t*1000) / 1000,
+		})
+		start = t
+	}
+	return segments
+}
+
+// splitFilter 将画面复制为n路，输出标签为prefix加序号
+func splitFilter(prefix string, n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ",split=%d", n)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "[%s%d]", prefix, i)
+	}
+	return b.String()
+}
+
+// trimFilter 截取分段，第一段不设开始时间，最后一段不设结束时间，避免时间取整丢帧
+func trimFilter(segment models.PaletteSegment, last bool) string {
+	var opts []string
+	if segment.Start > 0 {
+		opts = append(opts, fmt.Sprintf("start=%.3f", segment.Start))
+	}
+	if !last {
+		opts = append(opts, fmt.Sprintf("end=%.3f", segment.End))
+	}
+	return "trim=" + strings.Join(opts, ":")
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"log"
+	"sync"
+)
+
+// ArtifactStore 文件归属存储，记录上传、输出和压缩文件由哪些会话创建
+// 文件按名称登记（上传为"<摘要>.<扩展名>"，可续传上传为上传ID，输出为输出目录中的文件名）；
+// 相同内容的上传和命中缓存的转换结果是同一个文件，可以同时属于多个会话
+type ArtifactStore interface {
+	// Claim 将文件登记到会话名下，重复登记不报错
+	Claim(owner, name string) error
+	// Owns 会话是否拥有该文件
+	Owns(owner, name string) bool
+	// Release 解除会话对文件的归属，返回仍拥有该文件的会话数
+	Release(owner, name string) (int, error)
+	// Forget 文件已被删除，清除其全部归属
+	Forget(name string) error
+}
+
+var artifactStore ArtifactStore = NewMemoryArtifactStore()
+
+// SetArtifactStore 设置全局文件归属存储，数据库可用时使用数据库存储
+func SetArtifactStore(store ArtifactStore) {
+	artifactStore = store
+}
+
+// Artifacts 获取全局文件归属存储
+func Artifacts() ArtifactStore {
+	return artifactStore
+}
+
+// MemoryArtifactStore 内存中的文件归属存储，服务重启后归属丢失
+type MemoryArtifactStore struct {
+	mu     sync.RWMutex
+	owners map[string]map[string]struct{} // 文件名 -> 会话集合
+}
+
+// NewMemoryArtifactStore 创建内存文件归属存储
+func NewMemoryArtifactStore() *MemoryArtifactStore {
+	return &MemoryArtifactStore{owners: make(map[string]map[string]struct{})}
+}
+
+// Claim 将文件登记到会话名下
+func (s *MemoryArtifactStore) Claim(owner, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.owners[name] == nil {
+		s.owners[name] = make(map[string]struct{})
+	}
+	s.owners[name][owner] = struct{}{}
+	return nil
+}
+
+// Owns 会话是否拥有该文件
+func (s *MemoryArtifactStore) Owns(owner, name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.owners[name][owner]
+	return ok
+}
+
+// Release 解除会话对文件的归属
+func (s *MemoryArtifactStore) Release(owner, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.owners[name], owner)
+	remaining := len(s.owners[name])
+	if remaining == 0 {
+		delete(s.owners, name)
+	}
+	return remaining, nil
+}
+
+// Forget 清除文件的全部归属
+func (s *MemoryArtifactStore) Forget(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.owners, name)
+	return nil
+}
+
+// conversionOutputs 未连接数据库时登记的转换记录输出文件，扫描输出目录生成历史记录时只列出这些文件
+// 文件被清理或删除时一并清除
+var conversionOutputs sync.Map
+
+// MarkConversionOutput 登记转换记录的输出文件
+func MarkConversionOutput(name string) {
+	if name != "" {
+		conversionOutputs.Store(name, struct{}{})
+	}
+}
+
+// IsConversionOutput 文件是否为转换记录的输出文件
+func IsConversionOutput(name string) bool {
+	_, ok := conversionOutputs.Load(name)
+	return ok
+}
+
+// ForgetConversionOutput 输出文件已被删除，清除登记
+func ForgetConversionOutput(name string) {
+	conversionOutputs.Delete(name)
+}
+
+// ClaimArtifacts 将多个文件登记到会话名下，空文件名跳过；登记失败只记录日志，不影响已生成的文件
+func ClaimArtifacts(owner string, names ...string) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := artifactStore.Claim(owner, name); err != nil {
+			log.Printf("登记文件归属失败 %s: %v", name, err)
+		}
+	}
+}
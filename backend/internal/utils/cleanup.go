@@ -4,9 +4,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
+// OutputRetention 输出文件的保留时间，超过后由定时清理删除
+const OutputRetention = 12 * time.Hour
+
 // CleanupService 文件清理服务
 type CleanupService struct {
 	uploadsDir string
@@ -37,31 +41,50 @@ func (cs *CleanupService) StartCleanupRoutine() {
 func (cs *CleanupService) CleanupOldFiles() {
 	log.Println("开始清理过期文件...")
 
-	// 清理超过24小时的上传文件
-	cs.cleanupDirectory(cs.uploadsDir, 24*time.Hour)
+	// 清理超过24小时的上传文件，未完成的可续传上传按各自的过期时间清理
+	cs.cleanupDirectory(cs.uploadsDir, 24*time.Hour, TusDir)
 
 	// 清理超过12小时的输出文件
-	cs.cleanupDirectory(cs.outputDir, 12*time.Hour)
+	cs.cleanupDirectory(cs.outputDir, OutputRetention)
 
 	log.Println("文件清理完成")
 }
 
-// cleanupDirectory 清理指定目录中的过期文件
-func (cs *CleanupService) cleanupDirectory(dir string, maxAge time.Duration) {
+// cleanupDirectory 清理指定目录中的过期文件，skipDirs中的子目录以及进行中的任务正在使用的文件和目录不清理
+func (cs *CleanupService) cleanupDirectory(dir string, maxAge time.Duration, skipDirs ...string) {
+	// 按绝对路径比较，skipDirs与dir可能一个是相对路径一个是绝对路径
+	skip := make([]string, len(skipDirs))
+	for i, skipDir := range skipDirs {
+		skip[i] = absPath(skipDir)
+	}
+
+	var subDirs []string
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// 跳过目录
+		// 跳过目录，记录子目录以便清理后删除空目录
 		if info.IsDir() {
+			if path != dir && (slices.Contains(skip, absPath(path)) || uploadInUse(path)) {
+				return filepath.SkipDir
+			}
+			if path != dir {
+				subDirs = append(subDirs, path)
+			}
 			return nil
 		}
 
 		// 检查文件年龄
-		if time.Since(info.ModTime()) > maxAge {
+		if time.Since(info.ModTime()) > maxAge && !uploadInUse(path) {
 			log.Printf("删除过期文件: %s", path)
-			os.Remove(path)
+			if os.Remove(path) == nil {
+				// 归属按相对目录的路径登记，子目录中的文件（如缩略图）包含目录前缀
+				if rel, err := filepath.Rel(dir, path); err == nil {
+					artifactStore.Forget(filepath.ToSlash(rel))
+					ForgetConversionOutput(filepath.ToSlash(rel))
+				}
+			}
 		}
 
 		return nil
@@ -70,6 +93,13 @@ func (cs *CleanupService) cleanupDirectory(dir string, maxAge time.Duration) {
 	if err != nil {
 		log.Printf("清理目录 %s 时出错: %v", dir, err)
 	}
+
+	// 由深到浅删除已清空的子目录（如缩略图目录），非空目录删除失败会被忽略
+	for i := len(subDirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(subDirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(subDirs[i])
+		}
+	}
 }
 
 // GetDiskUsage 获取磁盘使用情况
@@ -104,12 +134,13 @@ func (cs *CleanupService) getDirSize(path string) (int64, error) {
 	return size, err
 }
 
-// ForceCleanup 强制清理所有临时文件
+// ForceCleanup 强制清理临时文件，进行中的任务正在使用的文件不清理
 func (cs *CleanupService) ForceCleanup() error {
 	log.Println("执行强制清理...")
 
-	// 清理所有上传文件
-	cs.cleanupDirectory(cs.uploadsDir, 0)
+	// 保留最近1小时使用过的上传文件，通过videoHash或uploadId引用时会刷新修改时间
+	// 未完成的可续传上传仍按各自的过期时间清理
+	cs.cleanupDirectory(cs.uploadsDir, 1*time.Hour, TusDir)
 
 	// 保留最近1小时的输出文件
 	cs.cleanupDirectory(cs.outputDir, 1*time.Hour)
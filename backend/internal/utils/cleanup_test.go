@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCleanupForgetsNestedArtifacts 清理子目录中的文件时按相对路径清除归属
+func TestCleanupForgetsNestedArtifacts(t *testing.T) {
+	previous := artifactStore
+	t.Cleanup(func() { SetArtifactStore(previous) })
+	SetArtifactStore(NewMemoryArtifactStore())
+
+	outputDir := t.TempDir()
+	nested := filepath.Join(outputDir, "thumbnails", "abc")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * OutputRetention)
+	for _, file := range []string{filepath.Join(outputDir, "a.gif"), filepath.Join(nested, "thumb_001.jpg")} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, old, old)
+	}
+	ClaimArtifacts("owner", "a.gif", "thumbnails/abc/thumb_001.jpg")
+
+	NewCleanupService(t.TempDir(), outputDir).CleanupOldFiles()
+
+	for _, name := range []string{"a.gif", "thumbnails/abc/thumb_001.jpg"} {
+		if Artifacts().Owns("owner", name) {
+			t.Errorf("%s still claimed after cleanup", name)
+		}
+	}
+	if _, err := os.Stat(nested); !os.IsNotExist(err) {
+		t.Errorf("empty thumbnail directory not removed: %v", err)
+	}
+}
+
+// TestForceCleanupKeepsTusUploads 强制清理不删除未完成的可续传上传
+func TestForceCleanupKeepsTusUploads(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(TusDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("output", 0755); err != nil {
+		t.Fatal(err)
+	}
+	upload := filepath.Join(UploadDir, "video.mp4")
+	partial := filepath.Join(TusDir, "partial.bin")
+	old := time.Now().Add(-2 * time.Hour)
+	for _, file := range []string{upload, partial} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, old, old)
+	}
+
+	// 上传目录使用绝对路径时也要跳过可续传上传目录
+	uploadsDir, err := filepath.Abs(UploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCleanupService(uploadsDir, "output").ForceCleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("upload not removed: %v", err)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("tus upload removed by force cleanup: %v", err)
+	}
+}
+
+// TestForceCleanupKeepsUploadsInUse 强制清理不删除进行中的任务正在使用的文件和最近使用过的上传
+func TestForceCleanupKeepsUploadsInUse(t *testing.T) {
+	t.Chdir(t.TempDir())
+	workDir := filepath.Join(UploadDir, "frames123")
+	for _, dir := range []string{workDir, "output"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := filepath.Join(UploadDir, "input.mp4")
+	frame := filepath.Join(workDir, "frame_001.png")
+	recent := filepath.Join(UploadDir, "recent.mp4")
+	stale := filepath.Join(UploadDir, "stale.mp4")
+	old := time.Now().Add(-2 * time.Hour)
+	for _, file := range []string{input, frame, recent, stale} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if file != recent {
+			os.Chtimes(file, old, old)
+		}
+	}
+
+	release := RetainUploads(input, workDir)
+	if err := NewCleanupService(UploadDir, "output").ForceCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{input, frame, recent} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s removed by force cleanup: %v", file, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale upload not removed: %v", err)
+	}
+
+	release()
+	release() // 重复调用无副作用
+	if err := NewCleanupService(UploadDir, "output").ForceCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(input); !os.IsNotExist(err) {
+		t.Errorf("released upload not removed: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConversionCache 转换结果缓存，以输入文件摘要和规范化后的转换参数为键
+// 结果引用的输出文件被清理后对应条目失效，超过容量时淘汰最久未使用的条目
+type ConversionCache struct {
+	mu        sync.Mutex
+	capacity  int
+	outputDir string
+	entries   map[string]*list.Element
+	order     *list.List // 最近使用的条目在前
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	key    string
+	result interface{}
+	files  []string // 结果引用的输出文件名
+}
+
+var conversionCache = NewConversionCache(500, "output")
+
+// InitConversionCache 初始化全局转换结果缓存，capacity为0时不缓存
+func InitConversionCache(capacity int, outputDir string) {
+	conversionCache = NewConversionCache(capacity, outputDir)
+}
+
+// GetConversionCache 获取全局转换结果缓存
+func GetConversionCache() *ConversionCache {
+	return conversionCache
+}
+
+// NewConversionCache 创建转换结果缓存
+func NewConversionCache(capacity int, outputDir string) *ConversionCache {
+	return &ConversionCache{
+		capacity:  max(capacity, 0),
+		outputDir: outputDir,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// ConversionCacheKey 根据输入文件摘要和转换参数计算缓存键，params序列化为JSON后参与摘要
+func ConversionCacheKey(inputHash string, params interface{}) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(inputHash))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Get 查找缓存结果，输出文件已不存在时删除条目；命中时刷新输出文件的修改时间以推迟清理
+func (cc *ConversionCache) Get(key string) (interface{}, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	element, ok := cc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+
+	now := time.Now()
+	for _, name := range entry.files {
+		if err := os.Chtimes(filepath.Join(cc.outputDir, name), now, now); err != nil {
+			cc.order.Remove(element)
+			delete(cc.entries, key)
+			return nil, false
+		}
+	}
+
+	cc.order.MoveToFront(element)
+	return entry.result, true
+}
+
+// Put 保存转换结果，files为结果引用的输出文件名
+func (cc *ConversionCache) Put(key string, result interface{}, files ...string) {
+	if cc.capacity == 0 || key == "" {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if element, ok := cc.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, result: result, files: files}
+		cc.order.MoveToFront(element)
+		return
+	}
+
+	cc.entries[key] = cc.order.PushFront(&cacheEntry{key: key, result: result, files: files})
+	for cc.order.Len() > cc.capacity {
+		oldest := cc.order.Back()
+		cc.order.Remove(oldest)
+		delete(cc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len 当前缓存条目数
+func (cc *ConversionCache) Len() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.order.Len()
+}
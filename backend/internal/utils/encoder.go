@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+)
+
+// 编码器名称
+const (
+	EncoderAuto   = "auto"
+	EncoderFFmpeg = "ffmpeg"
+	EncoderGo     = "go"
+)
+
+// ErrFFmpegUnavailable 服务器未安装ffmpeg/ffprobe
+var ErrFFmpegUnavailable = errors.New("服务器未安装FFmpeg")
+
+// Encoder GIF编码器，ffmpeg可用时使用FFmpegService，否则使用纯Go实现
+type Encoder interface {
+	// Name 编码器名称
+	Name() string
+	// SetProgressCallback 设置进度回调
+	SetProgressCallback(fn ProgressFunc)
+	// ConvertImagesToGif 将多张图片统一到相同画布后编码为GIF
+	ConvertImagesToGif(ctx context.Context, imagePaths []string, outputPath string, opts ImageSequenceOptions) error
+}
+
+// 启动时检测的编码能力
+var (
+	ffmpegAvailable bool
+	encoderName     = EncoderGo
+	// ffmpegDecoders 本机ffmpeg支持的解码器，为nil时表示未能获取
+	ffmpegDecoders map[string]bool
+)
+
+// animationDecoders 动画格式对应的ffmpeg解码器，任一可用即可解码
+var animationDecoders = map[string][]string{
+	FormatGIF:  {"gif"},
+	FormatAPNG: {"apng"},
+	FormatAVIF: {"libdav1d", "libaom-av1", "av1"},
+}
+
+// InitEncoder 检测ffmpeg和ffprobe是否可用并选择默认编码器
+// preferred为auto时优先使用ffmpeg；指定ffmpeg但未安装时回退到纯Go编码器
+func InitEncoder(preferred string) {
+	_, ffmpegErr := defaultRunner.LookPath("ffmpeg")
+	_, ffprobeErr := defaultRunner.LookPath("ffprobe")
+	ffmpegAvailable = ffmpegErr == nil && ffprobeErr == nil
+	ffmpegDecoders = nil
+	if ffmpegAvailable {
+		ffmpegDecoders = detectDecoders(defaultRunner)
+	}
+
+	switch {
+	case preferred == EncoderGo:
+		encoderName = EncoderGo
+	case ffmpegAvailable:
+		encoderName = EncoderFFmpeg
+	default:
+		encoderName = EncoderGo
+		log.Printf("FFmpeg未安装，图片序列转GIF使用纯Go编码器，视频相关功能不可用")
+	}
+}
+
+// detectDecoders 通过ffmpeg -decoders获取支持的解码器名称，失败时返回nil
+func detectDecoders(runner CommandRunner) map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), ffprobeTimeout)
+	defer cancel()
+	var stdout bytes.Buffer
+	if err := runner.Run(ctx, "ffmpeg", []string{"-hide_banner", "-decoders"}, &stdout, io.Discard); err != nil {
+		log.Printf("获取FFmpeg解码器列表失败: %v", err)
+		return nil
+	}
+
+	// 每行格式为"标志 名称 描述"，列表从"------"分隔行之后开始
+	decoders := make(map[string]bool)
+	listed := false
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) > 0 && strings.HasPrefix(fields[0], "---"):
+			listed = true
+		case listed && len(fields) >= 2:
+			decoders[fields[1]] = true
+		}
+	}
+	if len(decoders) == 0 {
+		log.Printf("FFmpeg解码器列表为空")
+		return nil
+	}
+	for format, names := range animationDecoders {
+		if !decodable(decoders, names) {
+			log.Printf("FFmpeg不支持解码%s，动画转视频不接受该格式", strings.ToUpper(format))
+		}
+	}
+	return decoders
+}
+
+// FFmpegDecodes 本机ffmpeg是否能解码该动画格式，未能获取解码器列表时视为支持，由转换时的错误提示
+func FFmpegDecodes(format string) bool {
+	names, ok := animationDecoders[format]
+	if !ok || !ffmpegAvailable {
+		return false
+	}
+	return ffmpegDecoders == nil || decodable(ffmpegDecoders, names)
+}
+
+// decodable 判断解码器中是否有任一可用
+func decodable(decoders map[string]bool, names []string) bool {
+	for _, name := range names {
+		if decoders[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// FFmpegAvailable 服务器是否安装了ffmpeg和ffprobe
+func FFmpegAvailable() bool {
+	return ffmpegAvailable
+}
+
+// EncoderName 当前默认编码器名称
+func EncoderName() string {
+	return encoderName
+}
+
+// NewEncoder 创建默认编码器实例
+func NewEncoder() Encoder {
+	if encoderName == EncoderFFmpeg {
+		return NewFFmpegService(defaultRunner)
+	}
+	return NewGoEncoder()
+}
+
+// Name 编码器名称
+func (f *FFmpegService) Name() string {
+	return EncoderFFmpeg
+}
@@ -1,295 +1,374 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"toGif-backend/internal/models"
+)
+
+var (
+	// ErrFFmpegTimeout ffmpeg/ffprobe执行超时
+	ErrFFmpegTimeout = errors.New("处理超时")
+	// ErrFFmpegCancelled ffmpeg/ffprobe执行被取消
+	ErrFFmpegCancelled = errors.New("处理已取消")
 )
 
+// 单次ffmpeg/ffprobe调用的超时时间
+var (
+	ffmpegTimeout  = 10 * time.Minute
+	ffprobeTimeout = 30 * time.Second
+)
+
+// InitFFmpegTimeouts 设置ffmpeg和ffprobe单次调用的超时时间
+func InitFFmpegTimeouts(ffmpeg, ffprobe time.Duration) {
+	if ffmpeg > 0 {
+		ffmpegTimeout = ffmpeg
+	}
+	if ffprobe > 0 {
+		ffprobeTimeout = ffprobe
+	}
+}
+
+// ProgressFunc 转换进度回调
+type ProgressFunc func(progress models.ConversionProgress)
+
 // FFmpegService FFmpeg服务
-type FFmpegService struct{}
+type FFmpegService struct {
+	runner     CommandRunner
+	onProgress ProgressFunc
+	filters    VideoFilters
+}
 
-// NewFFmpegService 创建FFmpeg服务实例
-func NewFFmpegService() *FFmpegService {
-	return &FFmpegService{}
+// NewFFmpegService 创建FFmpeg服务实例，ffmpeg/ffprobe通过runner执行
+func NewFFmpegService(runner CommandRunner) *FFmpegService {
+	return &FFmpegService{runner: runner}
 }
 
-// ConvertVideoToGif 将视频转换为GIF
-func (f *FFmpegService) ConvertVideoToGif(inputPath, outputPath string, startTime, duration float64, width int, quality string) error {
-	// 使用最兼容的FFmpeg命令来生成GIF
-	args := []string{
-		"-i", inputPath,
-		"-y", // 覆盖输出文件
-	}
+// SetProgressCallback 设置转换进度回调
+func (f *FFmpegService) SetProgressCallback(fn ProgressFunc) {
+	f.onProgress = fn
+}
 
-	// 开始时间
+// SetVideoFilters 设置转换时应用的画面处理（变换、字幕、水印等）
+func (f *FFmpegService) SetVideoFilters(filters VideoFilters) {
+	f.filters = filters
+}
+
+// inputArgs 构建输入参数，起止时间作为输入选项以便变速、倒放只处理所选片段
+func inputArgs(inputPath string, startTime, duration float64) []string {
+	var args []string
 	if startTime > 0 {
 		args = append(args, "-ss", fmt.Sprintf("%.2f", startTime))
 	}
-
-	// 持续时间
 	if duration > 0 {
 		args = append(args, "-t", fmt.Sprintf("%.2f", duration))
 	}
+	return append(args, "-i", inputPath)
+}
 
-	// 优化文件大小的参数设置 - 尊重用户的宽度设置，添加超高质量选项
-	var fps, scale string
-	switch quality {
-	case "ultra": // 超高质量 - 优先画质，文件大小可以大些
-		fps = "20" // 高帧率
-		if width > 0 {
-			scale = fmt.Sprintf("scale=%d:-2:flags=lanczos", width) // 使用用户设置的宽度
-		} else {
-			scale = "scale=720:-2:flags=lanczos" // 更高的默认分辨率
-		}
-	case "high": // 高质量 - 提升效果，使用更好的参数
-		fps = "12" // 提升帧率
-		if width > 0 {
-			scale = fmt.Sprintf("scale=%d:-2:flags=lanczos", width) // 使用lanczos缩放算法
-		} else {
-			scale = "scale=600:-2:flags=lanczos" // 提升默认分辨率
-		}
-	case "medium": // 中质量 - 使用原来高质量的逻辑
-		fps = "8" // 使用原来高质量的帧率
-		if width > 0 {
-			scale = fmt.Sprintf("scale=%d:-2", width) // 使用用户设置的宽度
-		} else {
-			scale = "scale=480:-2" // 使用原来高质量的默认宽度
-		}
-	case "low":
-		fps = "4"
-		if width > 0 {
-			scale = fmt.Sprintf("scale=%d:-2", width) // 使用用户设置的宽度
-		} else {
-			scale = "scale=240:-2"
-		}
-	default:
-		fps = "8" // 使用原来高质量的帧率作为默认
-		if width > 0 {
-			scale = fmt.Sprintf("scale=%d:-2", width) // 使用用户设置的宽度
-		} else {
-			scale = "scale=480:-2" // 使用原来高质量的默认宽度
-		}
-	}
-
-	// 使用最简单的滤镜来最小化文件大小
-	filterStr := fmt.Sprintf("fps=%s,%s", fps, scale)
-	args = append(args, "-vf", filterStr)
-
-	// 简单的GIF输出参数
-	args = append(args, outputPath)
+// videoFilterChain 在缩放/帧率滤镜前后加上画面处理滤镜，结果为单输入单输出的滤镜链
+func (f *FFmpegService) videoFilterChain(scaleFps string) string {
+	return f.filters.chain(scaleFps)
+}
 
-	// 执行FFmpeg命令
-	cmd := exec.Command("ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("ffmpeg error: %v, output: %s", err, string(output))
-	}
+// outputDuration 应用画面处理后的输出时长，用于计算进度
+func (f *FFmpegService) outputDuration(duration float64) float64 {
+	return TransformedDuration(f.filters.Transform, duration)
+}
 
-	return nil
+// PaletteParams 调色板模式GIF转换参数
+type PaletteParams struct {
+	Width              int    // 输出宽度
+	FPS                int    // 帧率
+	Scaler             string // 缩放算法，为空使用lanczos
+	MaxColors          int    // 调色板颜色数(2-256)
+	ReserveTransparent bool   // 是否在调色板中保留透明色
+	StatsMode          string // palettegen统计模式: full/diff/single，为空使用默认值
+	Dither             string // paletteuse抖动方式
 }
 
-// ConvertVideoToGifWithPalette 使用调色板优化的高质量GIF转换
-func (f *FFmpegService) ConvertVideoToGifWithPalette(inputPath, outputPath string, startTime, duration float64, width int, quality string) error {
-	// 第一步：生成调色板
-	paletteFile := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "_palette.png"
-	defer os.Remove(paletteFile) // 清理临时调色板文件
+// ConvertVideoToGifWithParams 使用指定参数进行两遍调色板GIF转换
+func (f *FFmpegService) ConvertVideoToGifWithParams(ctx context.Context, inputPath, outputPath string, startTime, duration float64, params PaletteParams) error {
+	return f.encodeWithPalette(ctx, outputPath, params, paletteEncode{
+		input:    inputArgs(inputPath, startTime, duration),
+		chain:    f.videoFilterChain(scaleFpsFilter(params)),
+		duration: f.outputDuration(duration),
+		step:     1,
+		steps:    2,
+	})
+}
 
-	// 构建调色板生成命令
-	paletteArgs := []string{
-		"-i", inputPath,
-		"-y",
+// scaleFpsFilter 缩放和帧率滤镜
+func scaleFpsFilter(params PaletteParams) string {
+	scaler := params.Scaler
+	if scaler == "" {
+		scaler = "lanczos"
 	}
+	return fmt.Sprintf("scale=%d:-2:flags=%s,fps=%d", params.Width, scaler, params.FPS)
+}
 
-	// 时间参数
-	if startTime > 0 {
-		paletteArgs = append(paletteArgs, "-ss", fmt.Sprintf("%.2f", startTime))
+// palettegenFilter 生成调色板的滤镜
+func palettegenFilter(params PaletteParams) string {
+	reserveTransparent := 0
+	if params.ReserveTransparent {
+		reserveTransparent = 1
 	}
-	if duration > 0 {
-		paletteArgs = append(paletteArgs, "-t", fmt.Sprintf("%.2f", duration))
+	palettegen := fmt.Sprintf("palettegen=max_colors=%d:reserve_transparent=%d", params.MaxColors, reserveTransparent)
+	if params.StatsMode != "" {
+		palettegen += ":stats_mode=" + params.StatsMode
 	}
+	return palettegen
+}
 
-	// 调色板滤镜 - 根据质量优化设置
-	var paletteFilters []string
-	if width > 0 {
-		paletteFilters = append(paletteFilters, fmt.Sprintf("scale=%d:-2:flags=lanczos", width))
-	} else {
-		// 超高质量使用更高的默认分辨率
-		if quality == "ultra" {
-			paletteFilters = append(paletteFilters, "scale=720:-2:flags=lanczos")
-		} else {
-			paletteFilters = append(paletteFilters, "scale=480:-2:flags=lanczos")
-		}
+// paletteuseFilter 使用调色板编码的滤镜，single统计模式下每帧使用各自的调色板
+func paletteuseFilter(params PaletteParams) string {
+	paletteuse := "paletteuse=dither=" + params.Dither
+	if params.StatsMode == "single" {
+		paletteuse += ":new=1"
 	}
+	return paletteuse
+}
 
-	// 根据质量设置不同的参数
-	var fps string
-	switch quality {
-	case "ultra": // 超高质量 - 最佳画质设置
-		fps = "25"
-		paletteFilters = append(paletteFilters, fmt.Sprintf("fps=%s", fps), "palettegen=max_colors=256:reserve_transparent=0:stats_mode=diff")
-	case "high": // 高质量 - 提升效果
-		fps = "18"                                                                                                                             // 提升帧率
-		paletteFilters = append(paletteFilters, fmt.Sprintf("fps=%s", fps), "palettegen=max_colors=192:reserve_transparent=0:stats_mode=diff") // 增加颜色数和统计模式
-	case "medium": // 中质量 - 使用原来高质量的参数
-		fps = "15"                                                                                                             // 使用原来高质量的帧率
-		paletteFilters = append(paletteFilters, fmt.Sprintf("fps=%s", fps), "palettegen=max_colors=128:reserve_transparent=0") // 使用原来高质量的设置
-	case "low":
-		fps = "8"
-		paletteFilters = append(paletteFilters, fmt.Sprintf("fps=%s", fps), "palettegen=max_colors=32")
-	default:
-		fps = "15"                                                                                                             // 使用原来高质量的帧率作为默认
-		paletteFilters = append(paletteFilters, fmt.Sprintf("fps=%s", fps), "palettegen=max_colors=128:reserve_transparent=0") // 使用原来高质量的设置
+// paletteEncode 两遍调色板编码的输入和进度阶段
+type paletteEncode struct {
+	input    []string // 输入参数
+	chain    string   // 生成调色板和编码前应用的滤镜链，为空时直接使用输入画面
+	output   []string // 附加的输出参数
+	loop     int      // GIF循环次数，0为无限循环，-1为不循环
+	duration float64  // 输出时长，用于计算进度
+	step     int      // 调色板生成所处的阶段序号，编码为下一阶段
+	steps    int      // 总阶段数
+}
+
+// encodeWithPalette 先用palettegen生成调色板，再用paletteuse编码GIF
+func (f *FFmpegService) encodeWithPalette(ctx context.Context, outputPath string, params PaletteParams, enc paletteEncode) error {
+	// 第一步：生成调色板
+	paletteFile := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "_palette.png"
+	defer os.Remove(paletteFile) // 清理临时调色板文件
+
+	palettegen := palettegenFilter(params)
+	if enc.chain != "" {
+		palettegen = enc.chain + "," + palettegen
 	}
 
-	paletteArgs = append(paletteArgs, "-vf", strings.Join(paletteFilters, ","))
-	paletteArgs = append(paletteArgs, paletteFile)
+	paletteArgs := append([]string{}, enc.input...)
+	paletteArgs = append(paletteArgs, "-y", "-vf", palettegen, paletteFile)
 
 	// 生成调色板
-	cmd := exec.Command("ffmpeg", paletteArgs...)
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := f.runFFmpeg(ctx, paletteArgs, "palette", enc.step, enc.steps, enc.duration); err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return err
+		}
 		return fmt.Errorf("palette generation error: %v, output: %s", err, string(output))
 	}
 
 	// 第二步：使用调色板生成GIF
-	gifArgs := []string{
-		"-i", inputPath,
-		"-i", paletteFile,
-		"-y",
+	filterComplex := "[0:v][1:v]" + paletteuseFilter(params)
+	if enc.chain != "" {
+		filterComplex = fmt.Sprintf("[0:v]%s[v];[v][1:v]%s", enc.chain, paletteuseFilter(params))
 	}
 
-	// 时间参数
-	if startTime > 0 {
-		gifArgs = append(gifArgs, "-ss", fmt.Sprintf("%.2f", startTime))
-	}
-	if duration > 0 {
-		gifArgs = append(gifArgs, "-t", fmt.Sprintf("%.2f", duration))
-	}
+	gifArgs := append([]string{}, enc.input...)
+	gifArgs = append(gifArgs, "-i", paletteFile, "-y")
+	gifArgs = append(gifArgs, "-filter_complex", filterComplex)
+	gifArgs = append(gifArgs, enc.output...)
+	gifArgs = append(gifArgs, "-loop", strconv.Itoa(enc.loop))
+	gifArgs = append(gifArgs, outputPath)
 
-	// GIF生成滤镜 - 根据质量优化
-	var gifFilters []string
-	if width > 0 {
-		gifFilters = append(gifFilters, fmt.Sprintf("scale=%d:-2:flags=lanczos", width))
-	} else {
-		// 根据质量设置不同的默认分辨率
-		switch quality {
-		case "ultra":
-			gifFilters = append(gifFilters, "scale=720:-2:flags=lanczos")
-		case "high":
-			gifFilters = append(gifFilters, "scale=600:-2:flags=lanczos") // 提升高质量的默认分辨率
-		default:
-			gifFilters = append(gifFilters, "scale=480:-2:flags=lanczos")
+	// 生成GIF
+	if output, err := f.runFFmpeg(ctx, gifArgs, "encode", enc.step+1, enc.steps, enc.duration); err != nil {
+		os.Remove(outputPath) // 清理写了一半的输出文件
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return err
 		}
+		return fmt.Errorf("gif generation error: %v, output: %s", err, string(output))
 	}
-	gifFilters = append(gifFilters, fmt.Sprintf("fps=%s", fps))
-
-	// 根据质量选择抖动方式
-	var ditherType string
-	switch quality {
-	case "ultra": // 超高质量 - 最佳抖动算法
-		ditherType = "floyd_steinberg"
-	case "high": // 高质量 - 提升抖动效果
-		ditherType = "floyd_steinberg" // 使用最佳抖动算法
-	case "medium": // 中质量 - 使用原来高质量的设置
-		ditherType = "bayer:bayer_scale=2" // 使用原来高质量的抖动设置
-	case "low":
-		ditherType = "none" // 最小文件大小
+
+	return nil
+}
+
+// ConvertVideoToAnimation 将视频转换为WebP/APNG/AVIF动画，帧率和画质由预设参数决定，width不大于0时使用预设的默认宽度
+func (f *FFmpegService) ConvertVideoToAnimation(ctx context.Context, inputPath, outputPath string, startTime, duration float64, width int, preset models.Preset, format string) error {
+	args := inputArgs(inputPath, startTime, duration)
+	args = append(args, "-y")
+
+	q := animationQuality(format, preset)
+	if width <= 0 {
+		width = preset.Width
+	}
+	args = append(args, "-vf", f.videoFilterChain(fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", q.fps, width)), "-an")
+
+	// 各格式的编码参数
+	switch format {
+	case FormatWebP:
+		args = append(args,
+			"-c:v", "libwebp_anim",
+			"-lossless", "0",
+			"-quality", strconv.Itoa(q.quality),
+			"-compression_level", "6",
+			"-loop", "0",
+			"-f", "webp",
+		)
+	case FormatAPNG:
+		args = append(args,
+			"-c:v", "apng",
+			"-pred", "mixed",
+			"-plays", "0",
+			"-f", "apng",
+		)
+	case FormatAVIF:
+		args = append(args,
+			"-c:v", "libaom-av1",
+			"-crf", strconv.Itoa(q.quality),
+			"-b:v", "0",
+			"-cpu-used", "6",
+			"-row-mt", "1",
+			"-pix_fmt", "yuv420p",
+			"-loop", "0",
+			"-f", "avif",
+		)
 	default:
-		ditherType = "bayer:bayer_scale=2" // 使用原来高质量的抖动设置作为默认
+		return fmt.Errorf("unsupported output format: %s", format)
 	}
 
-	filterComplex := fmt.Sprintf("[0:v]%s[v];[v][1:v]paletteuse=dither=%s", strings.Join(gifFilters, ","), ditherType)
-	gifArgs = append(gifArgs, "-filter_complex", filterComplex)
-	gifArgs = append(gifArgs, "-loop", "0")
-	gifArgs = append(gifArgs, outputPath)
+	args = append(args, outputPath)
 
-	// 生成GIF
-	cmd = exec.Command("ffmpeg", gifArgs...)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("gif generation error: %v, output: %s", err, string(output))
+	if output, err := f.runFFmpeg(ctx, args, "encode", 1, 1, f.outputDuration(duration)); err != nil {
+		os.Remove(outputPath) // 清理写了一半的输出文件
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return err
+		}
+		return fmt.Errorf("ffmpeg error: %v, output: %s", err, string(output))
 	}
 
 	return nil
 }
 
-// GetVideoDuration 获取视频时长
-func (f *FFmpegService) GetVideoDuration(inputPath string) (float64, error) {
-	// 尝试多种方法获取视频时长
-
-	// 方法1: 使用format=duration
-	cmd := exec.Command("ffprobe", "-v", "quiet", "-show_entries", "format=duration", "-of", "csv=p=0", inputPath)
-	output, err := cmd.Output()
-	if err == nil {
-		durationStr := strings.TrimSpace(string(output))
-		if durationStr != "" && durationStr != "N/A" {
-			duration, parseErr := strconv.ParseFloat(durationStr, 64)
-			if parseErr == nil && duration > 0 {
-				return duration, nil
-			}
-		}
+// newCommand 创建受context控制的命令，取消或超时时结束整个进程组
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	// 进程被结束后最多再等待5秒读取输出
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// contextError 将context的结束原因转换为超时或取消错误，context未结束时返回原错误
+func contextError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrFFmpegTimeout
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ErrFFmpegCancelled
 	}
+	return err
+}
 
-	// 方法2: 使用stream=duration
-	cmd = exec.Command("ffprobe", "-v", "quiet", "-show_entries", "stream=duration", "-of", "csv=p=0", inputPath)
-	output, err = cmd.Output()
-	if err == nil {
-		durationStr := strings.TrimSpace(string(output))
-		lines := strings.Split(durationStr, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && line != "N/A" {
-				duration, parseErr := strconv.ParseFloat(line, 64)
-				if parseErr == nil && duration > 0 {
-					return duration, nil
-				}
-			}
-		}
+// runFFmpeg 执行ffmpeg命令，通过 -progress pipe:1 解析进度，返回ffmpeg的日志输出
+func (f *FFmpegService) runFFmpeg(ctx context.Context, args []string, phase string, step, steps int, duration float64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, ffmpegTimeout)
+	defer cancel()
+
+	fullArgs := append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+
+	var stderr bytes.Buffer
+	stdout, progress := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.parseProgress(stdout, phase, step, steps, duration)
+	}()
+
+	err := f.runner.Run(ctx, "ffmpeg", fullArgs, progress, &stderr)
+	progress.Close()
+	<-done
+
+	if err != nil {
+		return stderr.Bytes(), contextError(ctx, err)
+	}
+	return stderr.Bytes(), nil
+}
+
+// parseProgress 解析ffmpeg -progress输出的key=value块并回调进度
+func (f *FFmpegService) parseProgress(r io.Reader, phase string, step, steps int, duration float64) {
+	start := time.Now()
+	progress := models.ConversionProgress{
+		Phase: phase,
+		Step:  step,
+		Steps: steps,
 	}
+	var outTime, speed float64
 
-	// 方法3: 使用mediainfo格式（如果前面都失败）
-	cmd = exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", inputPath)
-	output, err = cmd.Output()
-	if err == nil {
-		// 简单解析JSON中的duration字段
-		outputStr := string(output)
-		if idx := strings.Index(outputStr, `"duration"`); idx != -1 {
-			remaining := outputStr[idx:]
-			if colonIdx := strings.Index(remaining, ":"); colonIdx != -1 {
-				remaining = remaining[colonIdx+1:]
-				if commaIdx := strings.Index(remaining, ","); commaIdx != -1 {
-					durationStr := strings.Trim(remaining[:commaIdx], ` "`)
-					duration, parseErr := strconv.ParseFloat(durationStr, 64)
-					if parseErr == nil && duration > 0 {
-						return duration, nil
-					}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_ms", "out_time_us":
+			// ffmpeg的out_time_ms实际单位也是微秒
+			if us, err := strconv.ParseFloat(value, 64); err == nil && us > 0 {
+				outTime = us / 1e6
+			}
+		case "fps":
+			if fps, err := strconv.ParseFloat(value, 64); err == nil {
+				progress.FPS = fps
+			}
+		case "speed":
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+				speed = v
+			}
+		case "progress":
+			// 每个进度块以progress=continue/end结束
+			if value == "end" {
+				progress.Percent = 100
+				progress.ETA = 0
+			} else if duration > 0 {
+				progress.Percent = min(outTime/duration*100, 99.9)
+				remaining := duration - outTime
+				if speed > 0 {
+					progress.ETA = remaining / speed
+				} else if outTime > 0 {
+					progress.ETA = time.Since(start).Seconds() / outTime * remaining
 				}
 			}
+			if f.onProgress != nil {
+				f.onProgress(progress)
+			}
 		}
 	}
 
-	// 如果所有方法都失败，返回默认值
-	return 10.0, fmt.Errorf("无法获取视频时长，使用默认值10秒")
+	// 读取完剩余输出，避免ffmpeg写管道阻塞
+	io.Copy(io.Discard, r)
 }
 
 // CheckFFmpegInstallation 检查FFmpeg是否安装
 func (f *FFmpegService) CheckFFmpegInstallation() error {
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
+	if _, err := f.runner.LookPath("ffmpeg"); err != nil {
 		return fmt.Errorf("ffmpeg not found: %v", err)
 	}
-	if _, err := exec.LookPath("ffprobe"); err != nil {
+	if _, err := f.runner.LookPath("ffprobe"); err != nil {
 		return fmt.Errorf("ffprobe not found: %v", err)
 	}
 	return nil
 }
 
-// GenerateUniqueFilename 生成唯一文件名
+// GenerateUniqueFilename 生成以随机标识命名的文件名
 func GenerateUniqueFilename(extension string) string {
-	timestamp := time.Now().Unix()
-	return fmt.Sprintf("%d.%s", timestamp, extension)
+	return NewID() + "." + extension
 }
 
 // GetFileSize 获取文件大小
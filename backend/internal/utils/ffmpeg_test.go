@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils/utilstest"
+)
+
+// argAfter 返回参数列表中flag之后的值
+func argAfter(t *testing.T, args []string, flag string) string {
+	t.Helper()
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		t.Fatalf("missing %s in %v", flag, args)
+	}
+	return args[i+1]
+}
+
+func TestConvertVideoToGifWithParamsPresets(t *testing.T) {
+	for _, preset := range builtinPresets {
+		t.Run(preset.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			output := filepath.Join(dir, "out.gif")
+			runner := &utilstest.FakeRunner{}
+			params := PresetPaletteParams(preset, 0)
+
+			err := NewFFmpegService(runner).ConvertVideoToGifWithParams(context.Background(), "in.mp4", output, 1.5, 3, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := runner.Calls()
+			if len(calls) != 2 {
+				t.Fatalf("got %d ffmpeg calls, want 2 (palette + encode)", len(calls))
+			}
+			palette, encode := calls[0].Args, calls[1].Args
+
+			for _, args := range [][]string{palette, encode} {
+				if argAfter(t, args, "-ss") != "1.50" || argAfter(t, args, "-t") != "3.00" || argAfter(t, args, "-i") != "in.mp4" {
+					t.Errorf("input args = %v", args)
+				}
+			}
+
+			scale := "scale=" + strconv.Itoa(preset.Width) + ":-2:flags=" + preset.Scaler + ",fps=" + strconv.Itoa(preset.FPS)
+			vf := argAfter(t, palette, "-vf")
+			if !strings.HasPrefix(vf, scale+",palettegen=max_colors="+strconv.Itoa(preset.MaxColors)) {
+				t.Errorf("palette filter = %q, want prefix %q", vf, scale)
+			}
+			if preset.StatsMode != "" && !strings.Contains(vf, "stats_mode="+preset.StatsMode) {
+				t.Errorf("palette filter = %q, want stats_mode=%s", vf, preset.StatsMode)
+			}
+			reserve := "reserve_transparent=0"
+			if preset.ReserveTransparent {
+				reserve = "reserve_transparent=1"
+			}
+			if !strings.Contains(vf, reserve) {
+				t.Errorf("palette filter = %q, want %s", vf, reserve)
+			}
+
+			complex := argAfter(t, encode, "-filter_complex")
+			if !strings.Contains(complex, scale) || !strings.Contains(complex, "paletteuse=dither="+preset.Dither) {
+				t.Errorf("encode filter = %q", complex)
+			}
+			if argAfter(t, encode, "-loop") != "0" {
+				t.Errorf("encode loop = %q, want 0", argAfter(t, encode, "-loop"))
+			}
+			if encode[len(encode)-1] != output {
+				t.Errorf("encode output = %q, want %q", encode[len(encode)-1], output)
+			}
+			if _, err := os.Stat(output); err != nil {
+				t.Errorf("output not written: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out_palette.png")); !os.IsNotExist(err) {
+				t.Errorf("palette file not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestConvertVideoToAnimationQualities(t *testing.T) {
+	tests := []struct {
+		format string
+		codec  string
+		// 质量参数名，APNG没有质量参数
+		qualityFlag string
+	}{
+		{FormatWebP, "libwebp_anim", "-quality"},
+		{FormatAPNG, "apng", ""},
+		{FormatAVIF, "libaom-av1", "-crf"},
+	}
+
+	for _, tt := range tests {
+		for _, preset := range builtinPresets {
+			t.Run(tt.format+"/"+preset.Name, func(t *testing.T) {
+				output := filepath.Join(t.TempDir(), "out."+OutputExtension(tt.format))
+				runner := &utilstest.FakeRunner{}
+
+				err := NewFFmpegService(runner).ConvertVideoToAnimation(context.Background(), "in.mp4", output, 0, 2, 320, preset, tt.format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				calls := runner.Calls()
+				if len(calls) != 1 {
+					t.Fatalf("got %d ffmpeg calls, want 1", len(calls))
+				}
+				args := calls[0].Args
+				q := animationQuality(tt.format, preset)
+
+				if got := argAfter(t, args, "-c:v"); got != tt.codec {
+					t.Errorf("codec = %q, want %q", got, tt.codec)
+				}
+				if got := argAfter(t, args, "-f"); got != tt.format {
+					t.Errorf("muxer = %q, want %q", got, tt.format)
+				}
+				if vf := argAfter(t, args, "-vf"); !strings.Contains(vf, "fps="+strconv.Itoa(q.fps)+",scale=320:-2") {
+					t.Errorf("filter = %q, want fps=%d and width 320", vf, q.fps)
+				}
+				if tt.qualityFlag != "" && argAfter(t, args, tt.qualityFlag) != strconv.Itoa(q.quality) {
+					t.Errorf("%s = %q, want %d", tt.qualityFlag, argAfter(t, args, tt.qualityFlag), q.quality)
+				}
+				if slices.Contains(args, "-ss") {
+					t.Errorf("unexpected -ss for zero start time: %v", args)
+				}
+				if args[len(args)-1] != output {
+					t.Errorf("output = %q, want %q", args[len(args)-1], output)
+				}
+			})
+		}
+	}
+}
+
+// mediumPreset 获取内置的medium预设
+func mediumPreset(t *testing.T) models.Preset {
+	t.Helper()
+	preset, ok := LookupPreset("medium")
+	if !ok {
+		t.Fatal("medium preset not found")
+	}
+	return preset
+}
+
+func TestConvertVideoToAnimationUnsupportedFormat(t *testing.T) {
+	runner := &utilstest.FakeRunner{}
+	err := NewFFmpegService(runner).ConvertVideoToAnimation(context.Background(), "in.mp4", "out.mkv", 0, 2, 320, mediumPreset(t), "mkv")
+	if err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+	if len(runner.Calls()) != 0 {
+		t.Errorf("ffmpeg should not run for unsupported format")
+	}
+}
+
+func TestConvertFailureRemovesOutput(t *testing.T) {
+	runner := &utilstest.FakeRunner{Err: errors.New("exit status 1"), Stderr: "Invalid data found when processing input"}
+	output := filepath.Join(t.TempDir(), "out.webp")
+	os.WriteFile(output, []byte("partial"), 0644)
+
+	err := NewFFmpegService(runner).ConvertVideoToAnimation(context.Background(), "in.mp4", output, 0, 2, 320, mediumPreset(t), FormatWebP)
+	if err == nil || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Fatalf("err = %v, want ffmpeg stderr in error", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("partial output not removed")
+	}
+
+	err = NewFFmpegService(runner).ConvertVideoToGifWithParams(context.Background(), "in.mp4", output, 0, 2, PresetPaletteParams(builtinPresets[0], 0))
+	if err == nil || !strings.Contains(err.Error(), "palette generation error") {
+		t.Fatalf("err = %v, want palette generation error", err)
+	}
+}
+
+func TestConvertCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := NewFFmpegService(&utilstest.FakeRunner{}).ConvertVideoToAnimation(ctx, "in.mp4", filepath.Join(t.TempDir(), "out.webp"), 0, 2, 320, mediumPreset(t), FormatWebP)
+	if !errors.Is(err, ErrFFmpegCancelled) {
+		t.Fatalf("err = %v, want ErrFFmpegCancelled", err)
+	}
+}
+
+func TestProbeMediaWithFakeRunner(t *testing.T) {
+	info, err := NewFFmpegService(&utilstest.FakeRunner{}).ProbeMedia(context.Background(), "in.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 640 || info.Height != 360 || info.Duration != 5 {
+		t.Errorf("info = %+v, want 640x360 5s", info)
+	}
+}
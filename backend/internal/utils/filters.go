@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// VideoFilters 转换时应用的画面处理
+// 变换在缩放和帧率滤镜之前应用（裁剪使用原始视频坐标），字幕和水印在缩放之后应用（按输出尺寸排版）
+// 字幕文件在几何变换之后、时间变换之前烧录，字幕时间轴与原始片段一致，文字不会被翻转
+type VideoFilters struct {
+	Transform *models.VideoTransform
+	Subtitles string // 已平移时间轴的字幕文件路径
+	Captions  []CaptionFilter
+	Watermark *WatermarkFilter
+}
+
+// Files 滤镜使用的字幕、文字和水印文件
+func (v VideoFilters) Files() []string {
+	var files []string
+	if v.Subtitles != "" {
+		files = append(files, v.Subtitles)
+	}
+	for _, caption := range v.Captions {
+		files = append(files, caption.TextFile)
+	}
+	if v.Watermark != nil {
+		files = append(files, v.Watermark.Path)
+	}
+	return files
+}
+
+// chain 组装完整的滤镜链
+func (v VideoFilters) chain(scaleFps string) string {
+	geometry, timing := transformFilterChain(v.Transform)
+	var parts []string
+	for _, part := range []string{geometry, v.subtitlesFilter(), timing, scaleFps} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	chain := strings.Join(parts, ",")
+	for _, caption := range v.Captions {
+		chain += "," + caption.filter()
+	}
+	if v.Watermark != nil {
+		// 水印通过movie源滤镜读取，保持滤镜链单输入单输出，标准模式和调色板模式可以共用
+		chain += v.Watermark.filter()
+	}
+	return chain
+}
+
+// subtitlesFilter 生成字幕文件烧录滤镜，未上传字幕时为空
+func (v VideoFilters) subtitlesFilter() string {
+	if v.Subtitles == "" {
+		return ""
+	}
+	return subtitlesFilter(v.Subtitles)
+}
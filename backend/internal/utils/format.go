@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// 支持的动画输出格式
+const (
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+	FormatAPNG = "apng"
+	FormatAVIF = "avif"
+)
+
+// formatQuality 非GIF输出格式的编码参数
+type formatQuality struct {
+	fps     int
+	quality int // webp: 0-100质量，avif: crf(越小越好)，apng: 无损不使用
+}
+
+// IsSupportedOutputFormat 检查输出格式是否受支持
+func IsSupportedOutputFormat(format string) bool {
+	switch format {
+	case FormatGIF, FormatWebP, FormatAPNG, FormatAVIF:
+		return true
+	}
+	return false
+}
+
+// OutputExtension 获取输出格式对应的文件扩展名，APNG使用.png以便浏览器直接识别
+func OutputExtension(format string) string {
+	if format == FormatAPNG {
+		return "png"
+	}
+	return format
+}
+
+// AnimationExtensions 所有动画输出文件的扩展名
+func AnimationExtensions() []string {
+	return []string{".gif", ".webp", ".png", ".avif"}
+}
+
+// FormatFromExtension 根据文件扩展名推断动画格式
+func FormatFromExtension(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".gif"):
+		return FormatGIF
+	case strings.HasSuffix(lower, ".webp"):
+		return FormatWebP
+	case strings.HasSuffix(lower, ".png"):
+		return FormatAPNG
+	case strings.HasSuffix(lower, ".avif"):
+		return FormatAVIF
+	}
+	return ""
+}
+
+// DetectAnimationFormat 根据文件签名识别动画格式，无法识别时返回空字符串
+func DetectAnimationFormat(filePath string) string {
+	for _, format := range []string{FormatGIF, FormatWebP, FormatAPNG, FormatAVIF} {
+		if IsValidAnimationFile(filePath, format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// animationQuality 根据预设的帧率和调色板颜色数计算非GIF格式的编码参数，GIF沿用调色板参数
+// 颜色数越多画质越高：WebP质量50-90，AVIF crf 45-20；APNG为无损编码，帧率降为预设的3/4以控制文件大小
+func animationQuality(format string, p models.Preset) formatQuality {
+	level := min(max(float64(p.MaxColors-2)/254, 0), 1)
+	q := formatQuality{fps: max(p.FPS, 1)}
+	switch format {
+	case FormatWebP:
+		q.quality = 50 + int(math.Round(40*level))
+	case FormatAPNG:
+		q.fps = max(p.FPS*3/4, 1)
+	case FormatAVIF:
+		q.quality = 45 - int(math.Round(25*level))
+	}
+	return q
+}
+
+// IsValidAnimationFile 按格式校验输出文件签名
+func IsValidAnimationFile(filePath, format string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.Size() <= 100 {
+		// 有效的动画文件至少应该有几百字节
+		return false
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+
+	switch format {
+	case FormatGIF:
+		return bytes.HasPrefix(header, []byte("GIF87a")) || bytes.HasPrefix(header, []byte("GIF89a"))
+	case FormatWebP:
+		// RIFF????WEBP，动画WebP包含VP8X扩展头
+		return bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")) &&
+			bytes.Equal(header[12:16], []byte("VP8X"))
+	case FormatAPNG:
+		pngSignature := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+		if !bytes.Equal(header[0:8], pngSignature) {
+			return false
+		}
+		return hasAPNGControlChunk(file)
+	case FormatAVIF:
+		// ISO BMFF: ftyp盒子，主品牌为avif(静态)或avis(序列)
+		return bytes.Equal(header[4:8], []byte("ftyp")) &&
+			(bytes.Equal(header[8:12], []byte("avis")) || bytes.Equal(header[8:12], []byte("avif")))
+	}
+	return false
+}
+
+// IsGIFFile 通过文件签名检查是否为GIF图片
+func IsGIFFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 6)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, []byte("GIF87a")) || bytes.Equal(header, []byte("GIF89a"))
+}
+
+// ImageFormat 通过文件签名识别静态图片格式，返回png/jpeg/webp，无法识别时返回空字符串
+func ImageFormat(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return ""
+	}
+
+	switch {
+	case bytes.Equal(header[0:8], []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}):
+		return "png"
+	case bytes.Equal(header[0:3], []byte{0xff, 0xd8, 0xff}):
+		return "jpeg"
+	case bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return "webp"
+	}
+	return ""
+}
+
+// hasAPNGControlChunk 检查PNG在第一个IDAT之前是否含有acTL块（即为动画PNG）
+func hasAPNGControlChunk(file *os.File) bool {
+	if _, err := file.Seek(8, io.SeekStart); err != nil {
+		return false
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunkHeader); err != nil {
+			return false
+		}
+		length := binary.BigEndian.Uint32(chunkHeader[0:4])
+		chunkType := string(chunkHeader[4:8])
+		switch chunkType {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+		// 跳过块数据和CRC
+		if _, err := file.Seek(int64(length)+4, io.SeekCurrent); err != nil {
+			return false
+		}
+	}
+}
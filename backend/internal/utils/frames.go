@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// 帧导出格式
+const (
+	FramePNG  = "png"
+	FrameJPEG = "jpeg"
+)
+
+// FrameExportOptions 帧导出参数
+type FrameExportOptions struct {
+	FPS       float64 // 导出帧率，0表示保留原始帧（适用于GIF）
+	Width     int     // 输出宽度，0表示保持原始尺寸
+	Format    string  // png/jpeg
+	MaxFrames int     // 最多导出的帧数
+}
+
+// ExtractedFrame 导出的单帧
+type ExtractedFrame struct {
+	Path      string
+	Timestamp float64 // 相对片段开始的时间(秒)
+	Delay     float64 // 该帧的显示时长(秒)
+}
+
+// showinfo滤镜日志中的帧时长
+var showinfoDurationPattern = regexp.MustCompile(`\bduration_time:\s*([0-9.]+)`)
+
+// FrameExtension 帧文件扩展名
+func FrameExtension(format string) string {
+	if format == FrameJPEG {
+		return "jpg"
+	}
+	return "png"
+}
+
+// ExtractFrames 将视频片段或GIF拆分为编号的图片序列，帧时间和时长从showinfo滤镜日志中读取
+// duration为片段时长，用于计算进度以及在无法获取帧时长时推算最后一帧的显示时间
+func (f *FFmpegService) ExtractFrames(ctx context.Context, inputPath, outputDir string, startTime, duration float64, opts FrameExportOptions) ([]ExtractedFrame, error) {
+	chain := "showinfo"
+	if opts.Width > 0 {
+		chain = fmt.Sprintf("scale=%d:-2:flags=lanczos,", opts.Width) + chain
+	}
+	if opts.FPS > 0 {
+		chain = "fps=" + strconv.FormatFloat(opts.FPS, 'f', -1, 64) + "," + chain
+	}
+
+	pattern := filepath.Join(outputDir, "frame_%05d."+FrameExtension(opts.Format))
+	args := inputArgs(inputPath, startTime, duration)
+	args = append(args,
+		"-y",
+		"-vf", chain,
+		"-fps_mode", "passthrough",
+		"-frames:v", strconv.Itoa(opts.MaxFrames),
+		"-an",
+	)
+	if opts.Format == FrameJPEG {
+		args = append(args, "-c:v", "mjpeg", "-q:v", "2")
+	} else {
+		args = append(args, "-c:v", "png")
+	}
+	args = append(args, pattern)
+
+	output, err := f.runFFmpeg(ctx, args, "encode", 1, 1, duration)
+	if err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ffmpeg error: %v, output: %s", err, string(output))
+	}
+
+	var frames []ExtractedFrame
+	var lastDuration float64
+	for i, m := range showinfoTimePattern.FindAllSubmatch(output, -1) {
+		path := fmt.Sprintf(pattern, i+1)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		timestamp, _ := strconv.ParseFloat(string(m[1]), 64)
+		if d := showinfoDurationPattern.FindSubmatch(m[0]); d != nil {
+			lastDuration, _ = strconv.ParseFloat(string(d[1]), 64)
+		}
+		frames = append(frames, ExtractedFrame{Path: path, Timestamp: timestamp})
+	}
+
+	// 帧时长取与下一帧的时间差，最后一帧依次使用固定帧率、showinfo时长、片段剩余时长
+	for i := range frames {
+		var delay float64
+		switch {
+		case i+1 < len(frames):
+			delay = frames[i+1].Timestamp - frames[i].Timestamp
+		case opts.FPS > 0:
+			delay = 1 / opts.FPS
+		case lastDuration > 0:
+			delay = lastDuration
+		default:
+			delay = duration - frames[i].Timestamp
+		}
+		frames[i].Timestamp = math.Round(frames[i].Timestamp*1000) / 1000
+		frames[i].Delay = math.Round(math.Max(delay, 0)*1000) / 1000
+	}
+	return frames, nil
+}
@@ -0,0 +1,509 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// GIF编辑的解码限制
+const (
+	maxGifEditCanvas = 4096 * 4096 // 画布最大面积
+	maxGifEditPixels = 200_000_000 // 画布面积 x 帧数
+)
+
+// GifEditOptions GIF编辑参数，按 删除帧 -> 倒放 -> 裁剪 -> 缩放 -> 帧延迟 -> 变速 -> 循环 的顺序应用
+type GifEditOptions struct {
+	Drop    [][2]int         // 删除的帧区间（从0开始，闭区间，原始帧序号）
+	Reverse bool             // 倒放
+	Crop    *models.CropRect // 裁剪区域（原始画布坐标）
+	Width   int              // 输出宽度，0表示按高度等比计算或保持原尺寸
+	Height  int              // 输出高度，0表示按宽度等比计算或保持原尺寸
+	Delays  []int            // 每帧延迟(毫秒)，与删除帧、倒放后的输出帧一一对应
+	Speed   float64          // 播放速度，0表示不变速
+	Loop    *int             // 0为无限循环，-1为不循环，N为额外重复N次，nil保持原设置
+}
+
+// GifEditResult GIF编辑结果
+type GifEditResult struct {
+	Width      int
+	Height     int
+	FrameCount int
+	Duration   float64 // 播放一遍的时长(秒)
+	Loop       int
+}
+
+// ParseFrameRanges 解析形如"0-4,10,15-20"的帧区间列表，只做语法检查
+func ParseFrameRanges(spec string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("帧区间格式错误: %s", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil || end < start {
+				return nil, fmt.Errorf("帧区间格式错误: %s", part)
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
+// EditGif 使用标准库解码GIF并完成编辑，不依赖ffmpeg
+// 只修改延迟和循环次数时直接改写原始帧；涉及删除帧、倒放或画面变化时先合成完整画面，再逐帧重新编码
+func EditGif(ctx context.Context, inputPath, outputPath string, opts GifEditOptions, onProgress func(models.ConversionProgress)) (*GifEditResult, error) {
+	g, canvasWidth, canvasHeight, err := decodeGif(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keep, err := keptFrames(len(g.Image), opts.Drop)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Reverse {
+		for i, j := 0, len(keep)-1; i < j; i, j = i+1, j-1 {
+			keep[i], keep[j] = keep[j], keep[i]
+		}
+	}
+	if opts.Delays != nil && len(opts.Delays) != len(keep) {
+		return nil, fmt.Errorf("帧延迟数量(%d)与输出帧数(%d)不一致", len(opts.Delays), len(keep))
+	}
+
+	crop := image.Rect(0, 0, canvasWidth, canvasHeight)
+	if opts.Crop != nil {
+		crop = image.Rect(opts.Crop.X, opts.Crop.Y, opts.Crop.X+opts.Crop.Width, opts.Crop.Y+opts.Crop.Height)
+		if !crop.In(image.Rect(0, 0, canvasWidth, canvasHeight)) {
+			return nil, fmt.Errorf("裁剪区域超出画布范围(%dx%d)", canvasWidth, canvasHeight)
+		}
+	}
+	width, height := scaledSize(crop.Dx(), crop.Dy(), opts.Width, opts.Height)
+
+	// 延迟以1/100秒为单位
+	delays := make([]int, len(keep))
+	for i, index := range keep {
+		delay := g.Delay[index]
+		if opts.Delays != nil {
+			delay = int(math.Round(float64(opts.Delays[i]) / 10))
+		}
+		if delay <= 0 {
+			delay = 10 // 浏览器按100毫秒播放延迟为0的帧
+		}
+		if opts.Speed > 0 {
+			delay = int(math.Round(float64(delay) / opts.Speed))
+		}
+		// 浏览器会把小于2的延迟当作10处理
+		delays[i] = max(delay, 2)
+	}
+
+	loop := g.LoopCount
+	if opts.Loop != nil {
+		loop = *opts.Loop
+	}
+
+	out := g
+	if len(opts.Drop) > 0 || opts.Reverse || !crop.Eq(image.Rect(0, 0, canvasWidth, canvasHeight)) || width != crop.Dx() || height != crop.Dy() {
+		frames, err := composeFrames(ctx, g, canvasWidth, canvasHeight, keep, crop, width, height, onProgress)
+		if err != nil {
+			return nil, err
+		}
+		disposal := make([]byte, len(frames))
+		for i := range disposal {
+			// 每帧都是完整画面，播放下一帧前清空画布，透明区域不会透出上一帧
+			disposal[i] = gif.DisposalBackground
+		}
+		out = &gif.GIF{
+			Image:    frames,
+			Disposal: disposal,
+			Config:   image.Config{Width: width, Height: height},
+		}
+	}
+	out.Delay = delays
+	out.LoopCount = loop
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := gif.EncodeAll(output, out); err != nil {
+		output.Close()
+		os.Remove(outputPath)
+		return nil, fmt.Errorf("GIF编码失败: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		os.Remove(outputPath)
+		return nil, err
+	}
+
+	var total int
+	for _, delay := range delays {
+		total += delay
+	}
+	return &GifEditResult{
+		Width:      width,
+		Height:     height,
+		FrameCount: len(delays),
+		Duration:   float64(total) / 100,
+		Loop:       loop,
+	}, nil
+}
+
+// decodeGif 解码GIF并检查画布和帧数限制，返回画布尺寸
+// 画布尺寸和帧数都在解码像素数据之前检查，避免超大文件耗尽内存
+func decodeGif(inputPath string) (*gif.GIF, int, int, error) {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer file.Close()
+
+	config, err := gif.DecodeConfig(file)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("GIF解码失败: %v", err)
+	}
+	if config.Width*config.Height > maxGifEditCanvas {
+		return nil, 0, 0, fmt.Errorf("GIF画布过大(%dx%d)，无法处理", config.Width, config.Height)
+	}
+
+	// 只扫描块结构统计帧数，每帧解码后占用一个画布大小的内存
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, 0, err
+	}
+	maxFrames := maxGifEditPixels / max(config.Width*config.Height, 1)
+	if _, err := countGifFrames(file, maxFrames); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, 0, err
+	}
+	g, err := gif.DecodeAll(file)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("GIF解码失败: %v", err)
+	}
+	if len(g.Image) == 0 {
+		return nil, 0, 0, fmt.Errorf("GIF中没有任何帧")
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 || height == 0 {
+		bounds := g.Image[0].Bounds()
+		width, height = bounds.Max.X, bounds.Max.Y
+	}
+	if width*height*len(g.Image) > maxGifEditPixels {
+		return nil, 0, 0, fmt.Errorf("GIF尺寸或帧数过大，无法处理")
+	}
+	return g, width, height, nil
+}
+
+// countGifFrames 跳过像素数据只解析GIF块结构来统计帧数，帧数超过maxFrames时立即返回错误
+func countGifFrames(r io.Reader, maxFrames int) (int, error) {
+	br := bufio.NewReader(r)
+	// 文件头(6) + 逻辑屏幕描述符(7)
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, fmt.Errorf("GIF解码失败: %v", err)
+	}
+	if header[10]&0x80 != 0 {
+		if _, err := br.Discard(3 << (header[10]&0x07 + 1)); err != nil {
+			return 0, fmt.Errorf("GIF解码失败: %v", err)
+		}
+	}
+
+	frames := 0
+	for {
+		introducer, err := br.ReadByte()
+		if err == io.EOF && frames > 0 {
+			// 缺少结束标记，交给解码器判断
+			return frames, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("GIF解码失败: %v", err)
+		}
+		switch introducer {
+		case 0x21: // 扩展块：标签 + 数据子块
+			if _, err := br.Discard(1); err != nil {
+				return 0, fmt.Errorf("GIF解码失败: %v", err)
+			}
+		case 0x2C: // 图像描述符(9) + 局部颜色表 + LZW最小码长 + 数据子块
+			frames++
+			if frames > maxFrames {
+				return 0, fmt.Errorf("GIF尺寸或帧数过大，无法处理")
+			}
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(br, descriptor); err != nil {
+				return 0, fmt.Errorf("GIF解码失败: %v", err)
+			}
+			skip := 1
+			if descriptor[8]&0x80 != 0 {
+				skip += 3 << (descriptor[8]&0x07 + 1)
+			}
+			if _, err := br.Discard(skip); err != nil {
+				return 0, fmt.Errorf("GIF解码失败: %v", err)
+			}
+		case 0x3B: // 结束标记
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("GIF解码失败: 未知的块类型0x%02x", introducer)
+		}
+		if err := skipGifSubBlocks(br); err != nil {
+			return 0, fmt.Errorf("GIF解码失败: %v", err)
+		}
+	}
+}
+
+// skipGifSubBlocks 跳过以长度为0的子块结尾的数据子块序列
+func skipGifSubBlocks(br *bufio.Reader) error {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := br.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// gifCompositor 按处置方式逐帧合成GIF的完整画面
+type gifCompositor struct {
+	g        *gif.GIF
+	canvas   *image.RGBA
+	previous *image.RGBA // 处置方式为恢复上一画面时保存的画布
+	index    int         // 下一帧的序号
+}
+
+func newGifCompositor(g *gif.GIF, width, height int) *gifCompositor {
+	return &gifCompositor{
+		g:      g,
+		canvas: image.NewRGBA(image.Rect(0, 0, width, height)),
+	}
+}
+
+// disposal 获取第i帧的处置方式
+func (c *gifCompositor) disposal(i int) byte {
+	if i < len(c.g.Disposal) {
+		return c.g.Disposal[i]
+	}
+	return gif.DisposalNone
+}
+
+// next 处置上一帧后绘制下一帧，返回合成画布和帧序号；画布只在下次调用前有效
+func (c *gifCompositor) next() (*image.RGBA, int, bool) {
+	if c.index > 0 {
+		switch c.disposal(c.index - 1) {
+		case gif.DisposalBackground:
+			// 与浏览器一致，恢复背景即清为透明
+			draw.Draw(c.canvas, c.g.Image[c.index-1].Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			c.canvas, c.previous = c.previous, nil
+		}
+	}
+	if c.index >= len(c.g.Image) {
+		return nil, -1, false
+	}
+
+	frame := c.g.Image[c.index]
+	if c.disposal(c.index) == gif.DisposalPrevious {
+		c.previous = image.NewRGBA(c.canvas.Bounds())
+		copy(c.previous.Pix, c.canvas.Pix)
+	}
+	draw.Draw(c.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	c.index++
+	return c.canvas, c.index - 1, true
+}
+
+// keptFrames 计算删除帧之后保留的原始帧序号
+func keptFrames(count int, drop [][2]int) ([]int, error) {
+	dropped := make([]bool, count)
+	for _, r := range drop {
+		if r[1] >= count {
+			return nil, fmt.Errorf("帧区间%d-%d超出范围，GIF共%d帧", r[0], r[1], count)
+		}
+		for i := r[0]; i <= r[1]; i++ {
+			dropped[i] = true
+		}
+	}
+
+	var keep []int
+	for i := 0; i < count; i++ {
+		if !dropped[i] {
+			keep = append(keep, i)
+		}
+	}
+	if len(keep) == 0 {
+		return nil, fmt.Errorf("不能删除全部帧")
+	}
+	return keep, nil
+}
+
+// scaledSize 计算输出尺寸，只指定一边时按比例计算另一边
+func scaledSize(srcWidth, srcHeight, width, height int) (int, int) {
+	switch {
+	case width > 0 && height > 0:
+		return width, height
+	case width > 0:
+		return width, max(int(math.Round(float64(srcHeight)*float64(width)/float64(srcWidth))), 1)
+	case height > 0:
+		return max(int(math.Round(float64(srcWidth)*float64(height)/float64(srcHeight))), 1), height
+	default:
+		return srcWidth, srcHeight
+	}
+}
+
+// composeFrames 按处置方式逐帧合成完整画面，只输出keep中的帧
+func composeFrames(ctx context.Context, g *gif.GIF, canvasWidth, canvasHeight int, keep []int, crop image.Rectangle, width, height int, onProgress func(models.ConversionProgress)) ([]*image.Paletted, error) {
+	order := make(map[int][]int, len(keep))
+	for i, index := range keep {
+		order[index] = append(order[index], i)
+	}
+	frames := make([]*image.Paletted, len(keep))
+
+	compositor := newGifCompositor(g, canvasWidth, canvasHeight)
+	for {
+		canvas, i, ok := compositor.next()
+		if !ok {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if positions, ok := order[i]; ok {
+			var composed image.Image = canvas.SubImage(crop)
+			if width != crop.Dx() || height != crop.Dy() {
+				composed = resizeArea(canvas, crop, width, height)
+			}
+			paletted := toPaletted(composed)
+			for _, position := range positions {
+				frames[position] = paletted
+			}
+		}
+
+		if onProgress != nil {
+			onProgress(models.ConversionProgress{
+				Phase:   "encode",
+				Step:    1,
+				Steps:   1,
+				Percent: float64(i+1) * 100 / float64(len(g.Image)),
+			})
+		}
+	}
+	return frames, nil
+}
+
+// resizeArea 按面积平均缩放，缩小时比最近邻更平滑；放大时退化为最近邻
+func resizeArea(src *image.RGBA, rect image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(rect.Dx()) / float64(width)
+	scaleY := float64(rect.Dy()) / float64(height)
+
+	for y := 0; y < height; y++ {
+		y0 := rect.Min.Y + int(float64(y)*scaleY)
+		y1 := max(rect.Min.Y+int(float64(y+1)*scaleY), y0+1)
+		for x := 0; x < width; x++ {
+			x0 := rect.Min.X + int(float64(x)*scaleX)
+			x1 := max(rect.Min.X+int(float64(x+1)*scaleX), x0+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pix := src.Pix[offset : offset+4]
+					r += int(pix[0])
+					g += int(pix[1])
+					b += int(pix[2])
+					a += int(pix[3])
+					n++
+					offset += 4
+				}
+			}
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// toPaletted 将合成画面转换为调色板图像，半透明像素按50%阈值处理为全透明或不透明
+// 颜色不超过256种时无损保留；否则用中值切分生成调色板，不做抖动以免帧间闪烁
+func toPaletted(img image.Image) *image.Paletted {
+	dst, rgba := exactPaletted(img)
+	if dst != nil {
+		return dst
+	}
+	palette := append(color.Palette{color.RGBA{}}, MedianCutPalette([]*image.RGBA{rgba}, 255)...)
+	return QuantizeImage(rgba, palette, false)
+}
+
+// exactPaletted 颜色（包括透明色）不超过256种时无损转换为调色板图像，否则返回nil和转换后的RGBA画面
+// 返回图像的坐标从(0, 0)开始
+func exactPaletted(img image.Image) (*image.Paletted, *image.RGBA) {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	indexes := make(map[color.RGBA]uint8)
+	var palette color.Palette
+	for p := 0; p < len(rgba.Pix); p += 4 {
+		c := opaqueOrTransparent(rgba.Pix[p : p+4])
+		if _, ok := indexes[c]; ok {
+			continue
+		}
+		if len(palette) == 256 {
+			return nil, rgba
+		}
+		indexes[c] = uint8(len(palette))
+		palette = append(palette, c)
+	}
+
+	dst := image.NewPaletted(rgba.Rect, palette)
+	for p := 0; p < len(rgba.Pix); p += 4 {
+		dst.Pix[p/4] = indexes[opaqueOrTransparent(rgba.Pix[p:p+4])]
+	}
+	return dst, rgba
+}
+
+// opaqueOrTransparent 透明度低于50%的像素视为全透明，其余还原为不透明颜色
+func opaqueOrTransparent(pix []uint8) color.RGBA {
+	switch {
+	case pix[3] < 128:
+		return color.RGBA{}
+	case pix[3] < 255:
+		// 预乘颜色还原为不透明颜色
+		return color.RGBA{
+			R: uint8(int(pix[0]) * 255 / int(pix[3])),
+			G: uint8(int(pix[1]) * 255 / int(pix[3])),
+			B: uint8(int(pix[2]) * 255 / int(pix[3])),
+			A: 255,
+		}
+	default:
+		return color.RGBA{R: pix[0], G: pix[1], B: pix[2], A: 255}
+	}
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestGif 写入画布为width x height、包含frames个1x1帧的GIF，奇数帧使用局部颜色表
+func writeTestGif(t *testing.T, width, height, frames int) string {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	local := color.Palette{color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}, color.White}
+	g := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: palette}}
+	for i := 0; i < frames; i++ {
+		framePalette := palette
+		if i%2 == 1 {
+			framePalette = local
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, 1, 1), framePalette)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.gif")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCountGifFrames(t *testing.T) {
+	data, err := os.ReadFile(writeTestGif(t, 8, 8, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := countGifFrames(bytes.NewReader(data), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != 7 {
+		t.Errorf("frames = %d, want 7", frames)
+	}
+
+	if _, err := countGifFrames(bytes.NewReader(data), 6); err == nil {
+		t.Error("expected error when frame count exceeds the limit")
+	}
+	if _, err := countGifFrames(bytes.NewReader(data[:20]), 100); err == nil {
+		t.Error("expected error for truncated GIF")
+	}
+}
+
+func TestDecodeGifLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		width   int
+		height  int
+		frames  int
+		wantErr string
+	}{
+		{"within limits", 100, 100, 10, ""},
+		{"canvas too large", 5000, 5000, 1, "画布过大"},
+		{"too many frames", 1000, 1000, maxGifEditPixels/(1000*1000) + 1, "帧数过大"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, width, height, err := decodeGif(writeTestGif(t, tt.width, tt.height, tt.frames))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width != tt.width || height != tt.height || len(g.Image) != tt.frames {
+				t.Errorf("got %dx%d with %d frames, want %dx%d with %d", width, height, len(g.Image), tt.width, tt.height, tt.frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"toGif-backend/internal/models"
+)
+
+// MaxGifLossy 有损优化强度上限
+const MaxGifLossy = 200
+
+// GifOptimizeOptions GIF优化参数
+type GifOptimizeOptions struct {
+	// 有损优化强度 0-200，0为无损
+	// 与上一帧颜色接近的像素视为未变化，与左侧像素颜色接近的像素复用左侧颜色，从而增加透明区域和重复序列，提升LZW压缩率
+	Lossy int
+}
+
+// GifOptimizeResult GIF优化结果
+type GifOptimizeResult struct {
+	OriginalSize   int64
+	OptimizedSize  int64
+	OriginalFrames int
+	Frames         int  // 合并重复帧后的帧数
+	Applied        bool // 优化后文件更小时才会采用
+}
+
+// errGifNotLossless 无损模式下某帧无法用256色调色板表示，放弃优化并保留原文件
+var errGifNotLossless = errors.New("GIF帧颜色过多，无法无损优化")
+
+// optimizedFrame 待输出的差分帧
+type optimizedFrame struct {
+	patch  *image.RGBA     // 画布大小，未变化的像素为透明
+	full   *image.RGBA     // 该帧播放后的完整画面，差分帧颜色过多时改为输出完整画面，使用全局调色板时为nil
+	bounds image.Rectangle // 变化区域
+	delay  int
+}
+
+// OptimizeGif 使用标准库重新编码GIF，减小文件体积
+// 每帧只保留相对上一帧变化的最小矩形区域，区域内未变化的像素设为透明；画面相同的连续帧合并并累加延迟；
+// 所有画面颜色不超过255种时共用全局调色板，省去每帧的局部调色板
+// 结果写入outputPath（可以与inputPath相同），优化后不比原文件小时保留原文件内容
+func OptimizeGif(ctx context.Context, inputPath, outputPath string, opts GifOptimizeOptions, onProgress func(models.ConversionProgress)) (*GifOptimizeResult, error) {
+	originalSize, err := GetFileSize(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	g, width, height, err := decodeGif(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GifOptimizeResult{
+		OriginalSize:   originalSize,
+		OptimizedSize:  originalSize,
+		OriginalFrames: len(g.Image),
+		Frames:         len(g.Image),
+	}
+
+	out, err := optimizeFrames(ctx, g, width, height, opts, onProgress)
+	if errors.Is(err, errGifNotLossless) {
+		// 无损模式下不重新量化颜色，保留原文件
+		if inputPath != outputPath {
+			if err := copyFile(inputPath, outputPath); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 先写入同目录的临时文件，确认更小后再替换
+	temp, err := os.CreateTemp(filepath.Dir(outputPath), "optimize-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp.Name())
+	if err := gif.EncodeAll(temp, out); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("GIF编码失败: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		return nil, err
+	}
+
+	optimizedSize, err := GetFileSize(temp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	if optimizedSize < originalSize {
+		if err := os.Rename(temp.Name(), outputPath); err != nil {
+			return nil, err
+		}
+		result.OptimizedSize = optimizedSize
+		result.Frames = len(out.Image)
+		result.Applied = true
+	} else if inputPath != outputPath {
+		if err := copyFile(inputPath, outputPath); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// optimizeFrames 生成差分后的帧序列
+// 不使用全局调色板时每帧使用局部调色板：差分帧加上透明色超过256种颜色时改为输出该区域的完整画面，
+// 仍然超过时有损模式重新量化颜色，无损模式返回errGifNotLossless
+func optimizeFrames(ctx context.Context, g *gif.GIF, width, height int, opts GifOptimizeOptions, onProgress func(models.ConversionProgress)) (*gif.GIF, error) {
+	canvasRect := image.Rect(0, 0, width, height)
+	palette := globalPalette(g, width, height)
+
+	// 颜色距离阈值（RGB欧氏距离的平方）
+	temporal := opts.Lossy * opts.Lossy / 16
+	spatial := opts.Lossy * opts.Lossy * 9 / 400
+
+	out := &gif.GIF{
+		LoopCount: g.LoopCount,
+		Config:    image.Config{Width: width, Height: height},
+	}
+	if palette != nil {
+		out.Config.ColorModel = palette
+	}
+	emit := func(frame *optimizedFrame, disposal byte) error {
+		var paletted *image.Paletted
+		if palette != nil {
+			paletted = palettize(frame.patch, frame.bounds, palette)
+		} else {
+			paletted, _ = exactPaletted(frame.patch.SubImage(frame.bounds))
+			if paletted == nil {
+				paletted, _ = exactPaletted(frame.full.SubImage(frame.bounds))
+			}
+			if paletted == nil {
+				if opts.Lossy == 0 {
+					return errGifNotLossless
+				}
+				paletted = toPaletted(frame.patch.SubImage(frame.bounds))
+			}
+			paletted.Rect = frame.bounds
+		}
+		out.Image = append(out.Image, paletted)
+		out.Delay = append(out.Delay, frame.delay)
+		out.Disposal = append(out.Disposal, disposal)
+		return nil
+	}
+
+	// shown 为播放器当前显示的画面
+	shown := image.NewRGBA(canvasRect)
+	var pending *optimizedFrame
+
+	compositor := newGifCompositor(g, width, height)
+	for {
+		current, i, ok := compositor.next()
+		if !ok {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		delay := 10 // 浏览器按100毫秒播放延迟小于2的帧
+		if i < len(g.Delay) && g.Delay[i] >= 2 {
+			delay = g.Delay[i]
+		}
+
+		// 不透明像素变为透明时无法通过叠加实现，需要让上一帧播放后清空画布
+		reset := pending == nil
+		for p := 3; !reset && p < len(current.Pix); p += 4 {
+			reset = shown.Pix[p] != 0 && current.Pix[p] == 0
+		}
+
+		patch := image.NewRGBA(canvasRect)
+		bounds := image.Rectangle{}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				p := current.PixOffset(x, y)
+				c := current.Pix[p : p+4 : p+4]
+				if c[3] == 0 {
+					continue
+				}
+				if !reset && shown.Pix[p+3] != 0 && colorDistance(shown.Pix[p:p+3], c) <= temporal {
+					continue
+				}
+
+				target := patch.Pix[p : p+4 : p+4]
+				copy(target, c)
+				if spatial > 0 && x > 0 && patch.Pix[p-1] != 0 && colorDistance(patch.Pix[p-4:p-1], c) <= spatial {
+					copy(target, patch.Pix[p-4:p])
+				}
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+
+		if !reset && bounds.Empty() {
+			// 与上一帧相同，合并延迟
+			pending.delay += delay
+			continue
+		}
+		if bounds.Empty() {
+			bounds = image.Rect(0, 0, 1, 1)
+		}
+
+		if reset {
+			clear(shown.Pix)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				p := patch.PixOffset(x, y)
+				if patch.Pix[p+3] != 0 {
+					copy(shown.Pix[p:p+4], patch.Pix[p:p+4])
+				}
+			}
+		}
+
+		if pending != nil {
+			disposal := byte(gif.DisposalNone)
+			if reset {
+				// 恢复背景只清除该帧自身的区域，扩展为整个画布
+				pending.bounds = canvasRect
+				disposal = gif.DisposalBackground
+			}
+			if err := emit(pending, disposal); err != nil {
+				return nil, err
+			}
+		}
+		pending = &optimizedFrame{patch: patch, bounds: bounds, delay: delay}
+		if palette == nil {
+			pending.full = image.NewRGBA(canvasRect)
+			copy(pending.full.Pix, shown.Pix)
+		}
+
+		if onProgress != nil {
+			onProgress(models.ConversionProgress{
+				Phase:   "optimize",
+				Step:    1,
+				Steps:   1,
+				Percent: float64(i+1) * 100 / float64(len(g.Image)),
+			})
+		}
+	}
+	if err := emit(pending, gif.DisposalNone); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// globalPalette 所有合成画面的颜色不超过255种时返回共用调色板，第0项为透明色
+func globalPalette(g *gif.GIF, width, height int) color.Palette {
+	colors := make(map[uint32]struct{})
+	compositor := newGifCompositor(g, width, height)
+	for {
+		canvas, _, ok := compositor.next()
+		if !ok {
+			break
+		}
+		for p := 0; p < len(canvas.Pix); p += 4 {
+			if canvas.Pix[p+3] == 0 {
+				continue
+			}
+			colors[uint32(canvas.Pix[p])<<16|uint32(canvas.Pix[p+1])<<8|uint32(canvas.Pix[p+2])] = struct{}{}
+			if len(colors) > 255 {
+				return nil
+			}
+		}
+	}
+
+	keys := make([]uint32, 0, len(colors))
+	for key := range colors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	palette := color.Palette{color.RGBA{}}
+	for _, key := range keys {
+		palette = append(palette, color.RGBA{R: uint8(key >> 16), G: uint8(key >> 8), B: uint8(key), A: 255})
+	}
+	return palette
+}
+
+// palettize 将画布中bounds区域按全局调色板转换，透明像素使用第0项
+func palettize(img *image.RGBA, bounds image.Rectangle, palette color.Palette) *image.Paletted {
+	indexes := make(map[uint32]uint8, len(palette))
+	for i, c := range palette[1:] {
+		rgba := c.(color.RGBA)
+		indexes[uint32(rgba.R)<<16|uint32(rgba.G)<<8|uint32(rgba.B)] = uint8(i + 1)
+	}
+
+	dst := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := img.PixOffset(x, y)
+			if img.Pix[p+3] == 0 {
+				continue
+			}
+			dst.Pix[dst.PixOffset(x, y)] = indexes[uint32(img.Pix[p])<<16|uint32(img.Pix[p+1])<<8|uint32(img.Pix[p+2])]
+		}
+	}
+	return dst
+}
+
+// colorDistance RGB欧氏距离的平方
+func colorDistance(a, b []uint8) int {
+	dr := int(a[0]) - int(b[0])
+	dg := int(a[1]) - int(b[1])
+	db := int(a[2]) - int(b[2])
+	return dr*dr + dg*dg + db*db
+}
+
+// copyFile 复制文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
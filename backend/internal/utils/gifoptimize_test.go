@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// TestOptimizeGifLosslessFullPalette 无损模式下差分帧已有256种不透明颜色时不能重新量化
+func TestOptimizeGifLosslessFullPalette(t *testing.T) {
+	// 16x17画布：第二帧使用256种颜色，只有一个像素与第一帧相同，差分帧需要256种颜色加透明色
+	const width, height, unchanged = 16, 17, 100
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i), G: 0xc0, B: 0x20, A: 0xff}
+	}
+	first := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, palette[unchanged]})
+	first.Pix[unchanged] = 1
+	second := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for i := range second.Pix {
+		second.Pix[i] = uint8(i)
+		if i >= 256 {
+			second.Pix[i] = unchanged
+		}
+	}
+	src := &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{10, 10},
+		Config: image.Config{Width: width, Height: height},
+	}
+
+	out, err := optimizeFrames(context.Background(), src, width, height, GifOptimizeOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Image) != len(src.Image) {
+		t.Fatalf("frames = %d, want %d", len(decoded.Image), len(src.Image))
+	}
+
+	want := newGifCompositor(src, width, height)
+	got := newGifCompositor(decoded, width, height)
+	for {
+		wantCanvas, i, ok := want.next()
+		gotCanvas, _, gotOK := got.next()
+		if !ok || !gotOK {
+			break
+		}
+		if !bytes.Equal(wantCanvas.Pix, gotCanvas.Pix) {
+			t.Fatalf("frame %d differs after lossless optimization", i)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg" // 注册JPEG解码器
+	_ "image/png"  // 注册PNG解码器
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// 生成调色板时最多统计的像素数，超过时按间隔采样
+const maxPaletteSamples = 1 << 20
+
+// GoEncoder 纯Go实现的GIF编码器，使用中值切分生成调色板、Floyd–Steinberg误差扩散抖动
+// 不依赖ffmpeg，但只能解码PNG/JPEG/GIF图片
+type GoEncoder struct {
+	onProgress ProgressFunc
+}
+
+// NewGoEncoder 创建纯Go编码器实例
+func NewGoEncoder() *GoEncoder {
+	return &GoEncoder{}
+}
+
+// Name 编码器名称
+func (e *GoEncoder) Name() string {
+	return EncoderGo
+}
+
+// SetProgressCallback 设置进度回调
+func (e *GoEncoder) SetProgressCallback(fn ProgressFunc) {
+	e.onProgress = fn
+}
+
+// report 上报进度
+func (e *GoEncoder) report(phase string, step, steps int, percent float64) {
+	if e.onProgress != nil {
+		e.onProgress(models.ConversionProgress{Phase: phase, Step: step, Steps: steps, Percent: percent})
+	}
+}
+
+// ConvertImagesToGif 将多张图片统一到相同画布后编码为GIF，所有帧共用一个调色板
+// 调色板颜色数和是否抖动与ffmpeg编码器的质量等级一致，bayer抖动以Floyd–Steinberg代替
+func (e *GoEncoder) ConvertImagesToGif(ctx context.Context, imagePaths []string, outputPath string, opts ImageSequenceOptions) error {
+	if len(imagePaths) == 0 || len(imagePaths) != len(opts.Delays) {
+		return fmt.Errorf("图片数量与帧时长数量不一致")
+	}
+
+	// 所有画布同时放在内存中占用过大，先逐张统计颜色，生成调色板后再逐张解码量化
+	const steps = 3
+	histogram := newColorHistogram(opts.Width * opts.Height * len(imagePaths))
+	for i, imagePath := range imagePaths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := decodeCanvas(imagePath, opts)
+		if err != nil {
+			return fmt.Errorf("处理第%d张图片失败: %v", i+1, err)
+		}
+		histogram.add(frame)
+		e.report("prepare", 1, steps, float64(i+1)*100/float64(len(imagePaths)))
+	}
+
+	params := PresetPaletteParams(opts.Preset, opts.Width)
+	transparent := opts.Fit == FitContain
+	maxColors := params.MaxColors
+	if transparent {
+		maxColors = min(maxColors, 255)
+	}
+	palette := histogram.palette(maxColors)
+	if transparent {
+		palette = append(color.Palette{color.RGBA{}}, palette...)
+	}
+	e.report("palette", 2, steps, 100)
+
+	out := &gif.GIF{
+		LoopCount: opts.Loop,
+		Config:    image.Config{Width: opts.Width, Height: opts.Height, ColorModel: palette},
+	}
+	dither := params.Dither != "none"
+	for i, imagePath := range imagePaths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := decodeCanvas(imagePath, opts)
+		if err != nil {
+			return fmt.Errorf("处理第%d张图片失败: %v", i+1, err)
+		}
+		out.Image = append(out.Image, QuantizeImage(frame, palette, dither))
+		// GIF延迟以1/100秒为单位
+		out.Delay = append(out.Delay, max(int(math.Round(opts.Delays[i]*100)), 2))
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+		e.report("encode", 3, steps, float64(i+1)*100/float64(len(imagePaths)))
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, out); err != nil {
+		file.Close()
+		os.Remove(outputPath)
+		return fmt.Errorf("GIF编码失败: %v", err)
+	}
+	return file.Close()
+}
+
+// decodeCanvas 解码图片并绘制到画布
+func decodeCanvas(path string, opts ImageSequenceOptions) (*image.RGBA, error) {
+	img, err := decodeImageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return fitCanvas(img, opts), nil
+}
+
+// decodeImageFile 使用标准库解码图片，GIF只取第一帧
+func decodeImageFile(path string) (image.Image, error) {
+	if ImageFormat(path) == "webp" {
+		return nil, fmt.Errorf("纯Go编码器不支持WebP图片，需要安装FFmpeg")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("图片解码失败: %v", err)
+	}
+	if config.Width*config.Height > maxGifEditCanvas {
+		return nil, fmt.Errorf("图片尺寸过大(%dx%d)", config.Width, config.Height)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("图片解码失败: %v", err)
+	}
+	return img, nil
+}
+
+// fitCanvas 按缩放方式将图片绘制到画布上，与canvasFilter的ffmpeg滤镜效果一致
+func fitCanvas(img image.Image, opts ImageSequenceOptions) *image.RGBA {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	w, h := opts.Width, opts.Height
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	if opts.Fit == FitCover {
+		// 保持比例铺满画布，居中裁剪超出部分
+		scale := math.Max(float64(w)/float64(sw), float64(h)/float64(sh))
+		cw := min(int(math.Round(float64(w)/scale)), sw)
+		ch := min(int(math.Round(float64(h)/scale)), sh)
+		crop := image.Rect((sw-cw)/2, (sh-ch)/2, (sw-cw)/2+cw, (sh-ch)/2+ch)
+		draw.Draw(canvas, canvas.Bounds(), resizeArea(src, crop, w, h), image.Point{}, draw.Src)
+		return canvas
+	}
+
+	scale := math.Min(float64(w)/float64(sw), float64(h)/float64(sh))
+	dw := max(int(math.Round(float64(sw)*scale)), 1)
+	dh := max(int(math.Round(float64(sh)*scale)), 1)
+	if opts.Fit == FitPad {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(parseHexColor(opts.Background)), image.Point{}, draw.Src)
+	}
+	offset := image.Pt((w-dw)/2, (h-dh)/2)
+	draw.Draw(canvas, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(dw, dh))}, resizeArea(src, src.Bounds(), dw, dh), image.Point{}, draw.Over)
+	return canvas
+}
+
+// parseHexColor 解析已校验过的#RRGGBB颜色
+func parseHexColor(hex string) color.RGBA {
+	value, _ := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}
+}
+
+// colorBox 中值切分中的一个颜色区间
+type colorBox struct {
+	colors []colorCount
+	count  int
+}
+
+type colorCount struct {
+	rgb   [3]uint8
+	count int
+}
+
+// colorHistogram 不透明像素的颜色直方图，像素过多时按固定间隔采样
+type colorHistogram struct {
+	counts map[[3]uint8]int
+	stride int
+	index  int
+}
+
+// newColorHistogram 按预计统计的像素总数创建直方图
+func newColorHistogram(totalPixels int) *colorHistogram {
+	return &colorHistogram{
+		counts: make(map[[3]uint8]int),
+		stride: max(totalPixels/maxPaletteSamples, 1),
+	}
+}
+
+// add 统计一帧画面
+func (h *colorHistogram) add(img *image.RGBA) {
+	for p := 0; p < len(img.Pix); p += 4 {
+		h.index++
+		if h.index%h.stride != 0 || img.Pix[p+3] < 128 {
+			continue
+		}
+		h.counts[[3]uint8{img.Pix[p], img.Pix[p+1], img.Pix[p+2]}]++
+	}
+}
+
+// MedianCutPalette 用中值切分从画面的不透明像素中生成最多maxColors种颜色的调色板
+func MedianCutPalette(frames []*image.RGBA, maxColors int) color.Palette {
+	var total int
+	for _, frame := range frames {
+		total += len(frame.Pix) / 4
+	}
+	histogram := newColorHistogram(total)
+	for _, frame := range frames {
+		histogram.add(frame)
+	}
+	return histogram.palette(maxColors)
+}
+
+// palette 中值切分生成调色板
+func (h *colorHistogram) palette(maxColors int) color.Palette {
+	if len(h.counts) == 0 {
+		return color.Palette{color.RGBA{A: 255}}
+	}
+
+	colors := make([]colorCount, 0, len(h.counts))
+	var count int
+	for rgb, n := range h.counts {
+		colors = append(colors, colorCount{rgb: rgb, count: n})
+		count += n
+	}
+	boxes := []colorBox{{colors: colors, count: count}}
+
+	for len(boxes) < maxColors {
+		// 优先切分像素数与颜色跨度乘积最大的区间
+		best, bestScore, bestChannel := -1, 0, 0
+		for i, box := range boxes {
+			if len(box.colors) < 2 {
+				continue
+			}
+			channel, span := box.widestChannel()
+			if score := span * box.count; score > bestScore {
+				best, bestScore, bestChannel = i, score, channel
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.Slice(box.colors, func(i, j int) bool {
+			return box.colors[i].rgb[bestChannel] < box.colors[j].rgb[bestChannel]
+		})
+		// 按像素数的中位数切分
+		var half, split int
+		for i, c := range box.colors {
+			half += c.count
+			if half*2 >= box.count {
+				split = min(max(i, 1), len(box.colors)-1)
+				break
+			}
+		}
+		left := colorBox{colors: box.colors[:split]}
+		right := colorBox{colors: box.colors[split:]}
+		for _, c := range left.colors {
+			left.count += c.count
+		}
+		right.count = box.count - left.count
+		boxes[best] = left
+		boxes = append(boxes, right)
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b int
+		for _, c := range box.colors {
+			r += int(c.rgb[0]) * c.count
+			g += int(c.rgb[1]) * c.count
+			b += int(c.rgb[2]) * c.count
+		}
+		palette = append(palette, color.RGBA{
+			R: uint8((r + box.count/2) / box.count),
+			G: uint8((g + box.count/2) / box.count),
+			B: uint8((b + box.count/2) / box.count),
+			A: 255,
+		})
+	}
+	return palette
+}
+
+// widestChannel 返回颜色跨度最大的通道及其跨度
+func (b colorBox) widestChannel() (int, int) {
+	lo := [3]uint8{255, 255, 255}
+	var hi [3]uint8
+	for _, c := range b.colors {
+		for ch := 0; ch < 3; ch++ {
+			lo[ch] = min(lo[ch], c.rgb[ch])
+			hi[ch] = max(hi[ch], c.rgb[ch])
+		}
+	}
+	channel, span := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		if s := int(hi[ch]) - int(lo[ch]); s > span {
+			channel, span = ch, s
+		}
+	}
+	return channel, span
+}
+
+// QuantizeImage 将RGBA画面映射到调色板，dither为true时使用Floyd–Steinberg误差扩散
+// 透明度低于50%的像素使用调色板中的透明色（如果有），不参与误差扩散
+func QuantizeImage(img *image.RGBA, palette color.Palette, dither bool) *image.Paletted {
+	bounds := img.Bounds()
+	dst := image.NewPaletted(bounds, palette)
+
+	transparent := -1
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	lookup := newPaletteLookup(palette, transparent)
+
+	width := bounds.Dx()
+	// 当前行和下一行的累计误差，每像素3个通道，两侧各留一个像素的边界
+	current := make([]float32, (width+2)*3)
+	next := make([]float32, (width+2)*3)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			p := img.PixOffset(x, y)
+			pix := img.Pix[p : p+4 : p+4]
+			if pix[3] < 128 && transparent >= 0 {
+				dst.Pix[dst.PixOffset(x, y)] = uint8(transparent)
+				continue
+			}
+
+			// 预乘颜色还原为不透明颜色
+			r, g, b := float32(pix[0]), float32(pix[1]), float32(pix[2])
+			if pix[3] > 0 && pix[3] < 255 {
+				scale := 255 / float32(pix[3])
+				r, g, b = r*scale, g*scale, b*scale
+			}
+			e := (x - bounds.Min.X + 1) * 3
+			if dither {
+				r, g, b = r+current[e], g+current[e+1], b+current[e+2]
+			}
+			cr, cg, cb := clampChannel(r), clampChannel(g), clampChannel(b)
+
+			index := lookup.nearest(cr, cg, cb)
+			dst.Pix[dst.PixOffset(x, y)] = index
+			if !dither {
+				continue
+			}
+
+			chosen := lookup.colors[index]
+			diff := [3]float32{r - float32(chosen[0]), g - float32(chosen[1]), b - float32(chosen[2])}
+			for ch := 0; ch < 3; ch++ {
+				current[e+3+ch] += diff[ch] * 7 / 16
+				next[e-3+ch] += diff[ch] * 3 / 16
+				next[e+ch] += diff[ch] * 5 / 16
+				next[e+3+ch] += diff[ch] * 1 / 16
+			}
+		}
+		current, next = next, current
+		clear(next)
+	}
+	return dst
+}
+
+// clampChannel 将颜色通道限制在0-255之间
+func clampChannel(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// paletteLookup 最近颜色查找，按每通道5位缓存结果
+type paletteLookup struct {
+	colors      [][3]uint8
+	transparent int
+	cache       []int16
+}
+
+func newPaletteLookup(palette color.Palette, transparent int) *paletteLookup {
+	colors := make([][3]uint8, len(palette))
+	for i, c := range palette {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		colors[i] = [3]uint8{rgba.R, rgba.G, rgba.B}
+	}
+	cache := make([]int16, 1<<15)
+	for i := range cache {
+		cache[i] = -1
+	}
+	return &paletteLookup{colors: colors, transparent: transparent, cache: cache}
+}
+
+// nearest 查找与颜色最接近的不透明调色板项
+func (l *paletteLookup) nearest(r, g, b uint8) uint8 {
+	key := int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+	if cached := l.cache[key]; cached >= 0 {
+		return uint8(cached)
+	}
+
+	best, bestDistance := 0, math.MaxInt
+	for i, c := range l.colors {
+		if i == l.transparent {
+			continue
+		}
+		dr, dg, db := int(r)-int(c[0]), int(g)-int(c[1]), int(b)-int(c[2])
+		if d := dr*dr + dg*dg + db*db; d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	l.cache[key] = int16(best)
+	return uint8(best)
+}
@@ -0,0 +1,306 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils/utilstest"
+)
+
+// writeGradientPNG 写入一张颜色渐变的PNG，shift用于区分不同帧
+func writeGradientPNG(t *testing.T, path string, width, height, shift int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x*4 + shift), uint8(y * 4), uint8((x + y + shift) * 2), 255})
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoEncoderRoundTrip(t *testing.T) {
+	tests := []struct {
+		preset string
+		fit    string
+		width  int
+		height int
+		loop   int
+	}{
+		{"ultra", FitPad, 64, 48, 0},
+		{"medium", FitCover, 40, 40, 2},
+		{"low", FitContain, 64, 32, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset+"/"+tt.fit, func(t *testing.T) {
+			dir := t.TempDir()
+			delays := []float64{0.1, 0.25, 0.5, 0.004}
+			var paths []string
+			for i := range delays {
+				path := filepath.Join(dir, "frame"+string(rune('a'+i))+".png")
+				writeGradientPNG(t, path, 64, 64, i*16)
+				paths = append(paths, path)
+			}
+
+			preset, ok := LookupPreset(tt.preset)
+			if !ok {
+				t.Fatalf("preset %s not found", tt.preset)
+			}
+			output := filepath.Join(dir, "out.gif")
+			var phases []string
+			encoder := NewGoEncoder()
+			encoder.SetProgressCallback(func(p models.ConversionProgress) {
+				if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+					phases = append(phases, p.Phase)
+				}
+			})
+			err := encoder.ConvertImagesToGif(context.Background(), paths, output, ImageSequenceOptions{
+				Width:      tt.width,
+				Height:     tt.height,
+				Fit:        tt.fit,
+				Background: "#000000",
+				Delays:     delays,
+				Loop:       tt.loop,
+				Preset:     preset,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := os.Open(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			decoded, err := gif.DecodeAll(file)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if len(decoded.Image) != len(delays) {
+				t.Fatalf("frames = %d, want %d", len(decoded.Image), len(delays))
+			}
+			// GIF延迟以1/100秒为单位，最小2
+			wantDelays := []int{10, 25, 50, 2}
+			for i, delay := range decoded.Delay {
+				if delay != wantDelays[i] {
+					t.Errorf("frame %d delay = %d, want %d", i, delay, wantDelays[i])
+				}
+			}
+			if decoded.Config.Width != tt.width || decoded.Config.Height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", decoded.Config.Width, decoded.Config.Height, tt.width, tt.height)
+			}
+			if decoded.LoopCount != tt.loop {
+				t.Errorf("loop = %d, want %d", decoded.LoopCount, tt.loop)
+			}
+
+			// 编码时调色板会补齐到2的幂，按帧中实际使用的颜色检查
+			palette := decoded.Image[0].Palette
+			if len(palette) > 256 {
+				t.Errorf("palette has %d entries, want at most 256", len(palette))
+			}
+			used := map[color.Color]bool{}
+			for _, frame := range decoded.Image {
+				for _, index := range frame.Pix {
+					used[frame.Palette[index]] = true
+				}
+			}
+			maxColors := preset.MaxColors
+			if tt.fit == FitContain {
+				maxColors++ // 额外的透明色
+			}
+			if len(used) > maxColors {
+				t.Errorf("frames use %d colors, want at most %d", len(used), maxColors)
+			}
+			if tt.fit == FitContain {
+				if _, _, _, a := palette[0].RGBA(); a != 0 {
+					t.Errorf("contain fit palette should start with transparent color, got %v", palette[0])
+				}
+			}
+			if want := []string{"prepare", "palette", "encode"}; len(phases) != 3 || phases[0] != want[0] || phases[1] != want[1] || phases[2] != want[2] {
+				t.Errorf("progress phases = %v, want %v", phases, want)
+			}
+		})
+	}
+}
+
+func TestGoEncoderMismatchedDelays(t *testing.T) {
+	err := NewGoEncoder().ConvertImagesToGif(context.Background(), []string{"a.png", "b.png"}, filepath.Join(t.TempDir(), "out.gif"), ImageSequenceOptions{
+		Width: 10, Height: 10, Delays: []float64{0.1},
+	})
+	if err == nil {
+		t.Fatal("expected error for mismatched delays")
+	}
+}
+
+func TestGoEncoderCancelled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.png")
+	writeGradientPNG(t, path, 8, 8, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output := filepath.Join(dir, "out.gif")
+	err := NewGoEncoder().ConvertImagesToGif(ctx, []string{path}, output, ImageSequenceOptions{
+		Width: 8, Height: 8, Delays: []float64{0.1}, Preset: builtinPresets[0],
+	})
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("output written for cancelled encode")
+	}
+}
+
+func TestMedianCutPalette(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			frame.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x ^ y), 255})
+		}
+	}
+	for _, maxColors := range []int{2, 32, 128, 256} {
+		palette := MedianCutPalette([]*image.RGBA{frame}, maxColors)
+		if len(palette) == 0 || len(palette) > maxColors {
+			t.Errorf("maxColors %d: got %d colors", maxColors, len(palette))
+		}
+	}
+
+	// 颜色数少于上限时保留原有颜色
+	few := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	want := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+	for i, c := range want {
+		few.Set(i, 0, c)
+	}
+	palette := MedianCutPalette([]*image.RGBA{few}, 256)
+	if len(palette) != len(want) {
+		t.Fatalf("got %d colors, want %d", len(palette), len(want))
+	}
+	for _, c := range want {
+		if palette[palette.Index(c)] != color.Color(c) {
+			t.Errorf("color %v missing from palette %v", c, palette)
+		}
+	}
+}
+
+func TestQuantizeImage(t *testing.T) {
+	palette := color.Palette{color.RGBA{}, color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.RGBA{0, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{255, 255, 255, 255})
+	img.Set(2, 0, color.RGBA{0, 0, 0, 0}) // 透明像素
+	img.Set(3, 0, color.RGBA{250, 250, 250, 255})
+
+	for _, dither := range []bool{false, true} {
+		dst := QuantizeImage(img, palette, dither)
+		want := []uint8{1, 2, 0, 2}
+		for x, index := range want {
+			if got := dst.ColorIndexAt(x, 0); got != index {
+				t.Errorf("dither=%v pixel %d index = %d, want %d", dither, x, got, index)
+			}
+		}
+	}
+
+	// 中灰经误差扩散后黑白交替，不抖动时全部映射到同一颜色
+	gray := image.NewRGBA(image.Rect(0, 0, 16, 1))
+	for x := 0; x < 16; x++ {
+		gray.Set(x, 0, color.RGBA{128, 128, 128, 255})
+	}
+	counts := func(dst *image.Paletted) map[uint8]int {
+		m := map[uint8]int{}
+		for x := 0; x < 16; x++ {
+			m[dst.ColorIndexAt(x, 0)]++
+		}
+		return m
+	}
+	if c := counts(QuantizeImage(gray, palette, false)); len(c) != 1 {
+		t.Errorf("without dither got indices %v, want a single color", c)
+	}
+	if c := counts(QuantizeImage(gray, palette, true)); c[1] == 0 || c[2] == 0 {
+		t.Errorf("with dither got indices %v, want both black and white", c)
+	}
+}
+
+func TestInitEncoder(t *testing.T) {
+	previous := DefaultRunner()
+	t.Cleanup(func() {
+		SetDefaultRunner(previous)
+		InitEncoder("auto")
+	})
+
+	tests := []struct {
+		name      string
+		preferred string
+		missing   []string
+		available bool
+		encoder   string
+	}{
+		{"auto with ffmpeg", "auto", nil, true, EncoderFFmpeg},
+		{"auto without ffmpeg", "auto", []string{"ffmpeg"}, false, EncoderGo},
+		{"auto without ffprobe", "auto", []string{"ffprobe"}, false, EncoderGo},
+		{"prefer go", EncoderGo, nil, true, EncoderGo},
+		{"prefer ffmpeg but missing", EncoderFFmpeg, []string{"ffmpeg", "ffprobe"}, false, EncoderGo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultRunner(&utilstest.FakeRunner{Missing: tt.missing})
+			InitEncoder(tt.preferred)
+			if FFmpegAvailable() != tt.available {
+				t.Errorf("FFmpegAvailable = %v, want %v", FFmpegAvailable(), tt.available)
+			}
+			if EncoderName() != tt.encoder {
+				t.Errorf("EncoderName = %q, want %q", EncoderName(), tt.encoder)
+			}
+			if NewEncoder().Name() != tt.encoder {
+				t.Errorf("NewEncoder().Name() = %q, want %q", NewEncoder().Name(), tt.encoder)
+			}
+		})
+	}
+}
+
+// TestFFmpegDecodes 启动时按ffmpeg -decoders检查动画格式能否解码
+func TestFFmpegDecodes(t *testing.T) {
+	previous := DefaultRunner()
+	t.Cleanup(func() {
+		SetDefaultRunner(previous)
+		InitEncoder("auto")
+	})
+
+	tests := []struct {
+		name    string
+		runner  *utilstest.FakeRunner
+		decodes map[string]bool
+	}{
+		{"default decoders", &utilstest.FakeRunner{}, map[string]bool{FormatGIF: true, FormatAPNG: true, FormatAVIF: true, FormatWebP: false}},
+		{"no av1 decoder", &utilstest.FakeRunner{Decoders: []string{"gif", "apng", "h264"}}, map[string]bool{FormatGIF: true, FormatAPNG: true, FormatAVIF: false}},
+		{"decoder list unavailable", &utilstest.FakeRunner{Err: errors.New("exit status 1")}, map[string]bool{FormatGIF: true, FormatAVIF: true}},
+		{"ffmpeg missing", &utilstest.FakeRunner{Missing: []string{"ffmpeg"}}, map[string]bool{FormatGIF: false, FormatAVIF: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefaultRunner(tt.runner)
+			InitEncoder("auto")
+			for format, want := range tt.decodes {
+				if got := FFmpegDecodes(format); got != want {
+					t.Errorf("FFmpegDecodes(%s) = %v, want %v", format, got, want)
+				}
+			}
+		})
+	}
+}
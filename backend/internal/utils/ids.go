@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// idPattern 文件标识，128位随机数的十六进制表示
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// NewID 生成128位随机标识，用于上传、输出、调色板和压缩包等文件名
+// 同一秒内的多次转换不会互相覆盖，也无法通过枚举猜出他人的输出文件
+func NewID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf) // crypto/rand在读取失败时直接终止程序，不会返回错误
+	return hex.EncodeToString(buf)
+}
+
+// IsID 判断是否为NewID生成的标识
+func IsID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// FileID 返回文件名中第一个点号之前的标识，如 <id>.gif、<id>.gif.gz
+// 带后缀的派生文件（如 <id>_palette.png）和不以标识命名的文件返回空字符串
+func FileID(filename string) string {
+	id, _, _ := strings.Cut(filename, ".")
+	if !IsID(id) {
+		return ""
+	}
+	return id
+}
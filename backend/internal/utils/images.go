@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// 图片缩放到画布的方式
+const (
+	FitContain = "fit"  // 保持比例缩放到画布内，空白处透明
+	FitCover   = "fill" // 保持比例铺满画布，超出部分居中裁剪
+	FitPad     = "pad"  // 保持比例缩放到画布内，空白处填充背景色
+)
+
+// ImageSequenceOptions 图片序列转GIF参数
+type ImageSequenceOptions struct {
+	Width      int
+	Height     int
+	Fit        string
+	Background string        // pad模式的背景色 #RRGGBB
+	Delays     []float64     // 每帧显示时长(秒)，与图片一一对应
+	Loop       int           // 0为无限循环，-1为不循环，N为额外重复N次
+	Preset     models.Preset // 调色板参数，与视频转GIF相同
+}
+
+// ConvertImagesToGif 将多张图片统一到相同画布后，通过两遍调色板编码为GIF
+// 每张图片先单独归一化为画布大小的PNG，再用concat列表按每帧时长拼接
+func (f *FFmpegService) ConvertImagesToGif(ctx context.Context, imagePaths []string, outputPath string, opts ImageSequenceOptions) error {
+	if len(imagePaths) == 0 || len(imagePaths) != len(opts.Delays) {
+		return fmt.Errorf("图片数量与帧时长数量不一致")
+	}
+
+	workDir, err := os.MkdirTemp(filepath.Dir(imagePaths[0]), "normalized")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	const steps = 3
+	normalize := canvasFilter(opts)
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+
+	var total float64
+	for i, imagePath := range imagePaths {
+		framePath := filepath.Join(workDir, fmt.Sprintf("frame_%04d.png", i+1))
+		args := []string{"-i", imagePath, "-y", "-vf", normalize, "-frames:v", "1", "-update", "1", framePath}
+		if output, err := f.runFFmpeg(ctx, args, "prepare", 1, steps, 0); err != nil {
+			if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+				return err
+			}
+			return fmt.Errorf("处理第%d张图片失败: %v, output: %s", i+1, err, string(output))
+		}
+
+		if f.onProgress != nil {
+			f.onProgress(models.ConversionProgress{
+				Phase:   "prepare",
+				Step:    1,
+				Steps:   steps,
+				Percent: float64(i+1) * 100 / float64(len(imagePaths)),
+			})
+		}
+
+		fmt.Fprintf(&list, "file '%s'\nduration %s\n", filepath.Base(framePath), strconv.FormatFloat(opts.Delays[i], 'f', 3, 64))
+		total += opts.Delays[i]
+	}
+	// concat demuxer会忽略最后一个文件的duration，需要再列出一次最后一帧
+	fmt.Fprintf(&list, "file 'frame_%04d.png'\n", len(imagePaths))
+
+	listPath := filepath.Join(workDir, "list.ffconcat")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+
+	// 透明画布需要在调色板中保留透明色
+	params := PresetPaletteParams(opts.Preset, opts.Width)
+	params.ReserveTransparent = opts.Fit == FitContain
+
+	return f.encodeWithPalette(ctx, outputPath, params, paletteEncode{
+		input: []string{"-f", "concat", "-safe", "0", "-i", listPath},
+		// 保留每帧各自的时长，不按固定帧率补帧
+		output:   []string{"-fps_mode", "passthrough"},
+		loop:     opts.Loop,
+		duration: total,
+		step:     2,
+		steps:    steps,
+	})
+}
+
+// ImageSize 读取图片尺寸，标准库无法解码的WebP通过ffprobe读取
+func ImageSize(ctx context.Context, path string) (int, int, error) {
+	if ImageFormat(path) != "webp" {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer file.Close()
+		config, _, err := image.DecodeConfig(file)
+		if err != nil {
+			return 0, 0, err
+		}
+		return config.Width, config.Height, nil
+	}
+
+	if !FFmpegAvailable() {
+		return 0, 0, ErrFFmpegUnavailable
+	}
+	info, err := NewFFmpegService(defaultRunner).ProbeMedia(ctx, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Width, info.Height, nil
+}
+
+// canvasFilter 生成将单张图片归一化到画布的滤镜，参数均已校验
+func canvasFilter(opts ImageSequenceOptions) string {
+	w, h := opts.Width, opts.Height
+	switch opts.Fit {
+	case FitCover:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase:flags=lanczos,crop=%d:%d,setsar=1,format=rgba", w, h, w, h)
+	case FitPad:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:flags=lanczos,setsar=1,format=rgba,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=0x%sff",
+			w, h, w, h, strings.TrimPrefix(opts.Background, "#"))
+	default:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:flags=lanczos,setsar=1,format=rgba,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=0x00000000", w, h, w, h)
+	}
+}
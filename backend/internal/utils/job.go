@@ -0,0 +1,434 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"toGif-backend/internal/models"
+)
+
+// JobStatus 任务状态
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"    // 排队中
+	JobRunning   JobStatus = "running"   // 执行中
+	JobSucceeded JobStatus = "succeeded" // 执行成功
+	JobFailed    JobStatus = "failed"    // 执行失败
+	JobCancelled JobStatus = "cancelled" // 已取消
+)
+
+var (
+	// ErrJobQueueFull 任务队列已满
+	ErrJobQueueFull = errors.New("任务队列已满")
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("任务不存在")
+	// ErrJobFinished 任务已结束，无法取消
+	ErrJobFinished = errors.New("任务已结束")
+	// ErrJobManagerStopped 任务管理器已停止，不再接受新任务
+	ErrJobManagerStopped = errors.New("任务服务已停止")
+)
+
+// JobFunc 任务执行函数，返回值作为任务结果
+type JobFunc func(ctx context.Context, job *Job) (interface{}, error)
+
+// JobFinishFunc 任务结束回调，执行结束或排队期间被取消时都会调用且只调用一次，用于清理临时文件、更新记录
+type JobFinishFunc func(snapshot JobSnapshot)
+
+// Job 异步任务
+type Job struct {
+	mu         sync.RWMutex
+	id         string
+	jobType    string
+	owner      string // 提交任务的会话ID
+	status     JobStatus
+	result     interface{}
+	err        string
+	progress   *models.ConversionProgress
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+
+	// 状态变化订阅者，用于SSE推送
+	subscribers map[chan struct{}]struct{}
+
+	fn       JobFunc
+	onFinish JobFinishFunc
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// JobSnapshot 任务状态快照
+type JobSnapshot struct {
+	ID         string
+	Type       string
+	Owner      string
+	Status     JobStatus
+	Result     interface{}
+	Error      string
+	Progress   *models.ConversionProgress
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Finished 快照中的任务是否已结束
+func (s JobSnapshot) Finished() bool {
+	return s.Status == JobSucceeded || s.Status == JobFailed || s.Status == JobCancelled
+}
+
+// ID 获取任务ID
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Owner 获取提交任务的会话ID，任务生成的文件归该会话所有
+func (j *Job) Owner() string {
+	return j.owner
+}
+
+// Snapshot 获取任务当前状态的快照
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return JobSnapshot{
+		ID:         j.id,
+		Type:       j.jobType,
+		Owner:      j.owner,
+		Status:     j.status,
+		Result:     j.result,
+		Error:      j.err,
+		Progress:   j.progress,
+		CreatedAt:  j.createdAt,
+		StartedAt:  j.startedAt,
+		FinishedAt: j.finishedAt,
+	}
+}
+
+// finish 调用任务结束回调，再通知订阅者，保证客户端收到结束事件时回调已完成
+func (j *Job) finish() {
+	if j.onFinish != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("任务 %s 结束回调异常: %v", j.id, r)
+				}
+			}()
+			j.onFinish(j.Snapshot())
+		}()
+	}
+
+	j.mu.Lock()
+	j.notify()
+	j.mu.Unlock()
+}
+
+// SetProgress 更新任务进度并通知订阅者
+func (j *Job) SetProgress(progress models.ConversionProgress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress = &progress
+	j.notify()
+}
+
+// Subscribe 订阅任务状态变化，返回的通道在进度或状态更新时收到通知
+func (j *Job) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	j.mu.Lock()
+	if j.subscribers == nil {
+		j.subscribers = make(map[chan struct{}]struct{})
+	}
+	j.subscribers[ch] = struct{}{}
+	j.mu.Unlock()
+
+	unsubscribe := func() {
+		j.mu.Lock()
+		delete(j.subscribers, ch)
+		j.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// notify 通知所有订阅者（调用方需持有锁），订阅者未及时读取时合并通知
+func (j *Job) notify() {
+	for ch := range j.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// isFinished 任务是否已结束（调用方需持有锁）
+func (j *Job) isFinished() bool {
+	return j.status == JobSucceeded || j.status == JobFailed || j.status == JobCancelled
+}
+
+// JobManager 异步任务管理器，使用固定数量的worker执行任务
+type JobManager struct {
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	queue     chan *Job
+	workers   int
+	retention time.Duration
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewJobManager 创建任务管理器
+func NewJobManager(workers, queueSize int, retention time.Duration) *JobManager {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	return &JobManager{
+		jobs:      make(map[string]*Job),
+		queue:     make(chan *Job, queueSize),
+		workers:   workers,
+		retention: retention,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start 启动worker和过期任务清理
+func (m *JobManager) Start() {
+	for i := 0; i < m.workers; i++ {
+		go m.worker()
+	}
+
+	// 每10分钟清理一次已结束的过期任务
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.purgeExpired()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止worker和过期任务清理，并取消所有未结束的任务，之后提交任务返回ErrJobManagerStopped
+// 执行中的任务通过context通知中止，Stop不等待其结束
+func (m *JobManager) Stop() {
+	m.stopOnce.Do(func() {
+		m.mu.Lock()
+		close(m.stop)
+		m.mu.Unlock()
+		for _, snapshot := range m.List() {
+			if !snapshot.Finished() {
+				m.Cancel(snapshot.ID)
+			}
+		}
+	})
+}
+
+// Submit 以owner会话的名义提交任务，队列已满时返回ErrJobQueueFull（此时不调用onFinish）
+// onFinish可以为nil，任务结束或排队期间被取消时调用
+func (m *JobManager) Submit(jobType, owner string, fn JobFunc, onFinish JobFinishFunc) (*Job, error) {
+	id := NewID()
+
+	// 任务上下文与HTTP请求无关，客户端断开后任务继续执行
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:        id,
+		jobType:   jobType,
+		owner:     owner,
+		status:    JobQueued,
+		createdAt: time.Now(),
+		fn:        fn,
+		onFinish:  onFinish,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	// 在锁内检查是否已停止，保证Stop能看到所有已登记的任务
+	m.mu.Lock()
+	select {
+	case <-m.stop:
+		m.mu.Unlock()
+		cancel()
+		return nil, ErrJobManagerStopped
+	default:
+	}
+	m.jobs[id] = job
+	m.mu.Unlock()
+
+	select {
+	case m.queue <- job:
+		return job, nil
+	default:
+		m.mu.Lock()
+		delete(m.jobs, id)
+		m.mu.Unlock()
+		cancel()
+		return nil, ErrJobQueueFull
+	}
+}
+
+// Complete 直接创建已成功的任务，用于无需执行即可得到结果的请求（如命中转换缓存）
+func (m *JobManager) Complete(jobType, owner string, result interface{}) (*Job, error) {
+	id := NewID()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	now := time.Now()
+	job := &Job{
+		id:         id,
+		jobType:    jobType,
+		owner:      owner,
+		status:     JobSucceeded,
+		result:     result,
+		createdAt:  now,
+		startedAt:  now,
+		finishedAt: now,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = job
+	m.mu.Unlock()
+	return job, nil
+}
+
+// Get 根据ID获取任务
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// List 获取所有任务快照，按创建时间倒序
+func (m *JobManager) List() []JobSnapshot {
+	m.mu.RLock()
+	snapshots := make([]JobSnapshot, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		snapshots = append(snapshots, job.Snapshot())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots
+}
+
+// Cancel 取消任务。排队中的任务直接标记为已取消，执行中的任务通过context通知中止
+func (m *JobManager) Cancel(id string) error {
+	job, ok := m.Get(id)
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	job.mu.Lock()
+	if job.isFinished() {
+		job.mu.Unlock()
+		return ErrJobFinished
+	}
+	queued := job.status == JobQueued
+	if queued {
+		// worker取出任务时发现已取消会直接跳过，结束回调在这里调用
+		job.status = JobCancelled
+		job.err = "任务已取消"
+		job.finishedAt = time.Now()
+	}
+	job.cancel()
+	job.mu.Unlock()
+
+	if queued {
+		job.finish()
+	}
+	return nil
+}
+
+// QueueLength 当前排队中的任务数量
+func (m *JobManager) QueueLength() int {
+	return len(m.queue)
+}
+
+// worker 从队列中取出任务并执行
+func (m *JobManager) worker() {
+	for {
+		select {
+		case job := <-m.queue:
+			m.run(job)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// run 执行单个任务并记录结果
+func (m *JobManager) run(job *Job) {
+	job.mu.Lock()
+	if job.status != JobQueued {
+		// 排队期间已被取消
+		job.mu.Unlock()
+		return
+	}
+	job.status = JobRunning
+	job.startedAt = time.Now()
+	job.notify()
+	job.mu.Unlock()
+
+	result, err := m.execute(job)
+
+	job.mu.Lock()
+	job.finishedAt = time.Now()
+	switch {
+	case job.ctx.Err() != nil:
+		job.status = JobCancelled
+		job.err = "任务已取消"
+	case err != nil:
+		job.status = JobFailed
+		job.err = err.Error()
+	default:
+		job.status = JobSucceeded
+		job.result = result
+	}
+	job.cancel()
+	log.Printf("任务 %s (%s) 结束: %s, 耗时 %v", job.id, job.jobType, job.status, job.finishedAt.Sub(job.startedAt))
+	job.mu.Unlock()
+
+	job.finish()
+}
+
+// execute 执行任务函数，防止单个任务panic导致worker退出
+func (m *JobManager) execute(job *Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务执行异常: %v", r)
+		}
+	}()
+	return job.fn(job.ctx, job)
+}
+
+// purgeExpired 清理超过保留时间的已结束任务
+func (m *JobManager) purgeExpired() {
+	if m.retention <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		job.mu.RLock()
+		expired := job.isFinished() && time.Since(job.finishedAt) > m.retention
+		job.mu.RUnlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestJobOnFinishCalledForQueuedCancel 排队期间被取消的任务不执行，但结束回调仍调用且只调用一次
+func TestJobOnFinishCalledForQueuedCancel(t *testing.T) {
+	m := NewJobManager(1, 4, time.Minute)
+	m.Start()
+	t.Cleanup(m.Stop)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	finished := make(chan JobSnapshot, 4)
+	onFinish := func(snapshot JobSnapshot) { finished <- snapshot }
+
+	running, err := m.Submit("test", "owner", func(ctx context.Context, job *Job) (interface{}, error) {
+		close(started)
+		<-release
+		return "ok", nil
+	}, onFinish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	queued, err := m.Submit("test", "owner", func(ctx context.Context, job *Job) (interface{}, error) {
+		t.Error("cancelled job must not run")
+		return nil, nil
+	}, onFinish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Cancel(queued.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case snapshot := <-finished:
+		if snapshot.ID != queued.ID() || snapshot.Status != JobCancelled {
+			t.Fatalf("onFinish got %s/%s, want %s/%s", snapshot.ID, snapshot.Status, queued.ID(), JobCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onFinish not called for job cancelled while queued")
+	}
+	if err := m.Cancel(queued.ID()); err != ErrJobFinished {
+		t.Fatalf("second cancel: got %v, want ErrJobFinished", err)
+	}
+
+	close(release)
+	select {
+	case snapshot := <-finished:
+		if snapshot.ID != running.ID() || snapshot.Status != JobSucceeded || snapshot.Result != "ok" {
+			t.Fatalf("onFinish got %+v, want succeeded running job", snapshot)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onFinish not called for finished job")
+	}
+
+	// 等待worker跳过已取消的任务，确认回调没有重复调用
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case snapshot := <-finished:
+		t.Fatalf("unexpected extra onFinish call for %s", snapshot.ID)
+	default:
+	}
+}
+
+// TestJobManagerStop 停止后取消未结束的任务并拒绝新任务
+func TestJobManagerStop(t *testing.T) {
+	m := NewJobManager(1, 4, time.Minute)
+	m.Start()
+
+	started := make(chan struct{})
+	running, err := m.Submit("test", "", func(ctx context.Context, job *Job) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	finished := make(chan JobSnapshot, 1)
+	queued, err := m.Submit("test", "", func(ctx context.Context, job *Job) (interface{}, error) {
+		t.Error("job queued before Stop must not run")
+		return nil, nil
+	}, func(snapshot JobSnapshot) { finished <- snapshot })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Stop()
+	m.Stop() // 重复调用无副作用
+
+	if snapshot := <-finished; snapshot.Status != JobCancelled {
+		t.Errorf("queued job status = %s, want cancelled", snapshot.Status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !running.Snapshot().Finished() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := running.Snapshot().Status; status != JobCancelled {
+		t.Errorf("running job status = %s, want cancelled", status)
+	}
+	if queued.Snapshot().Status != JobCancelled {
+		t.Errorf("queued job not cancelled")
+	}
+	if _, err := m.Submit("test", "", func(ctx context.Context, job *Job) (interface{}, error) { return nil, nil }, nil); err != ErrJobManagerStopped {
+		t.Errorf("Submit after Stop: err = %v, want ErrJobManagerStopped", err)
+	}
+}
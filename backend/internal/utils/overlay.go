@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"toGif-backend/internal/models"
+)
+
+// 字幕限制
+const (
+	maxCaptions      = 10
+	maxCaptionLength = 200
+)
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// 字幕字体文件路径，drawtext需要显式指定字体以支持中文
+var captionFontFile = "./fonts/caption.ttf"
+
+// fallbackCaptionFonts 配置的字体不存在时依次尝试的常见中文系统字体
+var fallbackCaptionFonts = []string{
+	"/usr/share/fonts/noto/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/opentype/noto/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/google-noto-cjk/NotoSansCJK-Regular.ttc",
+	"/usr/share/fonts/wqy-microhei/wqy-microhei.ttc",
+	"/usr/share/fonts/truetype/wqy/wqy-microhei.ttc",
+	"/System/Library/Fonts/PingFang.ttc",
+}
+
+// InitCaptionFont 设置字幕使用的字体文件，启动时调用
+// 配置的字体不存在时改用已安装的中文系统字体，都不存在时记录警告，添加文字字幕的请求会返回错误
+func InitCaptionFont(path string) {
+	if path != "" {
+		captionFontFile = path
+	}
+	if CheckCaptionFont() == nil {
+		return
+	}
+	for _, fallback := range fallbackCaptionFonts {
+		if _, err := os.Stat(fallback); err == nil {
+			log.Printf("字幕字体 %s 不存在，使用系统字体 %s", captionFontFile, fallback)
+			captionFontFile = fallback
+			return
+		}
+	}
+	log.Printf("字幕字体 %s 不存在，文字字幕不可用，请通过CAPTION_FONT_FILE指定支持中文的字体文件", captionFontFile)
+}
+
+// CheckCaptionFont 检查字幕字体是否可用
+func CheckCaptionFont() error {
+	if _, err := os.Stat(captionFontFile); err != nil {
+		return fmt.Errorf("字幕字体不可用: %v", err)
+	}
+	return nil
+}
+
+// CaptionFilter 字幕滤镜，文字内容写入临时文件后通过textfile引用，避免在滤镜中转义用户文本
+type CaptionFilter struct {
+	Caption  models.Caption
+	TextFile string
+}
+
+// WatermarkFilter 图片水印滤镜
+type WatermarkFilter struct {
+	Path     string
+	Position string
+	Opacity  float64
+}
+
+// ValidateCaptions 校验字幕参数并填充默认值
+func ValidateCaptions(captions []models.Caption) error {
+	if len(captions) > maxCaptions {
+		return fmt.Errorf("字幕最多%d条", maxCaptions)
+	}
+
+	for i := range captions {
+		c := &captions[i]
+		if strings.TrimSpace(c.Text) == "" {
+			return fmt.Errorf("第%d条字幕内容不能为空", i+1)
+		}
+		if utf8.RuneCountInString(c.Text) > maxCaptionLength {
+			return fmt.Errorf("第%d条字幕不能超过%d个字符", i+1, maxCaptionLength)
+		}
+
+		if c.Position == "" {
+			c.Position = "bottom"
+		}
+		if c.Position != "top" && c.Position != "center" && c.Position != "bottom" {
+			return fmt.Errorf("第%d条字幕位置只能是top/center/bottom", i+1)
+		}
+
+		if c.FontSize == 0 {
+			c.FontSize = 24
+		}
+		if c.FontSize < 8 || c.FontSize > 200 {
+			return fmt.Errorf("第%d条字幕字号必须在8-200之间", i+1)
+		}
+
+		if c.Color == "" {
+			c.Color = "#FFFFFF"
+		}
+		if c.OutlineColor == "" {
+			c.OutlineColor = "#000000"
+		}
+		if !hexColorPattern.MatchString(c.Color) || !hexColorPattern.MatchString(c.OutlineColor) {
+			return fmt.Errorf("第%d条字幕颜色格式应为#RRGGBB", i+1)
+		}
+
+		if c.OutlineWidth == nil {
+			defaultOutline := 2
+			c.OutlineWidth = &defaultOutline
+		}
+		if *c.OutlineWidth < 0 || *c.OutlineWidth > 10 {
+			return fmt.Errorf("第%d条字幕描边宽度必须在0-10之间", i+1)
+		}
+
+		if c.StartTime != nil && *c.StartTime < 0 {
+			return fmt.Errorf("第%d条字幕开始时间不能小于0", i+1)
+		}
+		if c.StartTime != nil && c.EndTime != nil && *c.EndTime <= *c.StartTime {
+			return fmt.Errorf("第%d条字幕结束时间必须大于开始时间", i+1)
+		}
+	}
+	return nil
+}
+
+// WriteCaptionFiles 将字幕文本写入临时文件，返回可用于滤镜的字幕列表
+func WriteCaptionFiles(captions []models.Caption, pathPrefix string) ([]CaptionFilter, error) {
+	filters := make([]CaptionFilter, 0, len(captions))
+	for i, caption := range captions {
+		textFile := fmt.Sprintf("%s_caption%d.txt", pathPrefix, i)
+		if err := os.WriteFile(textFile, []byte(caption.Text), 0644); err != nil {
+			RemoveCaptionFiles(filters)
+			return nil, fmt.Errorf("写入字幕文件失败: %v", err)
+		}
+		filters = append(filters, CaptionFilter{Caption: caption, TextFile: textFile})
+	}
+	return filters, nil
+}
+
+// RemoveCaptionFiles 清理字幕临时文件
+func RemoveCaptionFiles(filters []CaptionFilter) {
+	for _, f := range filters {
+		os.Remove(f.TextFile)
+	}
+}
+
+// filter 生成drawtext滤镜，所有参数均已校验或由服务端生成
+func (c CaptionFilter) filter() string {
+	var y string
+	switch c.Caption.Position {
+	case "top":
+		y = "h*0.05"
+	case "center":
+		y = "(h-text_h)/2"
+	default:
+		y = "h-text_h-h*0.05"
+	}
+
+	filter := fmt.Sprintf("drawtext=fontfile='%s':textfile='%s':expansion=none:fontsize=%d:fontcolor=0x%s:borderw=%d:bordercolor=0x%s:x=(w-text_w)/2:y=%s",
+		escapeFilterPath(captionFontFile), escapeFilterPath(c.TextFile), c.Caption.FontSize,
+		c.Caption.Color[1:], *c.Caption.OutlineWidth, c.Caption.OutlineColor[1:], y)
+
+	// 显示时间段，时间基于输出画面的时间轴
+	if c.Caption.StartTime != nil || c.Caption.EndTime != nil {
+		start := 0.0
+		if c.Caption.StartTime != nil {
+			start = *c.Caption.StartTime
+		}
+		if c.Caption.EndTime != nil {
+			filter += fmt.Sprintf(":enable='between(t,%.3f,%.3f)'", start, *c.Caption.EndTime)
+		} else {
+			filter += fmt.Sprintf(":enable='gte(t,%.3f)'", start)
+		}
+	}
+	return filter
+}
+
+// ValidateWatermark 校验水印参数并填充默认值
+func ValidateWatermark(w *WatermarkFilter) error {
+	if w.Position == "" {
+		w.Position = "bottom-right"
+	}
+	switch w.Position {
+	case "top-left", "top-right", "bottom-left", "bottom-right", "center":
+	default:
+		return fmt.Errorf("水印位置只能是top-left/top-right/bottom-left/bottom-right/center")
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("水印透明度必须在0-1之间")
+	}
+	return nil
+}
+
+// IsPNGFile 通过文件签名检查是否为PNG图片
+func IsPNGFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'})
+}
+
+// filter 生成水印叠加滤镜，接在已有滤镜链之后
+func (w WatermarkFilter) filter() string {
+	const margin = 10
+	var x, y string
+	switch w.Position {
+	case "top-left":
+		x, y = fmt.Sprint(margin), fmt.Sprint(margin)
+	case "top-right":
+		x, y = fmt.Sprintf("W-w-%d", margin), fmt.Sprint(margin)
+	case "bottom-left":
+		x, y = fmt.Sprint(margin), fmt.Sprintf("H-h-%d", margin)
+	case "center":
+		x, y = "(W-w)/2", "(H-h)/2"
+	default:
+		x, y = fmt.Sprintf("W-w-%d", margin), fmt.Sprintf("H-h-%d", margin)
+	}
+
+	return fmt.Sprintf("[wmbase];movie='%s',format=rgba,colorchannelmixer=aa=%.2f[wm];[wmbase][wm]overlay=%s:%s",
+		escapeFilterPath(w.Path), w.Opacity, x, y)
+}
+
+// escapeFilterPath 转义滤镜参数中单引号包裹的路径
+func escapeFilterPath(path string) string {
+	return strings.ReplaceAll(path, "'", `'\''`)
+}
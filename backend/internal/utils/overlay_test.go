@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInitCaptionFontFallback 配置的字体不存在时改用已安装的系统字体
+func TestInitCaptionFontFallback(t *testing.T) {
+	previousFont, previousFallbacks := captionFontFile, fallbackCaptionFonts
+	t.Cleanup(func() { captionFontFile, fallbackCaptionFonts = previousFont, previousFallbacks })
+
+	dir := t.TempDir()
+	installed := filepath.Join(dir, "installed.ttc")
+	if err := os.WriteFile(installed, []byte("font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fallbackCaptionFonts = []string{filepath.Join(dir, "missing.ttc"), installed}
+
+	InitCaptionFont(filepath.Join(dir, "caption.ttf"))
+	if captionFontFile != installed {
+		t.Errorf("caption font = %s, want fallback %s", captionFontFile, installed)
+	}
+	if err := CheckCaptionFont(); err != nil {
+		t.Errorf("CheckCaptionFont: %v", err)
+	}
+
+	// 配置的字体存在时不使用系统字体
+	configured := filepath.Join(dir, "caption.ttf")
+	if err := os.WriteFile(configured, []byte("font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	InitCaptionFont(configured)
+	if captionFontFile != configured {
+		t.Errorf("caption font = %s, want configured %s", captionFontFile, configured)
+	}
+
+	fallbackCaptionFonts = nil
+	InitCaptionFont(filepath.Join(dir, "none.ttf"))
+	if CheckCaptionFont() == nil {
+		t.Error("CheckCaptionFont succeeded without any font")
+	}
+}
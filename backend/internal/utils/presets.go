@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+
+	"toGif-backend/internal/models"
+)
+
+// DefaultPreset 未指定质量时使用的预设
+const DefaultPreset = "medium"
+
+// CustomPreset 请求中内联的自定义预设未命名时使用的名称
+const CustomPreset = "custom"
+
+// builtinPresets 内置预设，配置文件中同名预设会覆盖对应项
+var builtinPresets = []models.Preset{
+	{Name: "ultra", Label: "超高质量", FPS: 25, Scaler: "lanczos", MaxColors: 256, StatsMode: "diff", Dither: "floyd_steinberg", Width: 720},
+	{Name: "high", Label: "高质量", FPS: 18, Scaler: "lanczos", MaxColors: 192, StatsMode: "diff", Dither: "floyd_steinberg", Width: 600},
+	{Name: "medium", Label: "中等质量", FPS: 15, Scaler: "bicubic", MaxColors: 128, Dither: "bayer:bayer_scale=2", Width: 480},
+	{Name: "low", Label: "低质量", FPS: 8, Scaler: "bicubic", MaxColors: 32, ReserveTransparent: true, Dither: "none", Width: 240},
+	{Name: "adaptive", Label: "场景自适应", FPS: 18, Scaler: "lanczos", MaxColors: 256, StatsMode: "diff", Dither: "floyd_steinberg", Width: 600, SceneThreshold: 0.3},
+}
+
+// presets 当前生效的预设，按列表顺序展示
+var presets = slices.Clone(builtinPresets)
+
+var (
+	presetNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	bayerDither       = regexp.MustCompile(`^bayer(:bayer_scale=[0-5])?$`)
+)
+
+// InitPresets 从JSON文件加载预设列表，与内置预设按名称合并
+// 文件不存在时只使用内置预设，文件内容无效时返回错误且不修改当前预设
+func InitPresets(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded []models.Preset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("预设文件格式错误: %v", err)
+	}
+
+	merged := slices.Clone(builtinPresets)
+	for i := range loaded {
+		if err := ValidatePreset(&loaded[i]); err != nil {
+			return fmt.Errorf("预设%q无效: %v", loaded[i].Name, err)
+		}
+		index := slices.IndexFunc(merged, func(p models.Preset) bool { return p.Name == loaded[i].Name })
+		if index >= 0 {
+			merged[index] = loaded[i]
+		} else {
+			merged = append(merged, loaded[i])
+		}
+	}
+	presets = merged
+	return nil
+}
+
+// Presets 返回当前所有预设
+func Presets() []models.Preset {
+	return slices.Clone(presets)
+}
+
+// LookupPreset 按名称查找预设
+func LookupPreset(name string) (models.Preset, bool) {
+	index := slices.IndexFunc(presets, func(p models.Preset) bool { return p.Name == name })
+	if index < 0 {
+		return models.Preset{}, false
+	}
+	return presets[index], true
+}
+
+// ValidatePreset 校验预设参数，未设置的名称、缩放算法和默认宽度使用默认值
+// 参数会拼接到ffmpeg滤镜中，缩放算法和抖动方式只接受白名单中的值
+func ValidatePreset(p *models.Preset) error {
+	if p.Name == "" {
+		p.Name = CustomPreset
+	}
+	if p.Scaler == "" {
+		p.Scaler = "lanczos"
+	}
+	if p.Dither == "" {
+		p.Dither = "none"
+	}
+	if p.Width == 0 {
+		p.Width = 480
+	}
+
+	switch {
+	case !presetNamePattern.MatchString(p.Name):
+		return fmt.Errorf("名称只能包含小写字母、数字、-和_，最长32个字符")
+	case p.FPS < 1 || p.FPS > 50:
+		return fmt.Errorf("帧率必须在1-50之间")
+	case p.MaxColors < 2 || p.MaxColors > 256:
+		return fmt.Errorf("颜色数必须在2-256之间")
+	case p.Width < 100 || p.Width > 3840:
+		// 与视频转换接口的宽度范围一致
+		return fmt.Errorf("默认宽度必须在100-3840像素之间")
+	case !slices.Contains([]string{"lanczos", "bicubic", "bilinear", "neighbor", "area", "spline", "gauss", "sinc"}, p.Scaler):
+		return fmt.Errorf("不支持的缩放算法: %s", p.Scaler)
+	case !slices.Contains([]string{"", "full", "diff", "single"}, p.StatsMode):
+		return fmt.Errorf("统计模式只能是full/diff/single")
+	case p.SceneThreshold < 0 || p.SceneThreshold >= 1:
+		return fmt.Errorf("场景切换阈值必须在0-1之间")
+	case p.SceneThreshold > 0 && p.StatsMode == "single":
+		return fmt.Errorf("场景自适应调色板不能与single统计模式同时使用")
+	case !bayerDither.MatchString(p.Dither) &&
+		!slices.Contains([]string{"none", "floyd_steinberg", "sierra2", "sierra2_4a", "sierra3", "burkes", "atkinson", "heckbert"}, p.Dither):
+		return fmt.Errorf("不支持的抖动方式: %s", p.Dither)
+	}
+	return nil
+}
+
+// PresetPaletteParams 根据预设生成调色板模式参数，width不大于0时使用预设的默认宽度
+func PresetPaletteParams(p models.Preset, width int) PaletteParams {
+	if width <= 0 {
+		width = p.Width
+	}
+	return PaletteParams{
+		Width:              width,
+		FPS:                p.FPS,
+		Scaler:             p.Scaler,
+		MaxColors:          p.MaxColors,
+		ReserveTransparent: p.ReserveTransparent,
+		StatsMode:          p.StatsMode,
+		Dither:             p.Dither,
+	}
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"testing"
+
+	"toGif-backend/internal/models"
+)
+
+func TestValidatePresetWidth(t *testing.T) {
+	tests := []struct {
+		width   int
+		wantErr bool
+	}{
+		{0, false}, // 使用默认宽度
+		{99, true},
+		{100, false},
+		{3840, false},
+		{3841, true},
+	}
+	for _, tt := range tests {
+		p := models.Preset{FPS: 10, MaxColors: 64, Width: tt.width}
+		if err := ValidatePreset(&p); (err != nil) != tt.wantErr {
+			t.Errorf("width %d: err = %v, wantErr %v", tt.width, err, tt.wantErr)
+		}
+	}
+}
+
+// TestAnimationQualityFromPresetParams 编码参数只取决于预设参数，与预设名称无关
+func TestAnimationQualityFromPresetParams(t *testing.T) {
+	ultra, _ := LookupPreset("ultra")
+	low, _ := LookupPreset("low")
+
+	tests := []struct {
+		format  string
+		preset  models.Preset
+		fps     int
+		quality int
+	}{
+		{FormatWebP, ultra, 25, 90},
+		{FormatWebP, low, 8, 55},
+		{FormatAVIF, ultra, 25, 20},
+		{FormatAVIF, low, 8, 42},
+		{FormatAPNG, ultra, 18, 0},
+		{FormatAPNG, low, 6, 0},
+	}
+	for _, tt := range tests {
+		custom := tt.preset
+		custom.Name = CustomPreset
+		for _, preset := range []models.Preset{tt.preset, custom} {
+			q := animationQuality(tt.format, preset)
+			if q.fps != tt.fps || q.quality != tt.quality {
+				t.Errorf("%s/%s: got fps=%d quality=%d, want fps=%d quality=%d",
+					tt.format, preset.Name, q.fps, q.quality, tt.fps, tt.quality)
+			}
+		}
+	}
+}
+
+func TestEncodeWeight(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		fps       int
+		maxColors int
+		width     int
+		want      int
+	}{
+		{"low", FormatGIF, 8, 32, 240, 1},
+		{"medium", FormatGIF, 15, 128, 480, 1},
+		{"high fps", FormatGIF, 24, 64, 480, 2},
+		{"many colors", FormatWebP, 10, 256, 480, 2},
+		{"ultra 4k", FormatGIF, 25, 256, 3840, 8},
+		{"avif", FormatAVIF, 8, 32, 1000, 4},
+		{"plain encode", "", 0, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := EncodeWeight(tt.format, tt.fps, tt.maxColors, tt.width); got != tt.want {
+			t.Errorf("%s: EncodeWeight = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
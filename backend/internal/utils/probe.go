@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"toGif-backend/internal/models"
+)
+
+// ErrUnknownDuration 无法确定媒体时长
+var ErrUnknownDuration = errors.New("无法确定视频时长")
+
+// ffprobeOutput ffprobe -show_format -show_streams 的JSON输出，数值字段多以字符串表示
+type ffprobeOutput struct {
+	Streams []ffprobeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// ffprobeStream ffprobe输出中的单个流
+type ffprobeStream struct {
+	Index        int               `json:"index"`
+	CodecName    string            `json:"codec_name"`
+	CodecType    string            `json:"codec_type"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	PixFmt       string            `json:"pix_fmt"`
+	AvgFrameRate string            `json:"avg_frame_rate"`
+	RFrameRate   string            `json:"r_frame_rate"`
+	Duration     string            `json:"duration"`
+	BitRate      string            `json:"bit_rate"`
+	SampleRate   string            `json:"sample_rate"`
+	Channels     int               `json:"channels"`
+	Tags         map[string]string `json:"tags"`
+	Disposition  map[string]int    `json:"disposition"`
+	SideDataList []struct {
+		Rotation *float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// ProbeMedia 使用ffprobe读取媒体文件的容器、时长和各个流的信息
+func (f *FFmpegService) ProbeMedia(ctx context.Context, inputPath string) (*models.MediaInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, ffprobeTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", inputPath}
+	if err := f.runner.Run(ctx, "ffprobe", args, &stdout, &stderr); err != nil {
+		if ctxErr := contextError(ctx, nil); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("无法识别的媒体文件: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &probe); err != nil {
+		return nil, fmt.Errorf("解析ffprobe输出失败: %v", err)
+	}
+
+	return parseMediaInfo(&probe), nil
+}
+
+// GetVideoDuration 获取视频时长，无法确定时返回ErrUnknownDuration
+func (f *FFmpegService) GetVideoDuration(ctx context.Context, inputPath string) (float64, error) {
+	info, err := f.ProbeMedia(ctx, inputPath)
+	if err != nil {
+		return 0, err
+	}
+	if info.Duration <= 0 {
+		return 0, ErrUnknownDuration
+	}
+	return info.Duration, nil
+}
+
+// parseMediaInfo 将ffprobe输出转换为MediaInfo
+// 容器没有时长时取各流时长的最大值，主视频流跳过封面图片
+func parseMediaInfo(probe *ffprobeOutput) *models.MediaInfo {
+	info := &models.MediaInfo{
+		Container: probe.Format.FormatName,
+		Duration:  parseProbeFloat(probe.Format.Duration),
+		Size:      parseProbeInt(probe.Format.Size),
+		BitRate:   parseProbeInt(probe.Format.BitRate),
+		Streams:   make([]models.MediaStream, 0, len(probe.Streams)),
+	}
+
+	var streamDuration float64
+	mainVideo := -1
+	for i, s := range probe.Streams {
+		stream := models.MediaStream{
+			Index:      s.Index,
+			Type:       s.CodecType,
+			Codec:      s.CodecName,
+			Duration:   parseProbeFloat(s.Duration),
+			BitRate:    parseProbeInt(s.BitRate),
+			Width:      s.Width,
+			Height:     s.Height,
+			PixFmt:     s.PixFmt,
+			SampleRate: int(parseProbeInt(s.SampleRate)),
+			Channels:   s.Channels,
+		}
+
+		switch s.CodecType {
+		case "video":
+			stream.FrameRate = parseFrameRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseFrameRate(s.RFrameRate)
+			}
+			if mainVideo < 0 && s.Disposition["attached_pic"] == 0 {
+				mainVideo = i
+			}
+		case "audio":
+			info.HasAudio = true
+		}
+
+		streamDuration = math.Max(streamDuration, stream.Duration)
+		info.Streams = append(info.Streams, stream)
+	}
+
+	if info.Duration <= 0 {
+		info.Duration = streamDuration
+	}
+
+	if mainVideo >= 0 {
+		s := probe.Streams[mainVideo]
+		info.VideoCodec = s.CodecName
+		info.FrameRate = info.Streams[mainVideo].FrameRate
+		info.Rotation = streamRotation(s)
+		info.Width, info.Height = s.Width, s.Height
+		// ffmpeg默认按旋转信息自动旋转画面，宽高以显示方向为准
+		if info.Rotation == 90 || info.Rotation == 270 {
+			info.Width, info.Height = s.Height, s.Width
+		}
+	}
+
+	return info
+}
+
+// streamRotation 读取视频流的顺时针旋转角度，新版ffmpeg使用display matrix，旧版使用rotate标签
+func streamRotation(s ffprobeStream) int {
+	rotation := 0
+	for _, side := range s.SideDataList {
+		if side.Rotation != nil {
+			// display matrix中的角度为逆时针方向
+			rotation = -int(math.Round(*side.Rotation))
+			break
+		}
+	}
+	if rotation == 0 {
+		if tag, ok := s.Tags["rotate"]; ok {
+			rotation, _ = strconv.Atoi(tag)
+		}
+	}
+	return ((rotation % 360) + 360) % 360 / 90 * 90
+}
+
+// parseFrameRate 解析ffprobe的分数帧率，如 30000/1001
+func parseFrameRate(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	if !ok {
+		return parseProbeFloat(value)
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// parseProbeFloat 解析ffprobe的数值字符串，N/A等无效值返回0
+func parseProbeFloat(value string) float64 {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// parseProbeInt 解析ffprobe的整数字符串，N/A等无效值返回0
+func parseProbeInt(value string) int64 {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package utils
+
+import "os/exec"
+
+// setProcessGroup Windows下没有进程组，取消时由exec.CommandContext直接结束进程
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// CommandRunner 执行外部命令（ffmpeg/ffprobe），测试时可替换为utilstest.FakeRunner
+type CommandRunner interface {
+	// Run 执行命令直到结束，标准输出和标准错误分别写入stdout和stderr
+	Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error
+	// LookPath 查找可执行文件
+	LookPath(name string) (string, error)
+}
+
+// ExecRunner 通过os/exec执行真实进程
+type ExecRunner struct{}
+
+// Run 执行命令，取消或超时时结束整个进程组
+func (ExecRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	cmd := newCommand(ctx, name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// LookPath 在PATH中查找可执行文件
+func (ExecRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// defaultRunner 处理请求时创建FFmpegService使用的命令执行器
+var defaultRunner CommandRunner = ExecRunner{}
+
+// SetDefaultRunner 替换默认命令执行器，需在InitEncoder之前调用
+func SetDefaultRunner(runner CommandRunner) {
+	if runner != nil {
+		defaultRunner = runner
+	}
+}
+
+// DefaultRunner 默认命令执行器
+func DefaultRunner() CommandRunner {
+	return defaultRunner
+}
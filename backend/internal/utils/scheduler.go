@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrEncodeQueueFull 编码等待队列已满
+var ErrEncodeQueueFull = errors.New("编码队列已满")
+
+// EncodeScheduler 全局编码调度器，按权重限制同时运行的ffmpeg进程
+// 容量以权重单位计算，等待者严格按先进先出顺序获得执行权，避免大任务饿死
+// 异步任务在提交时通过Reserve预留排队位置，之后申请资源时不会因队列已满而失败
+type EncodeScheduler struct {
+	mu       sync.Mutex
+	capacity int
+	used     int
+	maxQueue int
+	reserved int // 已预留但尚未申请资源的任务数
+	waiters  []*encodeWaiter
+	// 单个编码平均占用时长，用于估算Retry-After
+	avgHold time.Duration
+}
+
+// encodeWaiter 等待执行的编码请求
+type encodeWaiter struct {
+	weight     int
+	ready      chan struct{}
+	onPosition func(position int)
+}
+
+// SchedulerStats 调度器状态
+type SchedulerStats struct {
+	Capacity int
+	Used     int
+	Queued   int
+	Reserved int
+}
+
+// EncodeReservation 提交异步任务时预留的排队位置，只能使用一次
+type EncodeReservation struct {
+	scheduler *EncodeScheduler
+	once      sync.Once
+}
+
+var encodeScheduler = NewEncodeScheduler(runtime.NumCPU(), 16)
+
+// InitEncodeScheduler 初始化全局编码调度器
+func InitEncodeScheduler(capacity, queueSize int) {
+	encodeScheduler = NewEncodeScheduler(capacity, queueSize)
+}
+
+// GetEncodeScheduler 获取全局编码调度器
+func GetEncodeScheduler() *EncodeScheduler {
+	return encodeScheduler
+}
+
+// NewEncodeScheduler 创建编码调度器
+func NewEncodeScheduler(capacity, maxQueue int) *EncodeScheduler {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &EncodeScheduler{
+		capacity: capacity,
+		maxQueue: maxQueue,
+		avgHold:  30 * time.Second,
+	}
+}
+
+// EncodeWeight 根据输出格式、帧率、调色板颜色数和输出宽度估算编码开销
+// 帧率不低于18或颜色数不少于192时开销按两倍计算（对应内置的high/ultra预设），AVIF使用AV1编码同样按两倍计算
+// 宽度每增加960像素开销翻倍，例如 low@240 为1，ultra@3840 为8；fps和maxColors为0表示不涉及调色板的普通编码
+func EncodeWeight(format string, fps, maxColors, width int) int {
+	qualityFactor := 1
+	if fps >= 18 || maxColors >= 192 || format == FormatAVIF {
+		qualityFactor = 2
+	}
+
+	widthFactor := (width + 959) / 960
+	if widthFactor < 1 {
+		widthFactor = 1
+	}
+
+	return qualityFactor * widthFactor
+}
+
+// Acquire 申请编码资源，资源不足时排队等待
+// onPosition 在进入队列及排队位置变化时回调（位置从1开始），返回的release必须调用以归还资源
+func (s *EncodeScheduler) Acquire(ctx context.Context, weight int, onPosition func(position int)) (func(), error) {
+	return s.acquire(ctx, weight, onPosition, nil)
+}
+
+// Reserve 为即将提交的异步任务预留排队位置，排队已满时返回false
+// 预留的位置通过EncodeReservation.Acquire使用，任务未执行就结束时必须调用Release归还
+func (s *EncodeScheduler) Reserve() (*EncodeReservation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.full() {
+		return nil, false
+	}
+	s.reserved++
+	return &EncodeReservation{scheduler: s}, true
+}
+
+// Acquire 使用预留的位置申请编码资源，资源不足时排队等待但不受队列长度限制
+func (r *EncodeReservation) Acquire(ctx context.Context, weight int, onPosition func(position int)) (func(), error) {
+	return r.scheduler.acquire(ctx, weight, onPosition, r)
+}
+
+// Release 归还未使用的预留位置，已使用或已归还时不做任何事
+func (r *EncodeReservation) Release() {
+	r.take()
+}
+
+// take 消耗预留位置，返回是否为首次消耗
+func (r *EncodeReservation) take() bool {
+	taken := false
+	r.once.Do(func() {
+		r.scheduler.mu.Lock()
+		r.scheduler.reserved--
+		r.scheduler.mu.Unlock()
+		taken = true
+	})
+	return taken
+}
+
+// acquire 申请编码资源，reservation非空且未使用时不检查队列长度
+func (s *EncodeScheduler) acquire(ctx context.Context, weight int, onPosition func(position int), reservation *EncodeReservation) (func(), error) {
+	weight = min(max(weight, 1), s.capacity)
+	reserved := reservation != nil && reservation.take()
+
+	s.mu.Lock()
+	if len(s.waiters) == 0 && s.used+weight <= s.capacity {
+		s.used += weight
+		s.mu.Unlock()
+		return s.releaser(weight), nil
+	}
+	if !reserved && len(s.waiters)+s.reserved >= s.maxQueue {
+		s.mu.Unlock()
+		return nil, ErrEncodeQueueFull
+	}
+
+	w := &encodeWaiter{
+		weight:     weight,
+		ready:      make(chan struct{}),
+		onPosition: onPosition,
+	}
+	s.waiters = append(s.waiters, w)
+	position := len(s.waiters)
+	s.mu.Unlock()
+
+	if onPosition != nil {
+		onPosition(position)
+	}
+
+	select {
+	case <-w.ready:
+		return s.releaser(weight), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// 取消的同时已获得资源，直接归还
+			s.mu.Unlock()
+			s.releaser(weight)()
+			return nil, ctx.Err()
+		default:
+		}
+		s.removeWaiter(w)
+		notify := s.dispatch()
+		s.mu.Unlock()
+		notify()
+		return nil, ctx.Err()
+	}
+}
+
+// QueueFull 是否无法再接受新的编码任务
+func (s *EncodeScheduler) QueueFull() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.full()
+}
+
+// full 排队中和已预留的任务是否已占满等待队列和空闲容量（调用方需持有锁）
+// 空闲容量按每个任务至少占用一个权重单位计算，有空闲容量时即使等待队列长度为0也可以接受任务
+func (s *EncodeScheduler) full() bool {
+	free := max(s.capacity-s.used, 0)
+	return len(s.waiters)+s.reserved >= s.maxQueue+free
+}
+
+// Stats 获取调度器当前状态
+func (s *EncodeScheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SchedulerStats{
+		Capacity: s.capacity,
+		Used:     s.used,
+		Queued:   len(s.waiters),
+		Reserved: s.reserved,
+	}
+}
+
+// RetryAfter 根据排队长度和平均编码时长估算客户端重试等待时间
+func (s *EncodeScheduler) RetryAfter() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := s.avgHold * time.Duration(len(s.waiters)+s.reserved+1) / time.Duration(s.capacity)
+	return max(wait, 5*time.Second)
+}
+
+// releaser 生成只会生效一次的资源归还函数
+func (s *EncodeScheduler) releaser(weight int) func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.used -= weight
+			// 指数加权平均，平滑单次耗时波动
+			s.avgHold = (s.avgHold*4 + time.Since(start)) / 5
+			notify := s.dispatch()
+			s.mu.Unlock()
+			notify()
+		})
+	}
+}
+
+// dispatch 按顺序唤醒可以执行的等待者（调用方需持有锁），返回需在锁外执行的位置通知
+func (s *EncodeScheduler) dispatch() func() {
+	for len(s.waiters) > 0 && s.used+s.waiters[0].weight <= s.capacity {
+		w := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		s.used += w.weight
+		close(w.ready)
+	}
+
+	waiters := append([]*encodeWaiter(nil), s.waiters...)
+	return func() {
+		for i, w := range waiters {
+			if w.onPosition != nil {
+				w.onPosition(i + 1)
+			}
+		}
+	}
+}
+
+// removeWaiter 从等待队列中移除（调用方需持有锁）
+func (s *EncodeScheduler) removeWaiter(target *encodeWaiter) {
+	for i, w := range s.waiters {
+		if w == target {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+}
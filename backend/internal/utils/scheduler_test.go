@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueueFullConsidersFreeCapacity(t *testing.T) {
+	s := NewEncodeScheduler(2, 0)
+	if s.QueueFull() {
+		t.Fatal("queue reported full with free capacity and no waiters")
+	}
+
+	release, err := s.Acquire(context.Background(), 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.QueueFull() {
+		t.Error("queue not full with no free capacity and zero queue size")
+	}
+	release()
+	if s.QueueFull() {
+		t.Error("queue still full after capacity was released")
+	}
+}
+
+// TestReservationNeverFailsWithQueueFull 已预留位置的任务排队时不受队列长度限制
+func TestReservationNeverFailsWithQueueFull(t *testing.T) {
+	s := NewEncodeScheduler(1, 1)
+
+	first, ok := s.Reserve()
+	if !ok {
+		t.Fatal("first reservation rejected")
+	}
+	second, ok := s.Reserve()
+	if !ok {
+		t.Fatal("second reservation rejected")
+	}
+	if _, ok := s.Reserve(); ok {
+		t.Fatal("reservation accepted beyond queue size plus free capacity")
+	}
+
+	release, err := first.Acquire(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未预留的申请会看到队列已满
+	if _, err := s.Acquire(context.Background(), 1, nil); err != ErrEncodeQueueFull {
+		t.Fatalf("unreserved Acquire: err = %v, want ErrEncodeQueueFull", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		secondRelease, err := second.Acquire(context.Background(), 1, nil)
+		if err == nil {
+			secondRelease()
+		}
+		acquired <- err
+	}()
+
+	release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("reserved Acquire failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reserved Acquire did not complete")
+	}
+
+	if stats := s.Stats(); stats.Reserved != 0 || stats.Used != 0 || stats.Queued != 0 {
+		t.Errorf("stats after all jobs finished = %+v", stats)
+	}
+}
+
+func TestReservationRelease(t *testing.T) {
+	s := NewEncodeScheduler(1, 0)
+	r, ok := s.Reserve()
+	if !ok {
+		t.Fatal("reservation rejected with free capacity")
+	}
+	if !s.QueueFull() {
+		t.Error("queue not full while the only slot is reserved")
+	}
+	r.Release()
+	r.Release() // 重复归还无副作用
+	if s.QueueFull() || s.Stats().Reserved != 0 {
+		t.Errorf("reservation not returned: %+v", s.Stats())
+	}
+}
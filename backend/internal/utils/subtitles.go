@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 支持的字幕格式
+const (
+	SubtitleSRT = "srt"
+	SubtitleASS = "ass"
+	SubtitleVTT = "vtt"
+)
+
+// subtitleCue 一条字幕
+type subtitleCue struct {
+	start float64
+	end   float64
+	text  string
+}
+
+var (
+	// SRT时间轴: 00:00:01,000 --> 00:00:04,000
+	srtTimingPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2}):(\d{2})[,.](\d{1,3})\s*-->\s*(\d{1,2}):(\d{2}):(\d{2})[,.](\d{1,3})`)
+	// WebVTT时间轴，小时可省略，后面可以跟cue设置
+	vttTimingPattern = regexp.MustCompile(`^(?:(\d{1,2}):)?(\d{2}):(\d{2})\.(\d{3})\s+-->\s+(?:(\d{1,2}):)?(\d{2}):(\d{2})\.(\d{3})`)
+	// WebVTT中除b/i/u以外的标签（声音、class、时间戳等），转换为SRT时去掉
+	vttTagPattern = regexp.MustCompile(`</?(?:[^biu/>][^>]*|[biu][^>\s][^>]*)>`)
+	// ASS时间: H:MM:SS.cc
+	assTimePattern = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})\.(\d{2})$`)
+)
+
+// SubtitleFormat 根据扩展名判断字幕格式
+func SubtitleFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return SubtitleSRT
+	case ".ass", ".ssa":
+		return SubtitleASS
+	case ".vtt":
+		return SubtitleVTT
+	}
+	return ""
+}
+
+// PrepareSubtitles 校验字幕文件，按片段起止时间平移后写入outputPrefix对应的文件
+// SRT和WebVTT统一转换为SRT，ASS保留样式只平移时间，返回生成的文件路径和保留的字幕条数
+func PrepareSubtitles(inputPath, format string, startTime, duration float64, outputPrefix string) (string, int, error) {
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("读取字幕文件失败: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // 去掉UTF-8 BOM
+	if !utf8.Valid(data) {
+		return "", 0, fmt.Errorf("字幕文件必须使用UTF-8编码")
+	}
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var output string
+	var count int
+	switch format {
+	case SubtitleSRT, SubtitleVTT:
+		var cues []subtitleCue
+		if format == SubtitleSRT {
+			cues, err = parseSRT(content)
+		} else {
+			cues, err = parseVTT(content)
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		cues = shiftCues(cues, startTime, duration)
+		output, count = formatSRT(cues), len(cues)
+		format = SubtitleSRT
+	case SubtitleASS:
+		output, count, err = shiftASS(content, startTime, duration)
+		if err != nil {
+			return "", 0, err
+		}
+	default:
+		return "", 0, fmt.Errorf("不支持的字幕格式，请上传SRT/ASS/VTT文件")
+	}
+
+	outputPath := outputPrefix + "_subtitles." + format
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		return "", 0, fmt.Errorf("写入字幕文件失败: %v", err)
+	}
+	return outputPath, count, nil
+}
+
+// parseSRT 解析SRT字幕
+func parseSRT(content string) ([]subtitleCue, error) {
+	var cues []subtitleCue
+	lines := strings.Split(content, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		// 序号行可省略
+		cueNumber := len(cues) + 1
+		if _, err := strconv.Atoi(line); err == nil {
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("第%d条字幕缺少时间轴（第%d行）", cueNumber, i)
+			}
+			line = strings.TrimSpace(lines[i])
+		}
+
+		m := srtTimingPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("第%d条字幕时间轴格式错误（第%d行）: %s", cueNumber, i+1, line)
+		}
+		start := clockSeconds(m[1], m[2], m[3], m[4])
+		end := clockSeconds(m[5], m[6], m[7], m[8])
+		if end <= start {
+			return nil, fmt.Errorf("第%d条字幕结束时间必须大于开始时间（第%d行）", cueNumber, i+1)
+		}
+
+		var text []string
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+			text = append(text, strings.TrimSpace(lines[i]))
+		}
+		cues = append(cues, subtitleCue{start: start, end: end, text: strings.Join(text, "\n")})
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("字幕文件中没有有效的字幕")
+	}
+	return cues, nil
+}
+
+// parseVTT 解析WebVTT字幕
+func parseVTT(content string) ([]subtitleCue, error) {
+	lines := strings.Split(content, "\n")
+	if len(lines) == 0 || !strings.HasPrefix(strings.TrimSpace(lines[0]), "WEBVTT") {
+		return nil, fmt.Errorf("WebVTT文件必须以WEBVTT开头")
+	}
+
+	var cues []subtitleCue
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		// 跳过NOTE/STYLE/REGION块
+		if strings.HasPrefix(line, "NOTE") || line == "STYLE" || line == "REGION" {
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+				i++
+			}
+			continue
+		}
+
+		cueNumber := len(cues) + 1
+		if !strings.Contains(line, "-->") {
+			// cue标识行
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("第%d条字幕缺少时间轴（第%d行）", cueNumber, i)
+			}
+			line = strings.TrimSpace(lines[i])
+		}
+
+		m := vttTimingPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("第%d条字幕时间轴格式错误（第%d行）: %s", cueNumber, i+1, line)
+		}
+		start := clockSeconds(m[1], m[2], m[3], m[4])
+		end := clockSeconds(m[5], m[6], m[7], m[8])
+		if end <= start {
+			return nil, fmt.Errorf("第%d条字幕结束时间必须大于开始时间（第%d行）", cueNumber, i+1)
+		}
+
+		var text []string
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+			text = append(text, vttTagPattern.ReplaceAllString(strings.TrimSpace(lines[i]), ""))
+		}
+		cues = append(cues, subtitleCue{start: start, end: end, text: strings.Join(text, "\n")})
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("字幕文件中没有有效的字幕")
+	}
+	return cues, nil
+}
+
+// shiftCues 将字幕平移到片段时间轴，丢弃片段外的字幕并截断跨越边界的字幕
+func shiftCues(cues []subtitleCue, startTime, duration float64) []subtitleCue {
+	var shifted []subtitleCue
+	for _, cue := range cues {
+		start, end, ok := shiftRange(cue.start, cue.end, startTime, duration)
+		if !ok {
+			continue
+		}
+		shifted = append(shifted, subtitleCue{start: start, end: end, text: cue.text})
+	}
+	return shifted
+}
+
+// shiftRange 平移单个时间段，完全落在片段外时返回false
+func shiftRange(start, end, startTime, duration float64) (float64, float64, bool) {
+	start -= startTime
+	end -= startTime
+	if end <= 0 || (duration > 0 && start >= duration) {
+		return 0, 0, false
+	}
+	start = max(start, 0)
+	if duration > 0 {
+		end = min(end, duration)
+	}
+	return start, end, true
+}
+
+// formatSRT 输出SRT格式字幕
+func formatSRT(cues []subtitleCue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTimestamp(cue.start), srtTimestamp(cue.end), cue.text)
+	}
+	return b.String()
+}
+
+// shiftASS 平移ASS字幕[Events]中Dialogue的起止时间，其余内容原样保留
+func shiftASS(content string, startTime, duration float64) (string, int, error) {
+	lines := strings.Split(content, "\n")
+	if !strings.Contains(content, "[Script Info]") || !strings.Contains(content, "[Events]") {
+		return "", 0, fmt.Errorf("ASS文件缺少[Script Info]或[Events]段")
+	}
+
+	var output []string
+	inEvents := false
+	startField, endField, fieldCount := -1, -1, 0
+	count := 0
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inEvents = strings.EqualFold(trimmed, "[Events]")
+			output = append(output, line)
+			continue
+		}
+
+		if inEvents && strings.HasPrefix(trimmed, "Format:") {
+			fields := strings.Split(strings.TrimPrefix(trimmed, "Format:"), ",")
+			fieldCount = len(fields)
+			for j, field := range fields {
+				switch strings.TrimSpace(field) {
+				case "Start":
+					startField = j
+				case "End":
+					endField = j
+				}
+			}
+			output = append(output, line)
+			continue
+		}
+
+		if !inEvents || !strings.HasPrefix(trimmed, "Dialogue:") {
+			output = append(output, line)
+			continue
+		}
+
+		if startField < 0 || endField < 0 {
+			return "", 0, fmt.Errorf("ASS文件[Events]段缺少包含Start/End的Format行")
+		}
+
+		// 最后一个字段是文本，可能包含逗号
+		fields := strings.SplitN(strings.TrimPrefix(trimmed, "Dialogue:"), ",", fieldCount)
+		if len(fields) != fieldCount {
+			return "", 0, fmt.Errorf("第%d行字幕字段数量错误", i+1)
+		}
+
+		start, err := parseASSTime(fields[startField])
+		if err != nil {
+			return "", 0, fmt.Errorf("第%d行字幕开始时间格式错误: %s", i+1, strings.TrimSpace(fields[startField]))
+		}
+		end, err := parseASSTime(fields[endField])
+		if err != nil {
+			return "", 0, fmt.Errorf("第%d行字幕结束时间格式错误: %s", i+1, strings.TrimSpace(fields[endField]))
+		}
+		if end <= start {
+			return "", 0, fmt.Errorf("第%d行字幕结束时间必须大于开始时间", i+1)
+		}
+
+		start, end, ok := shiftRange(start, end, startTime, duration)
+		if !ok {
+			continue
+		}
+		fields[startField] = assTimestamp(start)
+		fields[endField] = assTimestamp(end)
+		output = append(output, "Dialogue:"+strings.Join(fields, ","))
+		count++
+	}
+
+	return strings.Join(output, "\n"), count, nil
+}
+
+// parseASSTime 解析ASS时间 H:MM:SS.cc
+func parseASSTime(value string) (float64, error) {
+	m := assTimePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid ass time: %s", value)
+	}
+	return clockSeconds(m[1], m[2], m[3], m[4]+"0"), nil
+}
+
+// clockSeconds 将时、分、秒、毫秒字段转换为秒数，毫秒字段不足三位时按小数处理
+func clockSeconds(hours, minutes, seconds, fraction string) float64 {
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	frac, _ := strconv.ParseFloat("0."+fraction, 64)
+	return float64(h*3600+m*60+s) + frac
+}
+
+// srtTimestamp 格式化SRT时间 HH:MM:SS,mmm
+func srtTimestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// assTimestamp 格式化ASS时间 H:MM:SS.cc
+func assTimestamp(seconds float64) string {
+	cs := int64(seconds*100 + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// subtitlesFilter 生成字幕烧录滤镜，字体目录与文字字幕共用
+func subtitlesFilter(path string) string {
+	return fmt.Sprintf("subtitles=filename='%s':charenc=UTF-8:fontsdir='%s'",
+		escapeFilterPath(path), escapeFilterPath(filepath.Dir(captionFontFile)))
+}
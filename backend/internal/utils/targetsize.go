@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TargetSizeResult 目标大小模式的搜索结果
+type TargetSizeResult struct {
+	Params   PaletteParams // 最终采用的参数
+	FileSize int64         // 最终文件大小
+	Attempts int           // 实际编码次数
+}
+
+// 目标大小搜索的质量阶梯，从高到低依次降低帧率、颜色数和抖动强度
+var targetSizeLevels = []PaletteParams{
+	{FPS: 20, MaxColors: 256, StatsMode: "diff", Dither: "floyd_steinberg"},
+	{FPS: 15, MaxColors: 192, StatsMode: "diff", Dither: "floyd_steinberg"},
+	{FPS: 12, MaxColors: 128, StatsMode: "diff", Dither: "bayer:bayer_scale=3"},
+	{FPS: 10, MaxColors: 96, Dither: "bayer:bayer_scale=2"},
+	{FPS: 8, MaxColors: 64, Dither: "bayer:bayer_scale=1"},
+	{FPS: 6, MaxColors: 32, Dither: "none"},
+}
+
+// 目标大小搜索的宽度缩放比例
+var targetSizeWidthScales = []float64{1, 0.85, 0.7, 0.55, 0.42, 0.3, 0.2}
+
+// targetSizeCandidate 搜索候选参数及其预估相对体积
+type targetSizeCandidate struct {
+	params PaletteParams
+	cost   float64
+}
+
+// ConvertVideoToGifTargetSize 在不超过targetSize字节的前提下搜索画质最好的GIF参数
+// 候选参数按预估体积从大到小排序，依据实测体积插值选择下一次尝试的位置，最多编码maxAttempts次
+func (f *FFmpegService) ConvertVideoToGifTargetSize(ctx context.Context, inputPath, outputPath string, startTime, duration float64, maxWidth int, targetSize int64, maxAttempts int, onAttempt func(attempt int)) (*TargetSizeResult, error) {
+	candidates := buildTargetSizeCandidates(maxWidth)
+
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+
+	// lo之前的候选已确认超出目标，hi及之后的候选已确认满足目标（hi为当前最佳）
+	lo, hi := 0, len(candidates)
+	var bestPath string
+	var bestSize int64
+	attempts := 0
+	probe := 0
+
+	defer func() {
+		// 清理除最终结果外的临时文件
+		for i := 1; i <= attempts; i++ {
+			tryPath := fmt.Sprintf("%s_try%d%s", base, i, ext)
+			if tryPath != bestPath {
+				os.Remove(tryPath)
+			}
+		}
+	}()
+
+	for lo < hi && attempts < maxAttempts {
+		attempts++
+		if onAttempt != nil {
+			onAttempt(attempts)
+		}
+
+		tryPath := fmt.Sprintf("%s_try%d%s", base, attempts, ext)
+		params := candidates[probe].params
+		if err := f.ConvertVideoToGifWithParams(ctx, inputPath, tryPath, startTime, duration, params); err != nil {
+			return nil, err
+		}
+
+		size, err := GetFileSize(tryPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if size <= targetSize {
+			hi = probe
+			if bestPath != "" {
+				os.Remove(bestPath)
+			}
+			bestPath, bestSize = tryPath, size
+		} else {
+			lo = probe + 1
+			os.Remove(tryPath)
+		}
+
+		if lo >= hi {
+			break
+		}
+		probe = nextTargetSizeProbe(candidates, lo, hi, probe, size, targetSize)
+	}
+
+	if bestPath == "" {
+		return nil, fmt.Errorf("经过%d次尝试仍无法将文件压缩到%d字节以内，请缩短时长或提高目标大小", attempts, targetSize)
+	}
+
+	if err := os.Rename(bestPath, outputPath); err != nil {
+		return nil, err
+	}
+	bestPath = outputPath
+
+	return &TargetSizeResult{
+		Params:   candidates[hi].params,
+		FileSize: bestSize,
+		Attempts: attempts,
+	}, nil
+}
+
+// buildTargetSizeCandidates 生成所有宽度与质量阶梯的组合，按预估体积从大到小排序
+// 体积近似与像素数、帧率成正比，颜色数和抖动影响较小
+func buildTargetSizeCandidates(maxWidth int) []targetSizeCandidate {
+	var candidates []targetSizeCandidate
+	seen := make(map[int]bool)
+	for _, scale := range targetSizeWidthScales {
+		width := int(float64(maxWidth)*scale) / 2 * 2
+		if width < 100 {
+			width = 100
+		}
+		if seen[width] {
+			continue
+		}
+		seen[width] = true
+
+		for _, level := range targetSizeLevels {
+			params := level
+			params.Width = width
+			ratio := float64(width) / float64(maxWidth)
+			colorFactor := 0.6 + 0.4*float64(params.MaxColors)/256
+			candidates = append(candidates, targetSizeCandidate{
+				params: params,
+				cost:   ratio * ratio * float64(params.FPS) * colorFactor,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].cost > candidates[j].cost
+	})
+	return candidates
+}
+
+// nextTargetSizeProbe 根据最近一次实测体积估算下一个候选位置，估算落在已探测区间外时退化为二分
+func nextTargetSizeProbe(candidates []targetSizeCandidate, lo, hi, last int, size, targetSize int64) int {
+	// 预留5%余量，尽量一次命中
+	want := candidates[last].cost * float64(targetSize) / float64(size) * 0.95
+
+	next := hi - 1
+	for i := lo; i < hi; i++ {
+		if candidates[i].cost <= want {
+			next = i
+			break
+		}
+	}
+
+	if next == last || next < lo || next >= hi {
+		next = (lo + hi) / 2
+	}
+	return next
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// 缩略图输出格式
+const (
+	ThumbnailJPEG = "jpeg"
+	ThumbnailWebP = "webp"
+)
+
+// ThumbnailOptions 缩略图提取参数
+type ThumbnailOptions struct {
+	Count          int     // 最多提取的帧数
+	Width          int     // 缩略图宽度，高度按比例计算
+	Format         string  // jpeg/webp
+	Scene          bool    // true时按场景切换提取，否则均匀间隔提取
+	SceneThreshold float64 // 场景切换阈值(0-1)，越小越敏感
+	Columns        int     // 雪碧图列数
+}
+
+// Thumbnail 提取出的单帧缩略图
+type Thumbnail struct {
+	Path      string
+	Timestamp float64 // 在原视频中的时间(秒)
+}
+
+// ThumbnailSet 缩略图提取结果
+type ThumbnailSet struct {
+	Thumbnails []Thumbnail
+	SpritePath string
+	Width      int // 单张缩略图宽度
+	Height     int // 单张缩略图高度
+	Columns    int
+	Rows       int
+}
+
+// Files 结果中的所有文件路径，包括缩略图和雪碧图
+func (s *ThumbnailSet) Files() []string {
+	files := make([]string, 0, len(s.Thumbnails)+1)
+	for _, thumb := range s.Thumbnails {
+		files = append(files, thumb.Path)
+	}
+	return append(files, s.SpritePath)
+}
+
+// showinfo滤镜日志中的帧信息行，分组为帧时间
+var showinfoTimePattern = regexp.MustCompile(`Parsed_showinfo.*\bpts_time:\s*([0-9.]+).*`)
+
+// ThumbnailExtension 缩略图文件扩展名
+func ThumbnailExtension(format string) string {
+	if format == ThumbnailWebP {
+		return "webp"
+	}
+	return "jpg"
+}
+
+// ExtractThumbnails 提取缩略图并拼接为雪碧图，所有文件写入outputDir
+func (f *FFmpegService) ExtractThumbnails(ctx context.Context, inputPath, outputDir string, duration float64, opts ThumbnailOptions) (*ThumbnailSet, error) {
+	var thumbnails []Thumbnail
+	var err error
+	if opts.Scene {
+		thumbnails, err = f.extractSceneThumbnails(ctx, inputPath, outputDir, opts)
+	} else {
+		thumbnails, err = f.extractIntervalThumbnails(ctx, inputPath, outputDir, duration, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(thumbnails) == 0 {
+		return nil, fmt.Errorf("未能从视频中提取到画面")
+	}
+
+	// 同一视频按相同宽度缩放，所有缩略图尺寸一致
+	info, err := f.ProbeMedia(ctx, thumbnails[0].Path)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := min(max(opts.Columns, 1), len(thumbnails))
+	rows := (len(thumbnails) + columns - 1) / columns
+	spritePath := filepath.Join(outputDir, "sprite."+ThumbnailExtension(opts.Format))
+
+	args := []string{
+		"-y",
+		"-framerate", "1",
+		"-start_number", "1",
+		"-i", filepath.Join(outputDir, "thumb_%03d."+ThumbnailExtension(opts.Format)),
+		"-vf", fmt.Sprintf("tile=%dx%d", columns, rows),
+		"-frames:v", "1",
+	}
+	args = append(args, thumbnailCodecArgs(opts.Format)...)
+	args = append(args, spritePath)
+
+	if output, err := f.runFFmpeg(ctx, args, "encode", 1, 1, 0); err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("生成雪碧图失败: %v, output: %s", err, string(output))
+	}
+
+	return &ThumbnailSet{
+		Thumbnails: thumbnails,
+		SpritePath: spritePath,
+		Width:      info.Width,
+		Height:     info.Height,
+		Columns:    columns,
+		Rows:       rows,
+	}, nil
+}
+
+// extractIntervalThumbnails 均匀间隔提取，每帧取所在区间的中点，逐帧使用输入端seek避免解码整个视频
+func (f *FFmpegService) extractIntervalThumbnails(ctx context.Context, inputPath, outputDir string, duration float64, opts ThumbnailOptions) ([]Thumbnail, error) {
+	var thumbnails []Thumbnail
+	for i := 0; i < opts.Count; i++ {
+		timestamp := duration * (float64(i) + 0.5) / float64(opts.Count)
+		path := filepath.Join(outputDir, fmt.Sprintf("thumb_%03d.%s", len(thumbnails)+1, ThumbnailExtension(opts.Format)))
+
+		args := []string{
+			"-ss", strconv.FormatFloat(timestamp, 'f', 3, 64),
+			"-i", inputPath,
+			"-y",
+			"-frames:v", "1",
+			"-vf", fmt.Sprintf("scale=%d:-2", opts.Width),
+			"-an",
+			"-update", "1",
+		}
+		args = append(args, thumbnailCodecArgs(opts.Format)...)
+		args = append(args, path)
+
+		if output, err := f.runFFmpeg(ctx, args, "encode", i+1, opts.Count, 0); err != nil {
+			if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("提取第%d帧失败: %v, output: %s", i+1, err, string(output))
+		}
+
+		// 视频末尾附近可能取不到帧，跳过即可
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		thumbnails = append(thumbnails, Thumbnail{Path: path, Timestamp: math.Round(timestamp*1000) / 1000})
+	}
+	return thumbnails, nil
+}
+
+// extractSceneThumbnails 按场景切换提取，第一帧总是保留，时间从showinfo滤镜日志中读取
+func (f *FFmpegService) extractSceneThumbnails(ctx context.Context, inputPath, outputDir string, opts ThumbnailOptions) ([]Thumbnail, error) {
+	pattern := filepath.Join(outputDir, "thumb_%03d."+ThumbnailExtension(opts.Format))
+	args := []string{
+		"-i", inputPath,
+		"-y",
+		"-vf", fmt.Sprintf("select='eq(n,0)+gt(scene,%.3f)',showinfo,scale=%d:-2", opts.SceneThreshold, opts.Width),
+		"-fps_mode", "vfr",
+		"-frames:v", strconv.Itoa(opts.Count),
+		"-an",
+	}
+	args = append(args, thumbnailCodecArgs(opts.Format)...)
+	args = append(args, pattern)
+
+	output, err := f.runFFmpeg(ctx, args, "encode", 1, 1, 0)
+	if err != nil {
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("场景检测失败: %v, output: %s", err, string(output))
+	}
+
+	var thumbnails []Thumbnail
+	for i, m := range showinfoTimePattern.FindAllSubmatch(output, -1) {
+		path := fmt.Sprintf(pattern, i+1)
+		if _, err := os.Stat(path); err != nil {
+			break
+		}
+		timestamp, _ := strconv.ParseFloat(string(m[1]), 64)
+		thumbnails = append(thumbnails, Thumbnail{Path: path, Timestamp: math.Round(timestamp*1000) / 1000})
+	}
+	return thumbnails, nil
+}
+
+// thumbnailCodecArgs 缩略图编码参数
+func thumbnailCodecArgs(format string) []string {
+	if format == ThumbnailWebP {
+		return []string{"-c:v", "libwebp", "-quality", "75"}
+	}
+	return []string{"-c:v", "mjpeg", "-q:v", "4"}
+}
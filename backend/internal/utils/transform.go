@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+
+	"toGif-backend/internal/models"
+)
+
+// 倒放需要把整段画面缓存在内存中，限制可处理的最长时长（秒）
+const maxReverseDuration = 60.0
+
+// ValidateTransform 校验画面变换参数，所有数值在拼接滤镜前必须经过校验
+// frameWidth和frameHeight为按旋转信息校正后的画面尺寸，大于0时裁剪区域不能超出画面
+func ValidateTransform(t *models.VideoTransform, duration float64, frameWidth, frameHeight int) error {
+	if t == nil {
+		return nil
+	}
+
+	if t.Crop != nil {
+		if t.Crop.X < 0 || t.Crop.Y < 0 {
+			return fmt.Errorf("裁剪起点不能为负数")
+		}
+		if t.Crop.Width < 16 || t.Crop.Height < 16 || t.Crop.Width > 7680 || t.Crop.Height > 7680 {
+			return fmt.Errorf("裁剪区域宽高必须在16-7680像素之间")
+		}
+		if frameWidth > 0 && frameHeight > 0 &&
+			(t.Crop.X+t.Crop.Width > frameWidth || t.Crop.Y+t.Crop.Height > frameHeight) {
+			return fmt.Errorf("裁剪区域超出视频画面(%dx%d)", frameWidth, frameHeight)
+		}
+	}
+
+	switch t.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("旋转角度只能是0/90/180/270")
+	}
+
+	if t.Speed != 0 && (t.Speed < 0.25 || t.Speed > 4) {
+		return fmt.Errorf("播放速度必须在0.25-4之间")
+	}
+
+	if t.Reverse && t.Boomerang {
+		return fmt.Errorf("倒放和往返播放不能同时使用")
+	}
+	if (t.Reverse || t.Boomerang) && duration > maxReverseDuration {
+		return fmt.Errorf("倒放和往返播放的片段时长不能超过%.0f秒", maxReverseDuration)
+	}
+
+	return nil
+}
+
+// TransformedDuration 计算应用变速和往返后的输出时长
+func TransformedDuration(t *models.VideoTransform, duration float64) float64 {
+	if t == nil {
+		return duration
+	}
+	if t.Speed > 0 {
+		duration /= t.Speed
+	}
+	if t.Boomerang {
+		duration *= 2
+	}
+	return duration
+}
+
+// transformFilterChain 根据已校验的参数生成滤镜链，滤镜参数全部由数值格式化得到，不拼接任何用户字符串
+// 返回画面几何变换（裁剪、旋转、翻转）和时间变换（变速、倒放、往返）两段，便于在中间插入按原始时间轴烧录的字幕
+func transformFilterChain(t *models.VideoTransform) (geometry, timing string) {
+	if t == nil {
+		return "", ""
+	}
+
+	chain := ""
+	add := func(filter string) {
+		if chain != "" {
+			chain += ","
+		}
+		chain += filter
+	}
+
+	if t.Crop != nil {
+		add(fmt.Sprintf("crop=%d:%d:%d:%d", t.Crop.Width, t.Crop.Height, t.Crop.X, t.Crop.Y))
+	}
+
+	switch t.Rotate {
+	case 90:
+		add("transpose=clock")
+	case 180:
+		add("hflip,vflip")
+	case 270:
+		add("transpose=cclock")
+	}
+
+	if t.FlipH {
+		add("hflip")
+	}
+	if t.FlipV {
+		add("vflip")
+	}
+
+	geometry, chain = chain, ""
+
+	if t.Speed > 0 && t.Speed != 1 {
+		add("setpts=" + strconv.FormatFloat(1/t.Speed, 'f', 4, 64) + "*PTS")
+	}
+
+	if t.Reverse {
+		add("reverse")
+	}
+	if t.Boomerang {
+		// 拆分为两路，一路倒放后与原画面拼接
+		add("split[fwd][rev];[rev]reverse[revd];[fwd][revd]concat=n=2:v=1:a=0")
+	}
+
+	return geometry, chain
+}
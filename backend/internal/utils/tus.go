@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TusVersion 支持的tus协议版本
+const TusVersion = "1.0.0"
+
+// TusExtensions 支持的tus协议扩展
+const TusExtensions = "creation,expiration,termination"
+
+// TusDir 可续传上传的临时目录，上传完成后文件按内容摘要移入UploadDir
+var TusDir = filepath.Join(UploadDir, "tus")
+
+var (
+	ErrTusNotFound = errors.New("上传不存在或已过期")
+	ErrTusOffset   = errors.New("上传偏移量不匹配")
+	ErrTusTooLarge = errors.New("文件大小超出限制")
+	ErrTusLocked   = errors.New("该上传正在写入")
+	ErrTusFinished = errors.New("上传已完成")
+)
+
+// TusUpload 可续传上传的状态，保存在 <id>.json 中，数据写入 <id>.part
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+	Hash      string            `json:"hash,omitempty"` // 上传完成后的内容摘要
+}
+
+// Finished 是否已上传完成
+func (u *TusUpload) Finished() bool {
+	return u.Hash != ""
+}
+
+// TusStore 可续传上传存储，每次写入后顺延过期时间，过期的上传由定时任务删除
+type TusStore struct {
+	dir     string
+	maxSize int64
+	expiry  time.Duration
+
+	mu     sync.Mutex
+	locked map[string]bool // 正在写入的上传，同一上传不允许并发PATCH
+}
+
+var tusStore = NewTusStore(TusDir, 500*1024*1024, 24*time.Hour)
+
+// InitTusStore 初始化全局可续传上传存储并启动过期清理
+func InitTusStore(maxSize int64, expiry time.Duration) {
+	tusStore = NewTusStore(TusDir, maxSize, expiry)
+	if err := os.MkdirAll(TusDir, 0755); err != nil {
+		log.Printf("创建续传目录失败: %v", err)
+	}
+	tusStore.Start()
+}
+
+// GetTusStore 获取全局可续传上传存储
+func GetTusStore() *TusStore {
+	return tusStore
+}
+
+// NewTusStore 创建可续传上传存储
+func NewTusStore(dir string, maxSize int64, expiry time.Duration) *TusStore {
+	if expiry <= 0 {
+		expiry = 24 * time.Hour
+	}
+	return &TusStore{
+		dir:     dir,
+		maxSize: maxSize,
+		expiry:  expiry,
+		locked:  make(map[string]bool),
+	}
+}
+
+// Start 启动过期上传的定时清理
+func (s *TusStore) Start() {
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for range ticker.C {
+			s.purgeExpired()
+		}
+	}()
+}
+
+// MaxSize 单个上传的最大字节数
+func (s *TusStore) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Create 创建上传，length为文件总大小
+func (s *TusStore) Create(length int64, metadata map[string]string) (*TusUpload, error) {
+	if s.maxSize > 0 && length > s.maxSize {
+		return nil, ErrTusTooLarge
+	}
+
+	upload := &TusUpload{
+		ID:        NewID(),
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.expiry),
+	}
+	if err := os.WriteFile(s.partPath(upload.ID), nil, 0644); err != nil {
+		return nil, err
+	}
+	if err := s.save(upload); err != nil {
+		os.Remove(s.partPath(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get 获取上传状态，未完成的上传以已写入的数据大小为偏移量
+func (s *TusStore) Get(id string) (*TusUpload, error) {
+	if !IsID(id) {
+		return nil, ErrTusNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		return nil, ErrTusNotFound
+	}
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, ErrTusNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrTusNotFound
+	}
+
+	if !upload.Finished() {
+		info, err := os.Stat(s.partPath(id))
+		if err != nil {
+			return nil, ErrTusNotFound
+		}
+		upload.Offset = info.Size()
+	}
+	return &upload, nil
+}
+
+// Append 从offset处追加写入数据，连接中断时保留已收到的部分，客户端可通过HEAD获取偏移量后续传
+// 写满Length后按内容摘要保存到UploadDir，之后可通过Resolve获取文件路径
+func (s *TusStore) Append(id string, offset int64, body io.Reader) (*TusUpload, error) {
+	if !s.lock(id) {
+		return nil, ErrTusLocked
+	}
+	defer s.unlock(id)
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Finished() {
+		return upload, ErrTusFinished
+	}
+	if offset != upload.Offset {
+		return upload, ErrTusOffset
+	}
+
+	file, err := os.OpenFile(s.partPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	written, copyErr := io.Copy(file, io.LimitReader(body, upload.Length-upload.Offset))
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(s.expiry)
+
+	if upload.Offset == upload.Length {
+		extension := strings.TrimPrefix(filepath.Ext(upload.Metadata["filename"]), ".")
+		_, hash, _, err := StoreUpload(s.partPath(id), strings.ToLower(extension))
+		if err != nil {
+			return nil, err
+		}
+		upload.Hash = hash
+	}
+
+	if err := s.save(upload); err != nil {
+		return nil, err
+	}
+	return upload, copyErr
+}
+
+// Terminate 删除上传及已写入的数据
+func (s *TusStore) Terminate(id string) error {
+	if !s.lock(id) {
+		return ErrTusLocked
+	}
+	defer s.unlock(id)
+
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	os.Remove(s.partPath(id))
+	artifactStore.Forget(id)
+	return os.Remove(s.infoPath(id))
+}
+
+// Resolve 返回已完成上传的文件路径，未完成、不存在或文件已被清理时返回false
+func (s *TusStore) Resolve(id string) (string, bool) {
+	upload, err := s.Get(id)
+	if err != nil || !upload.Finished() {
+		return "", false
+	}
+	return FindUpload(upload.Hash)
+}
+
+// purgeExpired 删除过期的上传
+func (s *TusStore) purgeExpired() {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, infoPath := range matches {
+		id := strings.TrimSuffix(filepath.Base(infoPath), ".json")
+		if !s.lock(id) {
+			continue
+		}
+		if _, err := s.Get(id); err == ErrTusNotFound {
+			os.Remove(s.partPath(id))
+			os.Remove(infoPath)
+			artifactStore.Forget(id)
+		}
+		s.unlock(id)
+	}
+}
+
+// save 写入上传状态，先写临时文件再重命名，避免中断时留下不完整的状态
+func (s *TusStore) save(upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tempPath := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, s.infoPath(upload.ID))
+}
+
+func (s *TusStore) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[id] {
+		return false
+	}
+	s.locked[id] = true
+	return true
+}
+
+func (s *TusStore) unlock(id string) {
+	s.mu.Lock()
+	delete(s.locked, id)
+	s.mu.Unlock()
+}
+
+func (s *TusStore) partPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+func (s *TusStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// ParseTusMetadata 解析Upload-Metadata请求头，格式为逗号分隔的"键 base64值"，值可以省略
+func ParseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("Upload-Metadata格式错误")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadDir 按内容寻址保存上传视频的目录
+const UploadDir = "uploads"
+
+// uploadHashPattern SHA-256十六进制摘要
+var uploadHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// uploadsInUse 进行中的任务正在使用的文件或目录（绝对路径）及引用计数，清理时跳过
+var (
+	uploadsInUseMu sync.Mutex
+	uploadsInUse   = make(map[string]int)
+)
+
+// RetainUploads 登记进行中的任务正在使用的文件或目录，清理时跳过，返回的release在任务结束时调用
+func RetainUploads(paths ...string) (release func()) {
+	keys := make([]string, 0, len(paths))
+	uploadsInUseMu.Lock()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		key := absPath(path)
+		uploadsInUse[key]++
+		keys = append(keys, key)
+	}
+	uploadsInUseMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			uploadsInUseMu.Lock()
+			defer uploadsInUseMu.Unlock()
+			for _, key := range keys {
+				if uploadsInUse[key]--; uploadsInUse[key] <= 0 {
+					delete(uploadsInUse, key)
+				}
+			}
+		})
+	}
+}
+
+// uploadInUse 判断文件或目录是否正被进行中的任务使用
+func uploadInUse(path string) bool {
+	uploadsInUseMu.Lock()
+	defer uploadsInUseMu.Unlock()
+	return uploadsInUse[absPath(path)] > 0
+}
+
+// absPath 返回清理后的绝对路径，获取失败时返回清理后的原路径
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// FileSHA256 计算文件内容的SHA-256，返回十六进制摘要
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// StoreUpload 将上传完成的文件按内容摘要保存为 uploads/<sha256>.<ext>
+// 相同内容已存在时删除新文件并复用已有文件，返回保存后的路径、摘要以及是否已存在
+func StoreUpload(tempPath, extension string) (string, string, bool, error) {
+	hash, err := FileSHA256(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return "", "", false, err
+	}
+
+	if existing, ok := FindUpload(hash); ok {
+		os.Remove(tempPath)
+		return existing, hash, true, nil
+	}
+
+	path := filepath.Join(UploadDir, hash+"."+strings.TrimPrefix(extension, "."))
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return "", "", false, err
+	}
+	return path, hash, false, nil
+}
+
+// FindUpload 按摘要查找已保存的上传文件，找到时刷新修改时间，避免仍在使用的文件被定时清理
+func FindUpload(hash string) (string, bool) {
+	hash = strings.ToLower(hash)
+	if !uploadHashPattern.MatchString(hash) {
+		return "", false
+	}
+	matches, err := filepath.Glob(filepath.Join(UploadDir, hash+".*"))
+	if err != nil || len(matches) == 0 {
+		return "", false
+	}
+
+	now := time.Now()
+	os.Chtimes(matches[0], now, now)
+	return matches[0], true
+}
+
+// UploadHash 返回按内容寻址保存的上传文件的摘要，其他文件返回空字符串
+func UploadHash(path string) string {
+	name := filepath.Base(path)
+	hash := strings.TrimSuffix(name, filepath.Ext(name))
+	if filepath.Dir(path) != filepath.Clean(UploadDir) || !uploadHashPattern.MatchString(hash) {
+		return ""
+	}
+	return hash
+}
@@ -0,0 +1,184 @@
+// Package utilstest 提供utils包的测试替身，只在测试中使用
+package utilstest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FakeCommand FakeRunner记录的一次命令调用
+type FakeCommand struct {
+	Name string
+	Args []string
+}
+
+// FakeRunner 不启动进程的CommandRunner，记录每次调用的参数并写入固定的输出，用于测试
+// ffmpeg调用时最后一个参数视为输出文件，写入Outputs中对应扩展名的内容；
+// 文件名包含%d等序号格式时按Frames写入多个文件
+type FakeRunner struct {
+	// Probe ffprobe写入stdout的JSON，为空时使用640x360、5秒、25fps的H.264视频
+	Probe []byte
+	// Outputs 按扩展名（不含点）指定输出文件内容，未指定的gif/png写入1x1的图片，其他写入空文件
+	Outputs map[string][]byte
+	// Frames 序号格式的输出文件数量，默认为1
+	Frames int
+	// Stderr ffmpeg写入stderr的日志，例如showinfo输出
+	Stderr string
+	// Err 非nil时ffmpeg和ffprobe调用都返回该错误
+	Err error
+	// Missing LookPath返回未找到的可执行文件
+	Missing []string
+	// Decoders ffmpeg -decoders列出的解码器，为空时使用DefaultDecoders
+	Decoders []string
+
+	mu    sync.Mutex
+	calls []FakeCommand
+}
+
+// Run 记录调用并写入固定输出
+func (r *FakeRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	r.mu.Lock()
+	r.calls = append(r.calls, FakeCommand{Name: name, Args: slices.Clone(args)})
+	r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.Err != nil {
+		io.WriteString(stderr, r.Stderr)
+		return r.Err
+	}
+
+	if name == "ffprobe" {
+		probe := r.Probe
+		if len(probe) == 0 {
+			probe = []byte(fakeProbeOutput)
+		}
+		_, err := stdout.Write(probe)
+		return err
+	}
+
+	if slices.Contains(args, "-decoders") {
+		return r.writeDecoders(stdout)
+	}
+
+	io.WriteString(stderr, r.Stderr)
+	if len(args) > 0 {
+		if err := r.writeOutput(args[len(args)-1]); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(stdout, "progress=end\n")
+	return err
+}
+
+// LookPath 除Missing中的名称外都视为已安装
+func (r *FakeRunner) LookPath(name string) (string, error) {
+	if slices.Contains(r.Missing, name) {
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return "/usr/bin/" + name, nil
+}
+
+// Calls 返回已记录的调用
+func (r *FakeRunner) Calls() []FakeCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+// DefaultDecoders FakeRunner默认列出的解码器
+var DefaultDecoders = []string{"h264", "hevc", "vp9", "gif", "apng", "libdav1d", "png", "mjpeg", "webp"}
+
+// writeDecoders 按ffmpeg -decoders的格式输出解码器列表
+func (r *FakeRunner) writeDecoders(stdout io.Writer) error {
+	decoders := r.Decoders
+	if len(decoders) == 0 {
+		decoders = DefaultDecoders
+	}
+	var buf bytes.Buffer
+	buf.WriteString("Decoders:\n V..... = Video\n ------\n")
+	for _, name := range decoders {
+		fmt.Fprintf(&buf, " V....D %-20s %s\n", name, name)
+	}
+	_, err := stdout.Write(buf.Bytes())
+	return err
+}
+
+// writeOutput 写入输出文件，"-"和pipe输出不写文件
+func (r *FakeRunner) writeOutput(path string) error {
+	if strings.HasPrefix(path, "-") || strings.HasPrefix(path, "pipe:") {
+		return nil
+	}
+	content, err := r.outputContent(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(path, "%") {
+		return os.WriteFile(path, content, 0644)
+	}
+	frames := max(r.Frames, 1)
+	for i := 1; i <= frames; i++ {
+		if err := os.WriteFile(fmt.Sprintf(path, i), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputContent 扩展名对应的输出内容
+func (r *FakeRunner) outputContent(ext string) ([]byte, error) {
+	if content, ok := r.Outputs[ext]; ok {
+		return content, nil
+	}
+
+	var buf bytes.Buffer
+	pixel := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black})
+	switch ext {
+	case "gif":
+		if err := gif.Encode(&buf, pixel, nil); err != nil {
+			return nil, err
+		}
+	case "png":
+		if err := png.Encode(&buf, pixel); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// fakeProbeOutput FakeRunner默认的ffprobe输出
+const fakeProbeOutput = `{
+  "streams": [
+    {
+      "index": 0,
+      "codec_name": "h264",
+      "codec_type": "video",
+      "width": 640,
+      "height": 360,
+      "pix_fmt": "yuv420p",
+      "avg_frame_rate": "25/1",
+      "r_frame_rate": "25/1",
+      "duration": "5.000000"
+    }
+  ],
+  "format": {
+    "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+    "duration": "5.000000",
+    "size": "102400",
+    "bit_rate": "163840"
+  }
+}`
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// 动画转视频的输出格式
+const (
+	VideoMP4  = "mp4"
+	VideoWebM = "webm"
+)
+
+// VideoEncodeOptions 动画转视频参数
+type VideoEncodeOptions struct {
+	Format string // mp4(H.264) / webm(VP9)
+	CRF    int    // 恒定质量参数，越小画质越好
+	Repeat int    // 额外重复播放的次数
+	Width  int    // 输出宽度，0表示保持原始尺寸
+}
+
+// DefaultCRF 各视频格式的默认CRF
+func DefaultCRF(format string) int {
+	if format == VideoWebM {
+		return 32
+	}
+	return 23
+}
+
+// MaxCRF 各视频格式CRF的上限（x264为51，VP9为63）
+func MaxCRF(format string) int {
+	if format == VideoWebM {
+		return 63
+	}
+	return 51
+}
+
+// ConvertAnimationToVideo 将GIF等动画转换为H.264 MP4或VP9 WebM
+// 宽高调整为偶数以满足yuv420p的要求，duration为播放一遍的时长，用于计算进度
+func (f *FFmpegService) ConvertAnimationToVideo(ctx context.Context, inputPath, outputPath string, duration float64, opts VideoEncodeOptions) error {
+	var args []string
+	if opts.Repeat > 0 {
+		args = append(args, "-stream_loop", strconv.Itoa(opts.Repeat))
+	}
+	args = append(args, "-i", inputPath, "-y")
+
+	scale := "scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	if opts.Width > 0 {
+		scale = fmt.Sprintf("scale=%d:-2:flags=lanczos", opts.Width/2*2)
+	}
+	args = append(args, "-vf", scale+",format=yuv420p", "-an")
+
+	switch opts.Format {
+	case VideoMP4:
+		args = append(args,
+			"-c:v", "libx264",
+			"-crf", strconv.Itoa(opts.CRF),
+			"-preset", "medium",
+			"-movflags", "+faststart",
+			"-f", "mp4",
+		)
+	case VideoWebM:
+		args = append(args,
+			"-c:v", "libvpx-vp9",
+			"-crf", strconv.Itoa(opts.CRF),
+			"-b:v", "0",
+			"-deadline", "good",
+			"-cpu-used", "4",
+			"-row-mt", "1",
+			"-f", "webm",
+		)
+	default:
+		return fmt.Errorf("unsupported video format: %s", opts.Format)
+	}
+	args = append(args, outputPath)
+
+	if output, err := f.runFFmpeg(ctx, args, "encode", 1, 1, duration*float64(opts.Repeat+1)); err != nil {
+		os.Remove(outputPath) // 清理写了一半的输出文件
+		if errors.Is(err, ErrFFmpegTimeout) || errors.Is(err, ErrFFmpegCancelled) {
+			return err
+		}
+		return fmt.Errorf("ffmpeg error: %v, output: %s", err, string(output))
+	}
+	return nil
+}
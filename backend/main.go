@@ -4,12 +4,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"toGif-backend/internal/config"
 	"toGif-backend/internal/database"
 	"toGif-backend/internal/handlers"
 	"toGif-backend/internal/middleware"
 	"toGif-backend/internal/models"
+	"toGif-backend/internal/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -52,6 +54,15 @@ func main() {
 		log.Printf("Database initialization failed: %v", err)
 		log.Println("Continuing without database (stats features will be disabled)")
 	}
+	if database.Available() {
+		// 文件归属保存在数据库中，服务重启后会话仍可管理自己的文件
+		utils.SetArtifactStore(database.ArtifactStore{})
+		if count, err := database.FailStaleConversions(); err != nil {
+			log.Printf("Failed to mark stale conversions: %v", err)
+		} else if count > 0 {
+			log.Printf("Marked %d interrupted conversions as failed", count)
+		}
+	}
 
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
@@ -70,8 +81,11 @@ func main() {
 		"https://www.tugou.site",
 		"http://101.126.6.243",
 	}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+	config.ExposeHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Hash"}
 	config.AllowCredentials = true
 	r.Use(cors.New(config))
 
@@ -86,6 +100,18 @@ func main() {
 	// 初始化清理服务
 	handlers.InitCleanupService(cfg.UploadDir, cfg.StaticDir)
 
+	// 初始化编码调度器和异步任务管理器
+	utils.InitFFmpegTimeouts(time.Duration(cfg.FFmpegTimeout)*time.Second, time.Duration(cfg.FFprobeTimeout)*time.Second)
+	utils.InitEncodeScheduler(cfg.EncodeCapacity, cfg.EncodeQueueSize)
+	utils.InitCaptionFont(cfg.CaptionFontFile)
+	utils.InitEncoder(cfg.GifEncoder)
+	utils.InitConversionCache(cfg.ConversionCacheSize, cfg.StaticDir)
+	utils.InitTusStore(int64(cfg.ResumableUploadMaxSize)*1024*1024, time.Duration(cfg.ResumableUploadExpiry)*time.Hour)
+	if err := utils.InitPresets(cfg.PresetsFile); err != nil {
+		log.Printf("Failed to load presets: %v, using built-in presets", err)
+	}
+	handlers.InitJobManager(cfg.JobWorkers, cfg.JobQueueSize)
+
 	// 静态文件服务
 	staticHandler := func(c *gin.Context) {
 		// 处理预检请求
@@ -115,6 +141,7 @@ func main() {
 
 	// API路由组
 	api := r.Group("/api")
+	api.Use(middleware.Session(cfg.SessionSecret, cfg.SessionCookieSecure)) // 匿名会话，上传、转换历史和输出文件按会话归属
 	{
 		// API根路径信息
 		api.GET("/", func(c *gin.Context) {
@@ -125,7 +152,13 @@ func main() {
 					"version": "1.0.0",
 					"endpoints": gin.H{
 						"health":   "/api/health",
+						"session":  "/api/session",
+						"presets":  "/api/presets",
+						"uploads":  "/api/uploads/*",
 						"video":    "/api/video/*",
+						"images":   "/api/images/*",
+						"gif":      "/api/gif/*",
+						"jobs":     "/api/jobs/*",
 						"compress": "/api/compress/*",
 						"qrcode":   "/api/qrcode/*",
 						"stats":    "/api/stats/*",
@@ -138,14 +171,60 @@ func main() {
 		api.GET("/health", handlers.HealthCheck)
 		api.POST("/cleanup", handlers.ForceCleanup)
 
+		// 当前匿名会话
+		api.GET("/session", handlers.GetSession)
+
+		// 转换预设
+		api.GET("/presets", handlers.ListPresets)
+
+		// 按内容寻址的视频上传，其他视频接口通过videoHash引用
+		uploads := api.Group("/uploads")
+		{
+			uploads.POST("", handlers.UploadVideo)
+			uploads.GET("/:hash", handlers.GetUpload)
+
+			// tus协议的可续传上传，完成后通过uploadId引用
+			uploads.OPTIONS("/tus", handlers.TusOptions)
+			uploads.POST("/tus", handlers.CreateTusUpload)
+			uploads.HEAD("/tus/:id", handlers.GetTusUploadOffset)
+			uploads.PATCH("/tus/:id", handlers.PatchTusUpload)
+			uploads.DELETE("/tus/:id", handlers.DeleteTusUpload)
+		}
+
 		// 视频处理相关路由
 		video := api.Group("/video")
 		{
+			video.POST("/probe", handlers.ProbeVideo)
+			video.POST("/thumbnails", handlers.VideoThumbnails)
+			video.POST("/frames", handlers.ExportFrames)
 			video.POST("/to-gif", handlers.VideoToGif)
 			video.GET("/history", handlers.GetConversionHistory)
 			video.DELETE("/history/:id", handlers.DeleteConversionHistory)
 		}
 
+		// 图片处理相关路由
+		images := api.Group("/images")
+		{
+			images.POST("/to-gif", handlers.ImagesToGif)
+		}
+
+		// 动画处理相关路由
+		gif := api.Group("/gif")
+		{
+			gif.POST("/to-video", handlers.GifToVideo)
+			gif.POST("/edit", handlers.EditGif)
+			gif.POST("/optimize", handlers.OptimizeGif)
+		}
+
+		// 异步任务相关路由
+		jobs := api.Group("/jobs")
+		{
+			jobs.GET("", handlers.ListJobs)
+			jobs.GET("/:id", handlers.GetJob)
+			jobs.GET("/:id/events", handlers.StreamJobEvents)
+			jobs.DELETE("/:id", handlers.CancelJob)
+		}
+
 		// 文件压缩相关路由
 		compress := api.Group("/compress")
 		{
@@ -171,33 +250,7 @@ func main() {
 		// 文件下载相关路由
 		download := api.Group("/download")
 		{
-			download.GET("/:filename", func(c *gin.Context) {
-				filename := c.Param("filename")
-				if filename == "" {
-					c.JSON(http.StatusBadRequest, models.APIResponse{
-						Code:    400,
-						Message: "文件名不能为空",
-					})
-					return
-				}
-
-				// 构建文件路径
-				filePath := cfg.StaticDir + "/" + filename
-
-				// 检查文件是否存在
-				if _, err := os.Stat(filePath); os.IsNotExist(err) {
-					c.JSON(http.StatusNotFound, models.APIResponse{
-						Code:    404,
-						Message: "文件不存在",
-					})
-					return
-				}
-
-				// 设置强制下载的头部
-				c.Header("Content-Disposition", "attachment; filename="+filename)
-				c.Header("Content-Type", "application/octet-stream")
-				c.File(filePath)
-			})
+			download.GET("/:filename", handlers.DownloadFile)
 		}
 
 		// 旧的健康检查保持兼容性
@@ -3,16 +3,38 @@ import type {
   ApiResponse, 
   VideoToGifRequest, 
   VideoToGifResponse, 
+  JobInfo,
+  ConversionProgress,
+  MediaInfo,
+  ThumbnailsRequest,
+  FrameExportRequest,
+  ImagesToGifRequest,
+  ImagesToGifResponse,
+  GifToVideoRequest,
+  GifToVideoResponse,
+  GifEditRequest,
+  GifEditResponse,
+  GifOptimizeRequest,
+  GifOptimizeResponse,
+  FrameExportResponse,
+  ThumbnailsResponse,
   CompressionResponse,
   DecompressionResponse,
   VisitorStats,
-  SystemHealth
+  SystemHealth,
+  UploadResponse,
+  ConversionHistoryQuery,
+  ConversionHistoryResponse,
+  PresetsResponse,
+  SessionInfo
 } from '../types';
-import { API_CONFIG } from '../config';
+import { API_CONFIG, buildApiUrl } from '../config';
 
+// 携带cookie中的匿名会话，上传、转换结果和压缩文件只有所属会话可以访问
 const api = axios.create({
   baseURL: API_CONFIG.BASE_URL,
   timeout: API_CONFIG.TIMEOUT,
+  withCredentials: true,
 });
 
 // 响应拦截器
@@ -32,11 +54,208 @@ api.interceptors.response.use(
   }
 );
 
+// 通过SSE订阅异步任务进度，任务结束时返回结果
+const waitForJob = <T>(
+  jobId: string,
+  failureMessage: string,
+  onProgress?: (progress: ConversionProgress) => void,
+): Promise<T> => {
+  return new Promise<T>((resolve, reject) => {
+    const source = new EventSource(buildApiUrl(`/jobs/${jobId}/events`), { withCredentials: true });
+
+    source.addEventListener('progress', (event) => {
+      const job: JobInfo<T> = JSON.parse((event as MessageEvent).data);
+      if (job.progress) {
+        onProgress?.(job.progress);
+      }
+    });
+
+    source.addEventListener('done', (event) => {
+      source.close();
+      const job: JobInfo<T> = JSON.parse((event as MessageEvent).data);
+      if (job.status === 'succeeded' && job.result) {
+        resolve(job.result);
+      } else {
+        reject(new Error(job.error || failureMessage));
+      }
+    });
+
+    // 网络抖动时EventSource会自动重连，只有连接被关闭时才视为失败
+    source.onerror = () => {
+      if (source.readyState === EventSource.CLOSED) {
+        reject(new Error('进度连接中断'));
+      }
+    };
+  });
+};
+
+// 匿名会话 API
+export const sessionApi = {
+  // 获取当前会话，令牌可在无法使用cookie的环境中通过Authorization: Bearer携带
+  get: async (): Promise<SessionInfo> => {
+    const response: ApiResponse<SessionInfo> = await api.get('/session');
+    return response.data;
+  },
+};
+
+// 转换预设 API
+export const presetApi = {
+  // 获取服务端配置的转换预设
+  list: async (): Promise<PresetsResponse> => {
+    const response: ApiResponse<PresetsResponse> = await api.get('/presets');
+    return response.data;
+  },
+};
+
+// 转换历史 API，只返回当前会话的记录
+export const historyApi = {
+  list: async (query: ConversionHistoryQuery = {}): Promise<ConversionHistoryResponse> => {
+    const response: ApiResponse<ConversionHistoryResponse> = await api.get('/video/history', { params: query });
+    return response.data;
+  },
+
+  // 删除记录及其输出文件，转换进行中时返回409
+  delete: async (id: string): Promise<void> => {
+    await api.delete(`/video/history/${id}`);
+  },
+};
+
+// 视频上传 API，按内容摘要去重
+export const uploadApi = {
+  upload: async (file: File): Promise<UploadResponse> => {
+    const formData = new FormData();
+    formData.append('video', file);
+    const response: ApiResponse<UploadResponse> = await api.post('/uploads', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  // 查询当前会话已上传的视频，不存在、已过期或属于其他会话时返回404
+  get: async (hash: string): Promise<UploadResponse> => {
+    const response: ApiResponse<UploadResponse> = await api.get(`/uploads/${hash}`);
+    return response.data;
+  },
+};
+
+// tus可续传上传，每次PATCH发送一个分片，中断后通过HEAD获取偏移量续传
+// 上传地址按文件名、大小和修改时间保存在localStorage中，刷新页面后同一文件可以继续上传
+const TUS_CHUNK_SIZE = 5 * 1024 * 1024;
+const TUS_MAX_RETRIES = 5;
+const tusClient = axios.create({
+  baseURL: API_CONFIG.BASE_URL,
+  headers: { 'Tus-Resumable': '1.0.0' },
+  withCredentials: true,
+});
+
+const tusStorageKey = (file: File) => `tus-upload:${file.name}:${file.size}:${file.lastModified}`;
+
+// 查询已上传的偏移量，上传不存在或已过期时返回null
+const tusOffset = async (uploadId: string): Promise<{ offset: number; hash?: string } | null> => {
+  try {
+    const response = await tusClient.head(`/uploads/tus/${uploadId}`);
+    return {
+      offset: Number(response.headers['upload-offset']),
+      hash: response.headers['upload-hash'],
+    };
+  } catch (error: any) {
+    if (error.response?.status === 404) return null;
+    throw error;
+  }
+};
+
+export const resumableUploadApi = {
+  // 上传完成后返回视频的SHA-256摘要，可作为videoHash使用
+  upload: async (file: File, onProgress?: (percent: number) => void): Promise<string> => {
+    const storageKey = tusStorageKey(file);
+    let uploadId = localStorage.getItem(storageKey);
+    let state = uploadId ? await tusOffset(uploadId) : null;
+
+    if (!uploadId || !state) {
+      const response = await tusClient.post('/uploads/tus', null, {
+        headers: {
+          'Upload-Length': file.size.toString(),
+          'Upload-Metadata': `filename ${btoa(unescape(encodeURIComponent(file.name)))}`,
+        },
+      });
+      uploadId = (response.headers['location'] as string).split('/').pop()!;
+      localStorage.setItem(storageKey, uploadId);
+      state = { offset: 0 };
+    }
+
+    let retries = 0;
+    while (!state.hash) {
+      onProgress?.(Math.round((state.offset / file.size) * 100));
+      try {
+        const response = await tusClient.patch(
+          `/uploads/tus/${uploadId}`,
+          file.slice(state.offset, state.offset + TUS_CHUNK_SIZE),
+          { headers: { 'Content-Type': 'application/offset+octet-stream', 'Upload-Offset': state.offset.toString() } },
+        );
+        state = { offset: Number(response.headers['upload-offset']), hash: response.headers['upload-hash'] };
+        retries = 0;
+      } catch (error) {
+        // 网络中断时按退避间隔重试，从服务端记录的偏移量继续
+        if (++retries > TUS_MAX_RETRIES) throw error;
+        await new Promise((resolve) => setTimeout(resolve, 1000 * 2 ** retries));
+        const current = await tusOffset(uploadId);
+        if (!current) {
+          localStorage.removeItem(storageKey);
+          throw new Error('上传已过期，请重新上传');
+        }
+        state = current;
+      }
+    }
+
+    localStorage.removeItem(storageKey);
+    onProgress?.(100);
+    return state.hash;
+  },
+};
+
+// 上传视频文件或引用已上传视频的摘要
+const appendVideo = (formData: FormData, file?: File, videoHash?: string) => {
+  if (videoHash) {
+    formData.append('videoHash', videoHash);
+  } else if (file) {
+    formData.append('video', file);
+  }
+};
+
 // 视频转GIF API
 export const videoToGifApi = {
-  convert: async (request: VideoToGifRequest): Promise<VideoToGifResponse> => {
+  // 获取视频的媒体信息
+  probe: async (file?: File, videoHash?: string): Promise<MediaInfo> => {
     const formData = new FormData();
-    formData.append('video', request.file);
+    appendVideo(formData, file, videoHash);
+    const response: ApiResponse<MediaInfo> = await api.post('/video/probe', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  // 提取缩略图和雪碧图
+  thumbnails: async (request: ThumbnailsRequest): Promise<ThumbnailsResponse> => {
+    const formData = new FormData();
+    appendVideo(formData, request.file, request.videoHash);
+    if (request.count !== undefined) formData.append('count', request.count.toString());
+    if (request.mode) formData.append('mode', request.mode);
+    if (request.sceneThreshold !== undefined) formData.append('sceneThreshold', request.sceneThreshold.toString());
+    if (request.width !== undefined) formData.append('width', request.width.toString());
+    if (request.format) formData.append('format', request.format);
+    if (request.columns !== undefined) formData.append('columns', request.columns.toString());
+    const response: ApiResponse<ThumbnailsResponse> = await api.post('/video/thumbnails', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  convert: async (
+    request: VideoToGifRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<VideoToGifResponse> => {
+    const formData = new FormData();
+    appendVideo(formData, request.file, request.videoHash);
     
     if (request.startTime !== undefined) {
       formData.append('startTime', request.startTime.toString());
@@ -50,15 +269,163 @@ export const videoToGifApi = {
     if (request.quality) {
       formData.append('quality', request.quality);
     }
+    if (request.preset) {
+      formData.append('preset', JSON.stringify(request.preset));
+    }
+    if (request.outputFormat) {
+      formData.append('outputFormat', request.outputFormat);
+    }
+    if (request.targetSizeBytes !== undefined) {
+      formData.append('targetSizeBytes', request.targetSizeBytes.toString());
+    }
+    if (request.transform) {
+      formData.append('transform', JSON.stringify(request.transform));
+    }
+    if (request.captions && request.captions.length > 0) {
+      formData.append('captions', JSON.stringify(request.captions));
+    }
+    if (request.watermark) {
+      formData.append('watermark', request.watermark);
+      if (request.watermarkPosition) {
+        formData.append('watermarkPosition', request.watermarkPosition);
+      }
+      if (request.watermarkOpacity !== undefined) {
+        formData.append('watermarkOpacity', request.watermarkOpacity.toString());
+      }
+    }
+    if (request.subtitles) {
+      formData.append('subtitles', request.subtitles);
+    }
+    if (request.optimize !== undefined) {
+      formData.append('optimize', request.optimize.toString());
+    }
+    if (request.lossy !== undefined) {
+      formData.append('lossy', request.lossy.toString());
+    }
 
-    const response: ApiResponse<VideoToGifResponse> = await api.post('/video/to-gif', formData, {
+    // 提交转换任务，服务端立即返回任务ID
+    const submitted: ApiResponse<JobInfo<VideoToGifResponse>> = await api.post('/video/to-gif', formData, {
       headers: {
         'Content-Type': 'multipart/form-data',
       },
-      timeout: 120000, // 2分钟超时，专门用于视频转换
+      timeout: 120000, // 2分钟超时，用于大文件上传
     });
 
-    return response.data;
+    // 命中转换缓存时任务已完成，直接返回结果
+    if (submitted.data.status === 'succeeded' && submitted.data.result) {
+      return submitted.data.result;
+    }
+
+    // 通过SSE订阅任务进度直到结束
+    return waitForJob(submitted.data.id, '视频转换失败', onProgress);
+  },
+
+  // 导出视频片段或GIF的帧序列（ZIP）
+  exportFrames: async (
+    request: FrameExportRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<FrameExportResponse> => {
+    const formData = new FormData();
+    formData.append(request.source, request.file);
+    if (request.startTime !== undefined) formData.append('startTime', request.startTime.toString());
+    if (request.duration !== undefined) formData.append('duration', request.duration.toString());
+    if (request.fps !== undefined) formData.append('fps', request.fps.toString());
+    if (request.width !== undefined) formData.append('width', request.width.toString());
+    if (request.format) formData.append('format', request.format);
+
+    const submitted: ApiResponse<JobInfo<FrameExportResponse>> = await api.post('/video/frames', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+      timeout: 120000,
+    });
+    return waitForJob(submitted.data.id, '帧导出失败', onProgress);
+  },
+};
+
+// 图片序列转GIF API
+export const imagesToGifApi = {
+  convert: async (
+    request: ImagesToGifRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<ImagesToGifResponse> => {
+    const formData = new FormData();
+    request.images.forEach((image) => formData.append('images', image));
+    if (request.delays) formData.append('delays', JSON.stringify(request.delays));
+    if (request.fps !== undefined) formData.append('fps', request.fps.toString());
+    if (request.width !== undefined) formData.append('width', request.width.toString());
+    if (request.height !== undefined) formData.append('height', request.height.toString());
+    if (request.fit) formData.append('fit', request.fit);
+    if (request.background) formData.append('background', request.background);
+    if (request.loop !== undefined) formData.append('loop', request.loop.toString());
+    if (request.quality) formData.append('quality', request.quality);
+
+    const submitted: ApiResponse<JobInfo<ImagesToGifResponse>> = await api.post('/images/to-gif', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+      timeout: 120000,
+    });
+    return waitForJob(submitted.data.id, '图片合成失败', onProgress);
+  },
+};
+
+// 动画处理 API
+export const gifApi = {
+  // 转换为MP4/WebM视频
+  toVideo: async (
+    request: GifToVideoRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<GifToVideoResponse> => {
+    const formData = new FormData();
+    formData.append('gif', request.file);
+    if (request.format) formData.append('format', request.format);
+    if (request.crf !== undefined) formData.append('crf', request.crf.toString());
+    if (request.repeat !== undefined) formData.append('repeat', request.repeat.toString());
+    if (request.width !== undefined) formData.append('width', request.width.toString());
+
+    const submitted: ApiResponse<JobInfo<GifToVideoResponse>> = await api.post('/gif/to-video', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+      timeout: 120000,
+    });
+    return waitForJob(submitted.data.id, '视频转换失败', onProgress);
+  },
+
+  // 编辑上传的GIF或历史记录中的GIF
+  edit: async (
+    request: GifEditRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<GifEditResponse> => {
+    const formData = new FormData();
+    if (request.file) formData.append('gif', request.file);
+    if (request.source) formData.append('source', request.source);
+    if (request.crop) formData.append('crop', JSON.stringify(request.crop));
+    if (request.width !== undefined) formData.append('width', request.width.toString());
+    if (request.height !== undefined) formData.append('height', request.height.toString());
+    if (request.drop) formData.append('drop', request.drop);
+    if (request.delays) formData.append('delays', JSON.stringify(request.delays));
+    if (request.speed !== undefined) formData.append('speed', request.speed.toString());
+    if (request.loop !== undefined) formData.append('loop', request.loop.toString());
+    if (request.reverse) formData.append('reverse', 'true');
+
+    const submitted: ApiResponse<JobInfo<GifEditResponse>> = await api.post('/gif/edit', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+      timeout: 120000,
+    });
+    return waitForJob(submitted.data.id, 'GIF编辑失败', onProgress);
+  },
+
+  // 帧差分优化，结果另存为新文件
+  optimize: async (
+    request: GifOptimizeRequest,
+    onProgress?: (progress: ConversionProgress) => void,
+  ): Promise<GifOptimizeResponse> => {
+    const formData = new FormData();
+    if (request.file) formData.append('gif', request.file);
+    if (request.source) formData.append('source', request.source);
+    if (request.lossy !== undefined) formData.append('lossy', request.lossy.toString());
+
+    const submitted: ApiResponse<JobInfo<GifOptimizeResponse>> = await api.post('/gif/optimize', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+      timeout: 120000,
+    });
+    return waitForJob(submitted.data.id, 'GIF优化失败', onProgress);
   },
 };
 
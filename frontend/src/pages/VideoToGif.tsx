@@ -1,4 +1,4 @@
-import React, { useState, useRef } from 'react';
+import React, { useState, useRef, useEffect } from 'react';
 import { 
   Card, 
   Upload, 
@@ -23,8 +23,8 @@ import {
   InfoCircleOutlined
 } from '@ant-design/icons';
 import type { UploadFile, UploadProps } from 'antd';
-import { videoToGifApi } from '../api';
-import type { VideoToGifRequest } from '../types';
+import { presetApi, resumableUploadApi, videoToGifApi } from '../api';
+import type { MediaInfo, Preset, ThumbnailsResponse, VideoToGifRequest } from '../types';
 import { ClientCompressionService } from '../utils/compression';
 import { buildStaticUrl } from '../config';
 
@@ -35,15 +35,21 @@ interface ConvertForm {
   startTime: number;
   duration: number;
   width: number;
-  quality: 'ultra' | 'high' | 'medium' | 'low';  // 添加 ultra 超高质量
+  quality: string;  // 预设名称
+  outputFormat: 'gif' | 'webp' | 'apng' | 'avif';
+  targetSizeMB?: number;  // 目标大小(MB)，仅GIF
 }
 
 const VideoToGif: React.FC = () => {
   const [form] = Form.useForm<ConvertForm>();
   const [converting, setConverting] = useState(false);
   const [progress, setProgress] = useState(0);
+  const [queuePosition, setQueuePosition] = useState(0);
   const [videoFile, setVideoFile] = useState<File | null>(null);
   const [videoPreview, setVideoPreview] = useState<string>('');
+  const [mediaInfo, setMediaInfo] = useState<MediaInfo | null>(null);
+  const [timeline, setTimeline] = useState<ThumbnailsResponse | null>(null);
+  const [presets, setPresets] = useState<Preset[]>([]);
   const [gifResult, setGifResult] = useState<{
     url: string; 
     size: number; 
@@ -62,6 +68,13 @@ const VideoToGif: React.FC = () => {
   const [downloadingZip, setDownloadingZip] = useState(false);
   const videoRef = useRef<HTMLVideoElement>(null);
 
+  // 加载服务端配置的转换预设，失败时使用内置的四个等级
+  useEffect(() => {
+    presetApi.list()
+      .then((result) => setPresets(result.presets))
+      .catch(() => setPresets([]));
+  }, []);
+
   const uploadProps: UploadProps = {
     name: 'video',
     multiple: false,
@@ -73,15 +86,31 @@ const VideoToGif: React.FC = () => {
         return false;
       }
       
-      const isLt50M = file.size / 1024 / 1024 < 50;
-      if (!isLt50M) {
-        message.error('视频文件大小不能超过 50MB！请压缩后上传');
+      const isLt500M = file.size / 1024 / 1024 < 500;
+      if (!isLt500M) {
+        message.error('视频文件大小不能超过 500MB！请压缩后上传');
         return false;
       }
 
+      // 超过50MB的文件使用可续传上传，网络中断后从中断处继续，之后的请求引用上传后的摘要
+      let videoHash: string | undefined;
+      if (file.size / 1024 / 1024 >= 50) {
+        try {
+          setIsUploading(true);
+          setUploadProgress(0);
+          videoHash = await resumableUploadApi.upload(file, setUploadProgress);
+        } catch (error: any) {
+          message.error(error.response?.data?.message || error.message || '上传失败');
+          return false;
+        } finally {
+          setIsUploading(false);
+          setUploadProgress(0);
+        }
+      }
+
       // 检查是否需要压缩（>= 8MB）
       let fileToProcess = file;
-      if (ClientCompressionService.shouldCompress(file)) {
+      if (!videoHash && ClientCompressionService.shouldCompress(file)) {
         try {
           setIsUploading(true);
           setUploadProgress(20);
@@ -118,22 +147,35 @@ const VideoToGif: React.FC = () => {
       // 重置结果
       setGifResult(null);
       
-      // 获取视频时长
-      const video = document.createElement('video');
-      video.onloadedmetadata = () => {
-        const duration = Math.round(video.duration);
-        // 更新表单中的持续时间
+      // 通过服务端获取媒体信息，预填时长和宽度（不超过原始宽度）
+      // 服务端按内容摘要保存视频，之后的缩略图和转换请求引用摘要，不再重复上传
+      setMediaInfo(null);
+      setTimeline(null);
+      videoToGifApi.probe(fileToProcess, videoHash).then((info) => {
+        setMediaInfo(info);
+
+        // 提取时间轴缩略图，失败不影响转换
+        videoToGifApi.thumbnails({ file: fileToProcess, videoHash: info.videoHash, count: 12, width: 120, columns: 12 })
+          .then(setTimeline)
+          .catch((error) => console.warn('缩略图提取失败:', error));
+
+        const currentWidth = form.getFieldValue('width');
         form.setFieldsValue({
-          duration: duration
+          startTime: 0,
+          duration: Math.round(info.duration),
+          width: info.width > 0 && info.width < currentWidth ? Math.max(100, info.width) : currentWidth,
         });
-      };
-      video.src = url;
+      }).catch((error: any) => {
+        message.error(error.response?.data?.message || '无法读取视频信息');
+      });
       
       return false; // 阻止自动上传
     },
     onRemove: () => {
       setVideoFile(null);
       setVideoPreview('');
+      setMediaInfo(null);
+      setTimeline(null);
       setGifResult(null);
       if (videoPreview) {
         URL.revokeObjectURL(videoPreview);
@@ -154,28 +196,34 @@ const VideoToGif: React.FC = () => {
 
     setConverting(true);
     setProgress(0);
-
-    // 模拟进度
-    const progressInterval = setInterval(() => {
-      setProgress(prev => {
-        if (prev >= 90) {
-          clearInterval(progressInterval);
-          return prev;
-        }
-        return prev + Math.random() * 20;
-      });
-    }, 500);
+    setQueuePosition(0);
 
     try {
       const request: VideoToGifRequest = {
         file: videoFile,
+        videoHash: mediaInfo?.videoHash,
         startTime: values.startTime,
         duration: values.duration,
         width: values.width,
         quality: values.quality,
+        outputFormat: values.outputFormat,
+        targetSizeBytes: values.targetSizeMB ? Math.round(values.targetSizeMB * 1024 * 1024) : undefined,
       };
 
-      const result = await videoToGifApi.convert(request);
+      // 多阶段转换（调色板+编码）按阶段折算总进度
+      const result = await videoToGifApi.convert(request, (p) => {
+        if (p.phase === 'queued') {
+          setQueuePosition(p.queuePosition ?? 0);
+          return;
+        }
+        setQueuePosition(0);
+        if (p.phase === 'optimize') {
+          // 编码完成后的GIF优化阶段，进度条保持在接近完成的位置
+          setProgress(95 + p.percent / 20);
+          return;
+        }
+        setProgress(((p.step - 1) * 100 + p.percent) / p.steps * 0.95);
+      });
       
       setProgress(100);
       setGifResult({
@@ -232,6 +280,8 @@ const VideoToGif: React.FC = () => {
             errorMessage = `转换失败: ${axiosError.response.data.message}`;
           } else if (axiosError.response.status === 500) {
             errorMessage = '服务器内部错误，请检查视频文件格式';
+          } else if (axiosError.response.status === 503) {
+            errorMessage = '服务器繁忙，请稍后再试';
           } else if (axiosError.response.status === 413) {
             errorMessage = '文件太大，请选择较小的视频文件';
           }
@@ -244,7 +294,6 @@ const VideoToGif: React.FC = () => {
       
       alert(errorMessage);
     } finally {
-      clearInterval(progressInterval);
       setConverting(false);
     }
   };
@@ -272,7 +321,7 @@ const VideoToGif: React.FC = () => {
         // 使用直接链接下载，后端会设置正确的Content-Disposition头
         const link = document.createElement('a');
         link.href = downloadUrl;
-        link.download = 'converted.gif';
+        link.download = `converted.${filename.split('.').pop() || 'gif'}`;
         link.style.display = 'none';
         document.body.appendChild(link);
         link.click();
@@ -350,7 +399,7 @@ const VideoToGif: React.FC = () => {
               <p className="ant-upload-text">点击或拖拽视频文件到此区域上传</p>
               <div className="ant-upload-hint">
                 <p style={{ margin: '4px 0' }}>支持格式：MP4、AVI、MOV等常见格式</p>
-                <p style={{ margin: '4px 0' }}>文件大小：50MB以内</p>
+                <p style={{ margin: '4px 0' }}>文件大小：500MB以内，超过50MB的文件分片上传，断网后可继续</p>
                 <p style={{ margin: '4px 0', color: '#1890ff' }}>
                   <CompressOutlined /> ≥8MB的文件：上传时自动压缩，生成的GIF≥8MB时提供ZIP下载
                 </p>
@@ -379,15 +428,39 @@ const VideoToGif: React.FC = () => {
                   src={videoPreview}
                   controls
                   style={{ width: '100%', maxHeight: '300px' }}
-                  onLoadedMetadata={(e) => {
-                    const video = e.target as HTMLVideoElement;
-                    const duration = Math.round(video.duration);
-                    // 更新表单中的持续时间
-                    form.setFieldsValue({
-                      duration: duration
-                    });
-                  }}
                 />
+                {timeline && (
+                  <div style={{ display: 'flex', overflowX: 'auto', gap: 2, marginTop: 8 }}>
+                    {timeline.thumbnails.map((thumb) => (
+                      <div
+                        key={thumb.index}
+                        title={`${thumb.timestamp.toFixed(1)}秒`}
+                        onClick={() => {
+                          // 点击缩略图跳转预览并设为开始时间
+                          if (videoRef.current) {
+                            videoRef.current.currentTime = thumb.timestamp;
+                          }
+                          form.setFieldsValue({ startTime: Math.floor(thumb.timestamp * 10) / 10 });
+                        }}
+                        style={{
+                          flex: 'none',
+                          width: timeline.width,
+                          height: timeline.height,
+                          cursor: 'pointer',
+                          backgroundImage: `url(${buildStaticUrl(timeline.spriteUrl)})`,
+                          backgroundPosition: `-${thumb.x}px -${thumb.y}px`,
+                        }}
+                      />
+                    ))}
+                  </div>
+                )}
+                {mediaInfo && (
+                  <Paragraph type="secondary" style={{ marginTop: 8 }}>
+                    {mediaInfo.width}×{mediaInfo.height} · {mediaInfo.frameRate.toFixed(2)}fps · {mediaInfo.duration.toFixed(1)}秒 · {mediaInfo.videoCodec}
+                    {mediaInfo.rotation ? ` · 旋转${mediaInfo.rotation}°` : ''}
+                    {mediaInfo.hasAudio ? ' · 含音频' : ''}
+                  </Paragraph>
+                )}
               </div>
             )}
           </Card>
@@ -404,6 +477,7 @@ const VideoToGif: React.FC = () => {
                   duration: 0, // 将使用视频全长
                   width: 1080,
                   quality: 'medium',
+                  outputFormat: 'gif',
                 }}
                 onFinish={handleConvert}
               >
@@ -445,13 +519,46 @@ const VideoToGif: React.FC = () => {
                       rules={[{ required: true, message: '请选择质量' }]}
                     >
                       <Select>
-                        <Select.Option value="ultra">超高质量</Select.Option>
-                        <Select.Option value="high">高质量</Select.Option>
-                        <Select.Option value="medium">中等质量</Select.Option>
-                        <Select.Option value="low">低质量</Select.Option>
+                        {presets.length > 0 ? presets.map((preset) => (
+                          <Select.Option key={preset.name} value={preset.name}>
+                            {preset.label || preset.name}（{preset.fps}fps，{preset.maxColors}色）
+                          </Select.Option>
+                        )) : (
+                          <>
+                            <Select.Option value="ultra">超高质量</Select.Option>
+                            <Select.Option value="high">高质量</Select.Option>
+                            <Select.Option value="medium">中等质量</Select.Option>
+                            <Select.Option value="low">低质量</Select.Option>
+                          </>
+                        )}
+                      </Select>
+                    </Form.Item>
+                  </Col>
+                </Row>
+
+                <Row gutter={16}>
+                  <Col span={12}>
+                    <Form.Item
+                      label="输出格式"
+                      name="outputFormat"
+                      rules={[{ required: true, message: '请选择输出格式' }]}
+                    >
+                      <Select>
+                        <Select.Option value="gif">GIF（兼容性最好）</Select.Option>
+                        <Select.Option value="webp">WebP（体积更小）</Select.Option>
+                        <Select.Option value="apng">APNG（无损）</Select.Option>
+                        <Select.Option value="avif">AVIF（体积最小）</Select.Option>
                       </Select>
                     </Form.Item>
                   </Col>
+                  <Col span={12}>
+                    <Form.Item
+                      label="目标大小 (MB，可选，仅GIF)"
+                      name="targetSizeMB"
+                    >
+                      <InputNumber min={0.01} max={50} step={0.5} style={{ width: '100%' }} placeholder="例如 5，自动调整参数以不超过该大小" />
+                    </Form.Item>
+                  </Col>
                 </Row>
 
                 <Form.Item>
@@ -474,7 +581,7 @@ const VideoToGif: React.FC = () => {
             <Card title="转换进度" style={{ marginBottom: '24px' }}>
               <Progress percent={Math.round(progress)} status="active" />
               <Paragraph style={{ textAlign: 'center', marginTop: '16px' }}>
-                正在处理视频，请稍候...
+                {queuePosition > 0 ? `服务器繁忙，排队中（第 ${queuePosition} 位）...` : '正在处理视频，请稍候...'}
               </Paragraph>
             </Card>
           )}
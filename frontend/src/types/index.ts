@@ -23,6 +23,8 @@ export interface SystemHealth {
   uploadsSize: number;
   outputSize: number;
   goroutines: number;
+  encoder: 'ffmpeg' | 'go';
+  ffmpeg: boolean;
   timestamp: string;
 }
 
@@ -33,23 +35,353 @@ export interface ApiResponse<T = unknown> {
   data: T;
 }
 
+// 画面变换参数
+export interface VideoTransform {
+  crop?: { x: number; y: number; width: number; height: number };
+  rotate?: 0 | 90 | 180 | 270;  // 顺时针旋转角度
+  flipH?: boolean;
+  flipV?: boolean;
+  speed?: number;               // 0.25-4
+  reverse?: boolean;
+  boomerang?: boolean;          // 正放后接倒放
+}
+
+// 文字字幕
+export interface Caption {
+  text: string;
+  position?: 'top' | 'center' | 'bottom';
+  fontSize?: number;
+  color?: string;         // #RRGGBB
+  outlineColor?: string;  // #RRGGBB
+  outlineWidth?: number;
+  startTime?: number;
+  endTime?: number;
+}
+
 // 视频转GIF相关类型
+// 转换预设
+export interface Preset {
+  name: string;
+  label?: string;
+  fps: number;
+  scaler: string;
+  maxColors: number;
+  statsMode?: 'full' | 'diff' | 'single';  // single: 每帧单独调色板
+  dither: string;
+  reserveTransparent?: boolean;
+  width: number;             // 未指定宽度时的默认宽度
+  sceneThreshold?: number;   // 大于0时按场景切换分段生成调色板
+}
+
+// 场景自适应调色板的分段（输出时间轴，秒）
+export interface PaletteSegment {
+  start: number;
+  end: number;
+}
+
+export interface PresetsResponse {
+  presets: Preset[];
+  default: string;
+}
+
 export interface VideoToGifRequest {
+  file?: File;
+  videoHash?: string;        // 已上传视频的摘要，与file二选一
+  startTime?: number;
+  duration?: number;
+  width?: number;
+  quality?: string;          // 预设名称，内置 ultra/high/medium/low
+  preset?: Omit<Preset, 'name' | 'label'> & { name?: string };  // 自定义预设，设置后忽略quality
+  outputFormat?: 'gif' | 'webp' | 'apng' | 'avif';
+  targetSizeBytes?: number;  // 目标文件大小（字节），仅GIF
+  transform?: VideoTransform;
+  captions?: Caption[];
+  watermark?: File;          // PNG水印
+  watermarkPosition?: 'top-left' | 'top-right' | 'bottom-left' | 'bottom-right' | 'center';
+  watermarkOpacity?: number; // 0-1
+  subtitles?: File;          // SRT/ASS/VTT字幕文件
+  optimize?: boolean;        // GIF帧差分优化，默认开启
+  lossy?: number;            // 有损优化强度 0-200
+}
+
+export interface MediaStream {
+  index: number;
+  type: 'video' | 'audio' | 'subtitle' | 'data' | string;
+  codec: string;
+  duration?: number;
+  bitRate?: number;
+  width?: number;
+  height?: number;
+  frameRate?: number;
+  pixFmt?: string;
+  sampleRate?: number;
+  channels?: number;
+}
+
+export interface MediaInfo {
+  container: string;
+  duration: number;     // 秒，无法确定时为0
+  size: number;
+  bitRate: number;
+  videoCodec: string;
+  width: number;        // 按旋转校正后的显示宽度
+  height: number;
+  rotation: number;
+  frameRate: number;
+  hasAudio: boolean;
+  streams: MediaStream[];
+  videoHash?: string;   // 上传视频的摘要，后续请求可替代重新上传
+}
+
+export interface ThumbnailsRequest {
+  file?: File;
+  videoHash?: string;   // 已上传视频的摘要，与file二选一
+  count?: number;
+  mode?: 'interval' | 'scene';
+  sceneThreshold?: number;
+  width?: number;
+  format?: 'jpeg' | 'webp';
+  columns?: number;
+}
+
+export interface ThumbnailItem {
+  index: number;
+  timestamp: number;  // 在原视频中的时间(秒)
+  url: string;
+  x: number;          // 在雪碧图中的位置
+  y: number;
+}
+
+export interface ThumbnailsResponse {
+  mode: 'interval' | 'scene';
+  format: 'jpeg' | 'webp';
+  videoDuration: number;
+  width: number;
+  height: number;
+  columns: number;
+  rows: number;
+  spriteUrl: string;
+  thumbnails: ThumbnailItem[];
+}
+
+export interface ImagesToGifRequest {
+  images: File[];
+  delays?: number[];    // 每帧时长(毫秒)，与图片一一对应
+  fps?: number;         // 未指定delays时的统一帧率
+  width?: number;
+  height?: number;
+  fit?: 'fit' | 'fill' | 'pad';
+  background?: string;  // #RRGGBB
+  loop?: number;        // 0无限循环，-1不循环
+  quality?: string;          // 预设名称，默认medium
+}
+
+export interface ImagesToGifResponse {
+  gifUrl: string;
+  fileSize: number;
+  frameCount: number;
+  width: number;
+  height: number;
+  duration: number;
+  loop: number;
+}
+
+export interface GifToVideoRequest {
+  file: File;           // GIF/WebP/APNG/AVIF动画
+  format?: 'mp4' | 'webm';
+  crf?: number;         // mp4为0-51，webm为0-63
+  repeat?: number;      // 额外重复播放的次数
+  width?: number;
+}
+
+export interface GifToVideoResponse {
+  videoUrl: string;
+  format: 'mp4' | 'webm';
+  fileSize: number;
+  originalSize: number;
+  sizeRatio: number;    // 视频大小占原文件的百分比
+  width: number;
+  height: number;
+  duration: number;
+  repeat: number;
+}
+
+export interface GifEditRequest {
+  file?: File;          // 上传的GIF，与source二选一
+  source?: string;      // 历史记录中的文件名
+  crop?: { x: number; y: number; width: number; height: number }; // 原始画布坐标
+  width?: number;
+  height?: number;
+  drop?: string;        // 删除的帧区间，如 "0-4,10"
+  delays?: number[];    // 每帧延迟(毫秒)，对应删除帧、倒放后的输出帧
+  speed?: number;       // 0.25-4
+  loop?: number;        // 0无限循环，-1不循环
+  reverse?: boolean;
+}
+
+export interface GifEditResponse {
+  gifUrl: string;
+  fileSize: number;
+  originalSize: number;
+  frameCount: number;
+  width: number;
+  height: number;
+  duration: number;
+  loop: number;
+}
+
+export interface FrameExportRequest {
   file: File;
+  source: 'video' | 'gif';
   startTime?: number;
   duration?: number;
+  fps?: number;         // GIF不传时保留原始帧
   width?: number;
-  quality?: 'ultra' | 'high' | 'medium' | 'low';  // 添加 ultra 超高质量
+  format?: 'png' | 'jpeg';
+}
+
+export interface FrameExportResponse {
+  zipUrl: string;
+  zipSize: number;
+  source: 'video' | 'gif';
+  format: 'png' | 'jpeg';
+  fps: number;
+  frameCount: number;
+  truncated: boolean;
+  videoHash?: string;
 }
 
 export interface VideoToGifResponse {
-  gifUrl: string;
+  gifUrl: string;            // 输出文件URL（非GIF格式同样使用该字段）
+  format: 'gif' | 'webp' | 'apng' | 'avif';
   fileSize: number;
   duration: number;
   videoDuration: number;
   zipUrl?: string;           // ZIP压缩包下载链接（仅大文件）
   zipSize?: number;          // ZIP文件大小（仅大文件）
   compressionRatio?: number; // 压缩率（仅大文件）
+  transform?: VideoTransform; // 实际应用的画面变换
+  targetSize?: {             // 目标大小模式最终采用的参数
+    targetSizeBytes: number;
+    attempts: number;
+    width: number;
+    fps: number;
+    maxColors: number;
+    dither: string;
+  };
+  optimization?: GifOptimizeInfo; // GIF优化结果
+  preset?: Preset;           // GIF使用的预设
+  segments?: PaletteSegment[]; // 场景自适应调色板的分段
+  cached?: boolean;          // 命中转换缓存，未重新编码
+}
+
+export type ConversionStatus = 'queued' | 'running' | 'succeeded' | 'failed' | 'cancelled';
+
+export interface ConversionParams {
+  width: number;
+  preset?: Preset;
+  targetSizeBytes?: number;
+  optimize: boolean;
+  lossy?: number;
+  transform?: VideoTransform;
+  captions?: number;         // 文字字幕条数
+  subtitles?: boolean;
+  watermark?: boolean;
+}
+
+export interface ConversionHistoryItem {
+  id: string;
+  filename: string;
+  gifUrl: string;            // 输出文件已被清理时为空
+  format: 'gif' | 'webp' | 'apng' | 'avif';
+  fileSize: number;
+  createdAt: string;
+  jobId?: string;
+  sourceFilename?: string;
+  inputSize?: number;
+  preset?: string;
+  params?: ConversionParams;
+  zipUrl?: string;
+  zipSize?: number;
+  startTime: number;
+  duration: number;
+  videoDuration?: number;
+  cached?: boolean;
+  status: ConversionStatus;
+  error?: string;
+  finishedAt?: string;
+  expiresAt?: string;
+  expired: boolean;          // 输出文件已被清理
+}
+
+export interface ConversionHistoryQuery {
+  page?: number;
+  pageSize?: number;         // 默认20，最多100
+  format?: 'gif' | 'webp' | 'apng' | 'avif';
+  status?: ConversionStatus;
+  since?: string;            // RFC3339或YYYY-MM-DD
+  until?: string;
+}
+
+export interface ConversionHistoryResponse {
+  items: ConversionHistoryItem[];
+  total: number;
+  page: number;
+  pageSize: number;
+}
+
+export interface SessionInfo {
+  id: string;
+  token: string;             // 签名令牌，可通过Authorization: Bearer携带
+}
+
+export interface UploadResponse {
+  hash: string;              // 视频内容的SHA-256
+  size: number;
+  existed: boolean;          // 相同内容已上传过
+}
+
+export interface GifOptimizeInfo {
+  originalSize: number;
+  optimizedSize: number;
+  savedPercent: number;
+  originalFrames: number;
+  frames: number;            // 合并重复帧后的帧数
+  lossy: number;
+}
+
+export interface GifOptimizeRequest {
+  file?: File;               // 上传的GIF，与source二选一
+  source?: string;           // 历史记录中的文件名
+  lossy?: number;            // 0-200，默认0（无损）
+}
+
+export interface GifOptimizeResponse extends GifOptimizeInfo {
+  gifUrl: string;
+}
+
+// 转换进度
+export interface ConversionProgress {
+  phase: 'queued' | 'prepare' | 'palette' | 'encode' | 'optimize';
+  step: number;
+  steps: number;
+  percent: number;
+  fps: number;
+  eta: number;
+  queuePosition?: number;  // 排队位置（仅queued阶段）
+}
+
+// 异步任务信息
+export interface JobInfo<T = unknown> {
+  id: string;
+  type: string;
+  status: 'queued' | 'running' | 'succeeded' | 'failed' | 'cancelled';
+  result?: T;
+  error?: string;
+  progress?: ConversionProgress;
+  createdAt: string;
+  startedAt?: string;
+  finishedAt?: string;
 }
 
 // 文件压缩响应类型